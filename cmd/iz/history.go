@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/charmy/iz/internal/fuzzy"
+	"github.com/charmy/iz/internal/history"
+)
+
+// historyCommand implements `iz history [-n count] [-json] [filter]` and returns the process exit code
+func historyCommand(args []string) int {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	count := fs.Int("n", 20, "show the last `count` runs, 0 for all")
+	asJSON := fs.Bool("json", false, "print the entries as JSON lines")
+	failed := fs.Bool("failed", false, "only show runs that failed")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: iz history [-n count] [-json] [-failed] [filter]")
+		fmt.Fprintln(fs.Output(), "\nLists past runs, oldest first. The filter is fuzzy-matched against")
+		fmt.Fprintln(fs.Output(), "the command path and command line.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	query := strings.Join(fs.Args(), " ")
+
+	entries, err := history.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "iz: %v\n", err)
+		return 1
+	}
+
+	var matches []history.Entry
+	for _, entry := range entries {
+		if *failed && !entry.Failed() {
+			continue
+		}
+		if _, _, ok := fuzzy.Match(query, entry.Path+" "+entry.Command); ok {
+			matches = append(matches, entry)
+		}
+		if *count > 0 && len(matches) == *count {
+			break
+		}
+	}
+	// Entries are loaded most recent first, print them like a shell history
+	slices.Reverse(matches)
+
+	for _, entry := range matches {
+		if *asJSON {
+			data, err := json.Marshal(entry)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "iz: %v\n", err)
+				return 1
+			}
+			fmt.Println(string(data))
+			continue
+		}
+
+		status := "✓"
+		if entry.Failed() {
+			status = "✗"
+		}
+		result := fmt.Sprintf("exit %d", entry.ExitCode)
+		if entry.Error != "" {
+			result = entry.Error
+		}
+		fmt.Printf("%s  %s %-8s %8s  %s  $ %s\n",
+			entry.Time.Local().Format("2006-01-02 15:04:05"), status, result, entry.Duration(), entry.Path, entry.Command)
+	}
+	return 0
+}
@@ -6,29 +6,67 @@ import (
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmy/iz/internal/config"
+	"github.com/charmy/iz/internal/state"
 	"github.com/charmy/iz/internal/tree"
 	"github.com/charmy/iz/internal/ui"
 )
 
 func main() {
+	// Dispatch non-interactive subcommands
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "run":
+			os.Exit(runCommand(os.Args[2:]))
+		case "validate":
+			os.Exit(validateCommand(os.Args[2:]))
+		case "history":
+			os.Exit(historyCommand(os.Args[2:]))
+		}
+	}
+
 	// Load configuration with auto-creation
 	cfg, err := config.LoadConfig()
+
+	// Check the config files so that problems are reported in the UI
+	var diagnostics []config.Diagnostic
+	if files, filesErr := config.ConfigFiles(); filesErr == nil {
+		diagnostics = config.Validate(files...)
+	}
 	if err != nil {
-		fmt.Printf("Error loading config: %v\n", err)
-		fmt.Println("Using fallback configuration...")
+		if !config.HasErrors(diagnostics) {
+			diagnostics = append(diagnostics, config.Diagnostic{Severity: config.SeverityError, Message: err.Error()})
+		}
 		cfg = config.GetFallbackConfig()
 	}
 
 	// Convert config to tree structure
 	cmdTree := tree.BuildTreeFromConfig(cfg)
+	diagnostics = append(diagnostics, tree.CheckNeeds(cmdTree)...)
 
 	// Create UI app
 	app := ui.NewApp(cmdTree, cfg.Settings.Confirm)
+	app.Diagnostics = diagnostics
+	app.ShowDiagnostics = config.HasErrors(diagnostics)
+	app.SetConfigFiles(cfg.Files)
+
+	// Restore open folders and the selection of the last session. A broken
+	// state file is not worth failing for, the next save replaces it.
+	st, _ := state.Load()
+	app.RestoreState(st)
 
 	// Start the program
 	p := tea.NewProgram(app, tea.WithAltScreen())
-	if _, err := p.Run(); err != nil {
+	finalModel, err := p.Run()
+	if err != nil {
 		fmt.Printf("Error: %v", err)
 		os.Exit(1)
 	}
+
+	if final, ok := finalModel.(ui.App); ok {
+		final.StopOutput()
+		final.StopJobs()
+		if err := final.SaveState(); err != nil {
+			fmt.Fprintf(os.Stderr, "iz: could not save state: %v\n", err)
+		}
+	}
 }
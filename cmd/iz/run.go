@@ -0,0 +1,113 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/charmy/iz/internal/config"
+	"github.com/charmy/iz/internal/history"
+	"github.com/charmy/iz/internal/tree"
+)
+
+// varFlags collects repeated --var name=value flags
+type varFlags map[string]string
+
+func (v varFlags) String() string {
+	var pairs []string
+	for name, value := range v {
+		pairs = append(pairs, name+"="+value)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (v varFlags) Set(s string) error {
+	name, value, ok := strings.Cut(s, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("expected name=value, got %q", s)
+	}
+	v[name] = value
+	return nil
+}
+
+// runCommand implements `iz run <path> [--var name=value ...]` and returns the process exit code
+func runCommand(args []string) int {
+	vars := varFlags{}
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	fs.Var(vars, "var", "set a variable (`name=value`), may be repeated")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: iz run <path> [--var name=value ...]")
+		fmt.Fprintln(fs.Output(), "\nRuns the command at <path>, e.g. \"Network/Ping Host\", without the TUI.")
+		fs.PrintDefaults()
+	}
+
+	// Allow flags before and after the positional path
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if err == flag.ErrHelp {
+				return 0
+			}
+			return 2
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "iz: error loading config: %v\n", err)
+		return 1
+	}
+
+	root := tree.BuildTreeFromConfig(cfg)
+	node, err := tree.FindNode(root, positional[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "iz: %v\n", err)
+		return 1
+	}
+	if node.IsFolder || !node.Runnable() {
+		fmt.Fprintf(os.Stderr, "iz: %q is a folder, not a command\n", node.Path)
+		return 1
+	}
+	// The commands it needs run first, sharing the variables
+	if node, err = tree.PlanNeeds(root, node); err != nil {
+		fmt.Fprintf(os.Stderr, "iz: %v\n", err)
+		return 1
+	}
+
+	values, err := tree.ResolveVariables(node, vars)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "iz: %v\n", err)
+		return 1
+	}
+
+	spec, err := node.Expand(values)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "iz: %v\n", err)
+		return 1
+	}
+
+	entry := history.NewEntry(node.Path, node, spec, values)
+	started := time.Now()
+	exitCode, err := tree.RunCommand(spec)
+	entry.Finish(started, time.Now(), exitCode, err)
+	if err := history.Append(entry); err != nil {
+		fmt.Fprintf(os.Stderr, "iz: could not record run: %v\n", err)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "iz: %v\n", err)
+		return 1
+	}
+	return exitCode
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/charmy/iz/internal/config"
+	"github.com/charmy/iz/internal/tree"
+)
+
+// validateCommand implements `iz validate [file ...]` and returns the process exit code
+func validateCommand(args []string) int {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: iz validate [file ...]")
+		fmt.Fprintln(fs.Output(), "\nChecks config files and their includes. Without arguments the user")
+		fmt.Fprintln(fs.Output(), "config and the project config of the working directory are checked.")
+	}
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+
+	files := fs.Args()
+	if len(files) == 0 {
+		var err error
+		if files, err = config.ConfigFiles(); err != nil {
+			fmt.Fprintf(os.Stderr, "iz: %v\n", err)
+			return 1
+		}
+	}
+
+	diagnostics := config.Validate(files...)
+	if !config.HasErrors(diagnostics) {
+		// Needs are resolved against the whole tree the files make up
+		if cfg, err := config.LoadFiles(files...); err == nil {
+			diagnostics = append(diagnostics, tree.CheckNeeds(tree.BuildTreeFromConfig(cfg))...)
+		}
+	}
+	for _, d := range diagnostics {
+		fmt.Println(d)
+	}
+
+	if config.HasErrors(diagnostics) {
+		return 1
+	}
+	if len(diagnostics) == 0 {
+		fmt.Printf("✓ %d config file(s) OK\n", len(files))
+	}
+	return 0
+}
@@ -2,8 +2,10 @@ package config
 
 import (
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 
 	"gopkg.in/yaml.v3"
 )
@@ -11,6 +13,9 @@ import (
 // Settings represents global application settings
 type Settings struct {
 	Confirm bool `yaml:"confirm"`
+	// Merge controls how a project config is combined with the user config:
+	// "folder" (default) adds its commands as a top-level folder, "root" merges them at the root
+	Merge string `yaml:"merge,omitempty"`
 }
 
 // VariableOption represents a predefined option for a variable
@@ -19,23 +24,179 @@ type VariableOption struct {
 	Value string `yaml:"value"`
 }
 
+// OptionsSource produces the options of a variable from the output of a command
+type OptionsSource struct {
+	Command string `yaml:"command"`
+	// Format is how the output is split into options, see OptionFormats
+	Format string `yaml:"format,omitempty"`
+	// LabelField and ValueField pick the label and value of each option: a
+	// column number for tsv, a dotted key such as metadata.name for json
+	LabelField string `yaml:"label_field,omitempty"`
+	ValueField string `yaml:"value_field,omitempty"`
+	// Cache is how long the options are reused, e.g. 30s
+	Cache string `yaml:"cache,omitempty"`
+}
+
+// UnmarshalYAML accepts the command alone as a string
+func (s *OptionsSource) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*s = OptionsSource{Command: value.Value}
+		return nil
+	}
+	type plain OptionsSource
+	return value.Decode((*plain)(s))
+}
+
+// Output formats of options_from commands
+const (
+	// FormatLines makes each non-empty line an option (default)
+	FormatLines = "lines"
+	// FormatJSON reads an array of objects, one object per line or kubectl-style {"items": [...]}
+	FormatJSON = "json"
+	// FormatTSV reads tab separated columns, one option per line
+	FormatTSV = "tsv"
+)
+
+// OptionFormats lists the valid values of the format field
+var OptionFormats = []string{FormatLines, FormatJSON, FormatTSV}
+
+// ShellNone runs commands without a shell, split into words like a shell would
+const ShellNone = "none"
+
+// Shells lists the valid values of the shell field
+var Shells = []string{"sh", "bash", "zsh", "fish", ShellNone}
+
+// Quoting modes for substituting variable values into shell commands
+const (
+	// QuoteShell quotes values so the shell sees them as a single word (default)
+	QuoteShell = "shell"
+	// QuoteNone inserts values as-is but rejects shell metacharacters
+	QuoteNone = "none"
+	// QuoteRaw inserts values verbatim, allowing arbitrary shell syntax
+	QuoteRaw = "raw"
+)
+
 // VariableConfig represents configuration for a command variable
 type VariableConfig struct {
 	Name        string           `yaml:"name"`
 	Description string           `yaml:"description,omitempty"`
 	Default     string           `yaml:"default,omitempty"`
 	Options     []VariableOption `yaml:"options,omitempty"`
+	Quote       string           `yaml:"quote,omitempty"`
+	// OptionsFrom loads further options from a command when the variable is asked for
+	OptionsFrom *OptionsSource `yaml:"options_from,omitempty"`
+	// When is a condition on earlier variables, e.g. "{env} == prod", the
+	// variable is only asked for while it holds
+	When string `yaml:"when,omitempty"`
+	// Remember pre-fills the value last used, set it to false for sensitive inputs
+	Remember *bool `yaml:"remember,omitempty"`
+
+	// Type decides how values are checked, see VariableTypes
+	Type string `yaml:"type,omitempty"`
+	// Min and Max limit numbers and durations, or the length of other values
+	Min string `yaml:"min,omitempty"`
+	Max string `yaml:"max,omitempty"`
+	// Pattern is a regular expression the whole value has to match
+	Pattern string `yaml:"pattern,omitempty"`
+	// Required overrides whether the variable may be left empty
+	Required *bool `yaml:"required,omitempty"`
+	// Secret values are masked while typed and never remembered or recorded
+	Secret bool `yaml:"secret,omitempty"`
+
+	// Line locates the definition of this variable
+	Line int `yaml:"-"`
+	// Global is set on top-level variables inherited by a command
+	Global bool `yaml:"-"`
 }
 
-// ConfigNode represents a node in the command tree from YAML
+// Remembered reports whether values of this variable may be stored for later runs
+func (v VariableConfig) Remembered() bool {
+	return !v.Secret && (v.Remember == nil || *v.Remember)
+}
+
+// UnmarshalYAML decodes the variable and records its line number
+func (v *VariableConfig) UnmarshalYAML(value *yaml.Node) error {
+	type plain VariableConfig
+	// Keep the line even when some fields failed to decode
+	err := value.Decode((*plain)(v))
+	v.Line = value.Line
+	return err
+}
+
+// ConfigNode represents a node in the command tree from YAML.
+// A node with only Include set is replaced by the nodes of the included files.
 type ConfigNode struct {
+	Include     string           `yaml:"include,omitempty"`
 	Name        string           `yaml:"name"`
 	Expanded    bool             `yaml:"expanded"`
 	Command     string           `yaml:"command,omitempty"`
+	Argv        []string         `yaml:"argv,omitempty"`
 	Description string           `yaml:"description,omitempty"`
 	Confirm     *bool            `yaml:"confirm,omitempty"`
 	Variables   []VariableConfig `yaml:"variables,omitempty"`
 	Children    []ConfigNode     `yaml:"children,omitempty"`
+
+	// Env, Cwd and Shell set the environment, working directory and shell of
+	// the command, on folders of every command below them
+	Env   map[string]string `yaml:"env,omitempty"`
+	Cwd   string            `yaml:"cwd,omitempty"`
+	Shell string            `yaml:"shell,omitempty"`
+	// Timeout stops the command once it ran that long, e.g. 5m, on folders
+	// every command below them
+	Timeout string `yaml:"timeout,omitempty"`
+	// Concurrency limits how many runs of a command fanned out over several
+	// values run at once, on folders of every command below them
+	Concurrency int `yaml:"concurrency,omitempty"`
+	// Stdin is passed to the command as its standard input
+	Stdin string `yaml:"stdin,omitempty"`
+	// Steps are run one after the other in place of a single command
+	Steps []StepConfig `yaml:"steps,omitempty"`
+	// ID names the command in the needs of others, Needs lists the ids or
+	// paths of the commands to run before this one
+	ID    string   `yaml:"id,omitempty"`
+	Needs []string `yaml:"needs,omitempty"`
+
+	// Source and Line locate the definition of this node
+	Source string `yaml:"-"`
+	Line   int    `yaml:"-"`
+}
+
+// TemplateSources returns the command, argv entries or step commands and the
+// env values and stdin of the node, all of which may contain placeholders
+func (n ConfigNode) TemplateSources() []string {
+	sources := append([]string{n.Command}, n.Argv...)
+	for _, step := range n.Steps {
+		sources = append(sources, step.Command)
+	}
+	for _, name := range slices.Sorted(maps.Keys(n.Env)) {
+		sources = append(sources, n.Env[name])
+	}
+	return append(sources, n.Stdin)
+}
+
+// StepConfig is one step of a command made of steps. A failing step stops
+// the command unless ContinueOnError is set, Confirm asks before running it.
+type StepConfig struct {
+	Name            string `yaml:"name"`
+	Command         string `yaml:"command"`
+	Cwd             string `yaml:"cwd,omitempty"`
+	ContinueOnError bool   `yaml:"continue_on_error,omitempty"`
+	Confirm         bool   `yaml:"confirm,omitempty"`
+}
+
+// HasCommand reports whether the node has something to run: a command, argv
+// or steps
+func (n ConfigNode) HasCommand() bool {
+	return n.Command != "" || len(n.Argv) > 0 || len(n.Steps) > 0
+}
+
+// UnmarshalYAML decodes the node and records its line number
+func (n *ConfigNode) UnmarshalYAML(value *yaml.Node) error {
+	type plain ConfigNode
+	// Keep the line even when some fields failed to decode
+	err := value.Decode((*plain)(n))
+	n.Line = value.Line
+	return err
 }
 
 // Config represents the main configuration structure
@@ -44,11 +205,34 @@ type Config struct {
 	Description string           `yaml:"description,omitempty"`
 	Settings    Settings         `yaml:"settings,omitempty"`
 	Variables   []VariableConfig `yaml:"variables,omitempty"`
+	Include     IncludeList      `yaml:"include,omitempty"`
 	Commands    []ConfigNode     `yaml:"commands"`
+
+	// Files lists every file the configuration was loaded from
+	Files []string `yaml:"-"`
 }
 
-// GetConfigPath returns the configuration file path
+// GetConfigPath returns the user configuration file path, inside
+// $XDG_CONFIG_HOME when it is set unless only ~/.config/iz/config.yaml exists
 func GetConfigPath() (string, error) {
+	homeConfig, err := getHomeConfigPath()
+	xdgConfig := os.Getenv("XDG_CONFIG_HOME")
+	if xdgConfig == "" {
+		return homeConfig, err
+	}
+
+	configFile := filepath.Join(xdgConfig, "iz", "config.yaml")
+	if _, statErr := os.Stat(configFile); os.IsNotExist(statErr) && err == nil {
+		// Keep using the existing file rather than creating a second one
+		if _, statErr := os.Stat(homeConfig); statErr == nil {
+			return homeConfig, nil
+		}
+	}
+	return configFile, nil
+}
+
+// getHomeConfigPath returns the configuration file path below the home directory
+func getHomeConfigPath() (string, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		return "", fmt.Errorf("could not get user home directory: %w", err)
@@ -223,37 +407,79 @@ commands:
 	return nil
 }
 
-// LoadFromFile loads configuration from a YAML file
+// LoadFromFile loads configuration from a YAML file and resolves its includes
 func LoadFromFile(filename string) (*Config, error) {
-	data, err := os.ReadFile(filename)
+	l := &loader{}
+	return l.loadConfig(filename)
+}
+
+// ConfigFiles returns the top-level config files LoadConfig combines: the user
+// config, ~/.config/iz/config.yaml when $XDG_CONFIG_HOME points elsewhere,
+// and the nearest project config found from the working directory
+func ConfigFiles() ([]string, error) {
+	configFile, err := GetConfigPath()
 	if err != nil {
 		return nil, err
 	}
+	files := []string{configFile}
 
-	var cfg Config
-	err = yaml.Unmarshal(data, &cfg)
-	if err != nil {
-		return nil, err
+	// Include the legacy home location when $XDG_CONFIG_HOME points elsewhere
+	if homeConfig, err := getHomeConfigPath(); err == nil && homeConfig != configFile {
+		if _, err := os.Stat(homeConfig); err == nil {
+			files = append(files, homeConfig)
+		}
 	}
 
-	return &cfg, nil
+	// Include the project config of the working directory
+	if wd, err := os.Getwd(); err == nil {
+		projectFile, err := FindProjectConfig(wd)
+		if err != nil {
+			return nil, err
+		}
+		if projectFile != "" {
+			files = append(files, projectFile)
+		}
+	}
+
+	return files, nil
 }
 
-// LoadConfig loads configuration with auto-creation
+// LoadConfig loads the user configuration with auto-creation and merges the
+// other files returned by ConfigFiles into it
 func LoadConfig() (*Config, error) {
 	// Ensure config exists
 	if err := EnsureConfigExists(); err != nil {
 		return nil, err
 	}
 
-	// Get config path
-	configFile, err := GetConfigPath()
+	files, err := ConfigFiles()
+	if err != nil {
+		return nil, err
+	}
+	return LoadFiles(files...)
+}
+
+// LoadFiles loads the first file and merges the others into it, project
+// configs according to their merge setting
+func LoadFiles(files ...string) (*Config, error) {
+	cfg, err := LoadFromFile(files[0])
 	if err != nil {
 		return nil, err
 	}
 
-	// Load config
-	return LoadFromFile(configFile)
+	for _, file := range files[1:] {
+		other, err := LoadFromFile(file)
+		if err != nil {
+			return nil, err
+		}
+		mode := MergeRoot
+		if IsProjectConfig(file) {
+			mode = other.Settings.Merge
+		}
+		mergeConfig(cfg, other, mode)
+	}
+
+	return cfg, nil
 }
 
 // GetFallbackConfig returns a default configuration when file loading fails
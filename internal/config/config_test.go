@@ -0,0 +1,78 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestLoadOptionsFrom(t *testing.T) {
+	path := writeConfig(t, "config.yaml", `variables:
+  - name: short
+    options_from: "git tag"
+  - name: long
+    options_from:
+      command: "kubectl get ns -o json"
+      format: json
+`)
+	cfg, err := LoadFromFile(path)
+	if err != nil {
+		t.Fatalf("LoadFromFile: %v", err)
+	}
+	want := []OptionsSource{
+		{Command: "git tag"},
+		{Command: "kubectl get ns -o json", Format: FormatJSON},
+	}
+	for i, variable := range cfg.Variables {
+		if variable.OptionsFrom == nil || *variable.OptionsFrom != want[i] {
+			t.Errorf("options_from of %s = %+v, want %+v", variable.Name, variable.OptionsFrom, want[i])
+		}
+	}
+}
+
+func TestConfigFilesLegacyLocation(t *testing.T) {
+	home := t.TempDir()
+	xdg := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", xdg)
+	t.Chdir(t.TempDir())
+
+	legacy := filepath.Join(home, ".config", "iz", "config.yaml")
+	if err := os.MkdirAll(filepath.Dir(legacy), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(legacy, []byte("commands:\n  - name: Legacy\n    command: \"true\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The legacy file is the user config and nothing is created under XDG
+	if err := EnsureConfigExists(); err != nil {
+		t.Fatal(err)
+	}
+	current := filepath.Join(xdg, "iz", "config.yaml")
+	if _, err := os.Stat(current); !os.IsNotExist(err) {
+		t.Fatalf("EnsureConfigExists created %s", current)
+	}
+	files, err := ConfigFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{legacy}; !slices.Equal(files, want) {
+		t.Errorf("ConfigFiles() = %q, want %q", files, want)
+	}
+
+	// Both are loaded once the XDG file exists
+	if err := os.MkdirAll(filepath.Dir(current), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(current, []byte("commands:\n  - name: Current\n    command: \"true\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if files, err = ConfigFiles(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{current, legacy}; !slices.Equal(files, want) {
+		t.Errorf("ConfigFiles() = %q, want %q", files, want)
+	}
+}
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/charmy/iz/internal/template"
+)
+
+// References returns the variables that the default, the options_from command
+// and the when condition of the variable refer to, in order of appearance
+func (v VariableConfig) References() []string {
+	sources := []string{v.Default, v.When}
+	if v.OptionsFrom != nil {
+		sources = append(sources, v.OptionsFrom.Command)
+	}
+
+	// A variable referring to itself is kept, it forms a cycle of its own
+	var names []string
+	for _, source := range sources {
+		t, err := template.Parse(source)
+		if err != nil {
+			continue
+		}
+		for _, name := range t.Variables() {
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// OrderVariables returns names together with the variables they refer to, each
+// after the variables it depends on and otherwise in the given order. lookup
+// returns the definition of a variable, or nil when it has none.
+func OrderVariables(names []string, lookup func(name string) *VariableConfig) ([]string, error) {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	marks := make(map[string]int)
+	var order, path []string
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch marks[name] {
+		case done:
+			return nil
+		case visiting:
+			cycle := append(path[slices.Index(path, name):], name)
+			return fmt.Errorf("variables depend on each other: %s", strings.Join(cycle, " → "))
+		}
+		marks[name] = visiting
+		path = append(path, name)
+		if v := lookup(name); v != nil {
+			for _, dep := range v.References() {
+				if err := visit(dep); err != nil {
+					return err
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		marks[name] = done
+		order = append(order, name)
+		return nil
+	}
+
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// Active reports whether the variable is asked for given the values of the
+// variables before it. A when condition is either a single value, which holds
+// unless it is empty, false, no or 0, or a comparison with == or !=.
+func (v VariableConfig) Active(values map[string]string) bool {
+	if strings.TrimSpace(v.When) == "" {
+		return true
+	}
+	t, err := template.Parse(v.When)
+	if err != nil {
+		return true
+	}
+	condition, err := t.Render(values, template.Verbatim)
+	if err != nil {
+		return true
+	}
+
+	for _, op := range []string{"!=", "=="} {
+		if left, right, ok := strings.Cut(condition, op); ok {
+			return (conditionValue(left) == conditionValue(right)) == (op == "==")
+		}
+	}
+	switch strings.ToLower(conditionValue(condition)) {
+	case "", "false", "no", "0":
+		return false
+	}
+	return true
+}
+
+// ExpandDefault returns the default of the variable with the values of the
+// variables it refers to filled in
+func (v VariableConfig) ExpandDefault(values map[string]string) string {
+	if !v.dynamicDefault() {
+		return v.Default
+	}
+	t, _ := template.Parse(v.Default)
+	expanded, err := t.Render(values, template.Verbatim)
+	if err != nil {
+		return v.Default
+	}
+	return expanded
+}
+
+// ExpandOptionsCommand returns the options_from command with the values of the
+// variables it refers to filled in, shell-quoted
+func (v VariableConfig) ExpandOptionsCommand(values map[string]string) (string, error) {
+	t, err := template.Parse(v.OptionsFrom.Command)
+	if err != nil {
+		return "", err
+	}
+	return t.Render(values, func(_, value string) (string, error) {
+		return template.ShellQuote(value), nil
+	})
+}
+
+// dynamicDefault reports whether the default refers to other variables
+func (v VariableConfig) dynamicDefault() bool {
+	t, err := template.Parse(v.Default)
+	return err == nil && len(t.Variables()) > 0
+}
+
+// conditionValue trims spaces and quotes around one side of a condition
+func conditionValue(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		s = s[1 : len(s)-1]
+	}
+	return s
+}
@@ -0,0 +1,695 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Document is a config file parsed into YAML nodes so that it can be edited
+// and written back with its comments, key order and quoting intact.
+// Commands are addressed by the line their definition starts on, as recorded
+// in ConfigNode.Line; line 0 addresses the top level of the file.
+type Document struct {
+	Path string
+
+	root   *yaml.Node
+	indent int
+	// blank records the empty lines, as written, that preceded keys and
+	// items; yaml.v3 drops those when encoding
+	blank map[*yaml.Node]string
+	// noFinalNewline is set when the file did not end with a line break
+	noFinalNewline bool
+}
+
+// keyOrder is the order in which new keys are placed in a command mapping
+var keyOrder = []string{"name", "id", "command", "argv", "steps", "needs", "description", "confirm",
+	"cwd", "shell", "env", "timeout", "stdin", "concurrency", "expanded", "variables", "children"}
+
+// location is the position of a command in its enclosing sequence
+type location struct {
+	seq    *yaml.Node
+	index  int
+	parent *location
+}
+
+func (l *location) node() *yaml.Node {
+	return l.seq.Content[l.index]
+}
+
+// OpenDocument reads a config file for editing
+func OpenDocument(path string) (*Document, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read config file: %w", err)
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if root.Kind == 0 {
+		// Empty file
+		root = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+
+	lines := strings.Split(string(data), "\n")
+	return &Document{
+		Path:           path,
+		root:           &root,
+		indent:         detectIndent(lines),
+		blank:          blankLines(&root, lines),
+		noFinalNewline: len(data) > 0 && !bytes.HasSuffix(data, []byte("\n")),
+	}, nil
+}
+
+// Save writes the document back to its file. The file is rewritten in place
+// so that symlinked configs and file permissions are kept.
+func (d *Document) Save() error {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(d.indent)
+	restore := protectRunes(d.root)
+	err := encoder.Encode(d.root)
+	if err == nil {
+		err = encoder.Close()
+	}
+	data := buf.Bytes()
+	if restore != nil {
+		restore()
+		data = unprotectRunes(data)
+	}
+	if err != nil {
+		return fmt.Errorf("could not encode %s: %w", d.Path, err)
+	}
+	data = restoreBlankLines(data, d.root, d.blank)
+	if d.noFinalNewline {
+		data = bytes.TrimSuffix(data, []byte("\n"))
+	}
+
+	// Make sure the result still loads before replacing the user's file
+	var check yaml.Node
+	if err := yaml.Unmarshal(data, &check); err != nil {
+		return fmt.Errorf("refusing to write invalid YAML to %s: %w", d.Path, err)
+	}
+
+	if err := os.WriteFile(d.Path, data, 0644); err != nil {
+		return fmt.Errorf("could not write config file: %w", err)
+	}
+	return nil
+}
+
+// Get returns the value of key in the command at line, or "" when it is not set
+func (d *Document) Get(line int, key string) (string, error) {
+	mapping, err := d.mapping(line)
+	if err != nil {
+		return "", err
+	}
+	if value := mappingValue(mapping, key); value != nil && value.Kind == yaml.ScalarNode {
+		return value.Value, nil
+	}
+	return "", nil
+}
+
+// SetField sets a string field of the command at line. An empty value removes
+// the field, except for the name.
+func (d *Document) SetField(line int, key, value string) error {
+	mapping, err := d.mapping(line)
+	if err != nil {
+		return err
+	}
+	if value == "" && key != "name" {
+		removeKey(mapping, key)
+		return nil
+	}
+	setKey(mapping, key, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value})
+	return nil
+}
+
+// SetConfirm sets the confirm flag of the command at line, nil removes it so
+// that the default applies
+func (d *Document) SetConfirm(line int, confirm *bool) error {
+	mapping, err := d.mapping(line)
+	if err != nil {
+		return err
+	}
+	if confirm == nil {
+		removeKey(mapping, "confirm")
+		return nil
+	}
+	setKey(mapping, "confirm", &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: fmt.Sprint(*confirm)})
+	return nil
+}
+
+// Insert adds node after the command at line, or as the last child of that
+// command when into is set. Line 0 appends to the top-level commands.
+func (d *Document) Insert(line int, node ConfigNode, into bool) error {
+	item := encodeNode(node)
+
+	if line == 0 {
+		commands, err := d.commands()
+		if err != nil {
+			return err
+		}
+		d.appendItem(commands, item)
+		return nil
+	}
+
+	loc, err := d.find(line)
+	if err != nil {
+		return err
+	}
+	if into {
+		children, err := childrenOf(loc.node())
+		if err != nil {
+			return err
+		}
+		d.appendItem(children, item)
+		return nil
+	}
+
+	d.insertAfter(loc.seq, loc.index, item)
+	return nil
+}
+
+// Delete removes the command at line together with its children
+func (d *Document) Delete(line int) error {
+	loc, err := d.find(line)
+	if err != nil {
+		return err
+	}
+	removeItem(loc.seq, loc.index)
+	return nil
+}
+
+// Duplicate inserts a copy of the command at line right after it, named name
+func (d *Document) Duplicate(line int, name string) error {
+	loc, err := d.find(line)
+	if err != nil {
+		return err
+	}
+	item := d.clone(loc.node())
+	// The comment above the original describes the original
+	item.HeadComment = ""
+	if len(item.Content) > 0 {
+		item.Content[0].HeadComment = ""
+	}
+	setKey(item, "name", &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: name})
+	d.insertAfter(loc.seq, loc.index, item)
+	return nil
+}
+
+// Move swaps the command at line with its sibling delta positions away
+func (d *Document) Move(line, delta int) error {
+	loc, err := d.find(line)
+	if err != nil {
+		return err
+	}
+	target := loc.index + delta
+	if target < 0 {
+		return fmt.Errorf("already at the top")
+	}
+	if target >= len(loc.seq.Content) {
+		return fmt.Errorf("already at the bottom")
+	}
+
+	a, b := loc.seq.Content[loc.index], loc.seq.Content[target]
+	loc.seq.Content[loc.index], loc.seq.Content[target] = b, a
+	// Empty lines separate positions, not commands
+	d.blank[a], d.blank[b] = d.blank[b], d.blank[a]
+	return nil
+}
+
+// MoveInto moves the command at line into the folder right above it and
+// returns the name of that folder
+func (d *Document) MoveInto(line int) (string, error) {
+	loc, err := d.find(line)
+	if err != nil {
+		return "", err
+	}
+	if loc.index == 0 || !isFolder(loc.seq.Content[loc.index-1]) {
+		return "", fmt.Errorf("there is no folder right above to move into")
+	}
+
+	folder := loc.seq.Content[loc.index-1]
+	children, err := childrenOf(folder)
+	if err != nil {
+		return "", err
+	}
+	item := loc.node()
+	removeItem(loc.seq, loc.index)
+	d.appendItem(children, item)
+
+	var name string
+	if value := mappingValue(folder, "name"); value != nil {
+		name = value.Value
+	}
+	return name, nil
+}
+
+// MoveOut moves the command at line out of its folder, placing it right after the folder
+func (d *Document) MoveOut(line int) error {
+	loc, err := d.find(line)
+	if err != nil {
+		return err
+	}
+	if loc.parent == nil {
+		return fmt.Errorf("already at the top level of %s", filepath.Base(d.Path))
+	}
+
+	item := loc.node()
+	removeItem(loc.seq, loc.index)
+	d.insertAfter(loc.parent.seq, loc.parent.index, item)
+	return nil
+}
+
+// body returns the top-level node of the document
+func (d *Document) body() *yaml.Node {
+	if d.root.Kind == yaml.DocumentNode && len(d.root.Content) > 0 {
+		return d.root.Content[0]
+	}
+	return d.root
+}
+
+// commands returns the top-level command list, creating it when missing
+func (d *Document) commands() (*yaml.Node, error) {
+	body := d.body()
+	switch body.Kind {
+	case yaml.SequenceNode:
+		// Included files may consist of a plain list of commands
+		return body, nil
+	case yaml.MappingNode:
+		value := mappingValue(body, "commands")
+		if value == nil {
+			value = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+			body.Content = append(body.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "commands"}, value)
+		}
+		if value.Kind == yaml.ScalarNode && value.Tag == "!!null" {
+			*value = yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		}
+		if value.Kind != yaml.SequenceNode {
+			return nil, fmt.Errorf("%s:%d: commands must be a list", d.Path, value.Line)
+		}
+		return value, nil
+	}
+	return nil, fmt.Errorf("%s: not a config file", d.Path)
+}
+
+// mapping returns the mapping of the command at line, or the top-level mapping for line 0
+func (d *Document) mapping(line int) (*yaml.Node, error) {
+	if line == 0 {
+		body := d.body()
+		if body.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("%s: the top level of this file cannot be edited", d.Path)
+		}
+		return body, nil
+	}
+	loc, err := d.find(line)
+	if err != nil {
+		return nil, err
+	}
+	return loc.node(), nil
+}
+
+// find locates the command whose definition starts at line
+func (d *Document) find(line int) (*location, error) {
+	if line == 0 {
+		return nil, fmt.Errorf("the top level of %s cannot be moved or deleted", filepath.Base(d.Path))
+	}
+	commands, err := d.commands()
+	if err != nil {
+		return nil, err
+	}
+	if loc := findIn(commands, line, nil); loc != nil {
+		return loc, nil
+	}
+	return nil, fmt.Errorf("%s:%d: no command found, the file may have changed", d.Path, line)
+}
+
+func findIn(seq *yaml.Node, line int, parent *location) *location {
+	for i, item := range seq.Content {
+		if item.Kind != yaml.MappingNode {
+			continue
+		}
+		loc := &location{seq: seq, index: i, parent: parent}
+		if item.Line == line {
+			return loc
+		}
+		if children := mappingValue(item, "children"); children != nil && children.Kind == yaml.SequenceNode {
+			if found := findIn(children, line, loc); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+// appendItem adds item at the end of seq, separated like its last item
+func (d *Document) appendItem(seq *yaml.Node, item *yaml.Node) {
+	if n := len(seq.Content); n > 0 {
+		d.blank[item] = d.blank[seq.Content[n-1]]
+	}
+	insertItem(seq, len(seq.Content), item)
+}
+
+// insertAfter inserts item after the i-th item of seq, separated like the
+// item that follows or, at the end, like the i-th item
+func (d *Document) insertAfter(seq *yaml.Node, i int, item *yaml.Node) {
+	next := seq.Content[i]
+	if i+1 < len(seq.Content) {
+		next = seq.Content[i+1]
+	}
+	d.blank[item] = d.blank[next]
+	insertItem(seq, i+1, item)
+}
+
+func insertItem(seq *yaml.Node, index int, item *yaml.Node) {
+	// An empty flow list like children: [] becomes a block list once it has items
+	seq.Style &^= yaml.FlowStyle
+	seq.Content = append(seq.Content, nil)
+	copy(seq.Content[index+1:], seq.Content[index:])
+	seq.Content[index] = item
+}
+
+func removeItem(seq *yaml.Node, index int) {
+	seq.Content = append(seq.Content[:index], seq.Content[index+1:]...)
+}
+
+// childrenOf returns the children list of a folder, creating it when missing
+func childrenOf(mapping *yaml.Node) (*yaml.Node, error) {
+	if !isFolder(mapping) {
+		return nil, fmt.Errorf("line %d: a command cannot contain other commands", mapping.Line)
+	}
+	children := mappingValue(mapping, "children")
+	if children == nil || (children.Kind == yaml.ScalarNode && children.Tag == "!!null") {
+		children = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		setKey(mapping, "children", children)
+	}
+	if children.Kind != yaml.SequenceNode {
+		return nil, fmt.Errorf("line %d: children must be a list", children.Line)
+	}
+	return children, nil
+}
+
+// isFolder reports whether a command mapping is a folder: it has children or
+// nothing to run
+func isFolder(mapping *yaml.Node) bool {
+	if mapping.Kind != yaml.MappingNode {
+		return false
+	}
+	if mappingValue(mapping, "children") != nil {
+		return true
+	}
+	for _, key := range []string{"command", "argv", "steps", "needs", "include"} {
+		if mappingValue(mapping, key) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setKey sets key in mapping. Existing scalars keep their quoting style,
+// new keys are placed according to keyOrder.
+func setKey(mapping *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value != key {
+			continue
+		}
+		old := mapping.Content[i+1]
+		if old.Kind == yaml.ScalarNode && value.Kind == yaml.ScalarNode {
+			old.Value, old.Tag = value.Value, value.Tag
+			if value.Tag != "!!str" || strings.Contains(value.Value, "\n") {
+				old.Style = 0
+			}
+			return
+		}
+		mapping.Content[i+1] = value
+		return
+	}
+
+	// Insert before the first key that belongs after the new one
+	insertAt := len(mapping.Content)
+	rank := keyRank(key)
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if keyRank(mapping.Content[i].Value) > rank {
+			insertAt = i
+			break
+		}
+	}
+	keyNode := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}
+	mapping.Content = append(mapping.Content[:insertAt], append([]*yaml.Node{keyNode, value}, mapping.Content[insertAt:]...)...)
+}
+
+// keyRank returns the position of key in keyOrder, unknown keys come last
+func keyRank(key string) int {
+	for i, k := range keyOrder {
+		if k == key {
+			return i
+		}
+	}
+	return len(keyOrder)
+}
+
+func removeKey(mapping *yaml.Node, key string) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+			return
+		}
+	}
+}
+
+// encodeNode builds the YAML mapping for a new command or, when Children is
+// non-nil, a new folder
+func encodeNode(node ConfigNode) *yaml.Node {
+	mapping := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	setKey(mapping, "name", &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: node.Name})
+	if node.Command != "" {
+		setKey(mapping, "command", &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: node.Command})
+	}
+	if node.Description != "" {
+		setKey(mapping, "description", &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: node.Description})
+	}
+	if node.Confirm != nil {
+		setKey(mapping, "confirm", &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: fmt.Sprint(*node.Confirm)})
+	}
+	if node.Children != nil {
+		setKey(mapping, "children", &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Style: yaml.FlowStyle})
+	}
+	return mapping
+}
+
+// clone deep copies node along with its recorded empty lines
+func (d *Document) clone(node *yaml.Node) *yaml.Node {
+	clone := *node
+	clone.Content = make([]*yaml.Node, len(node.Content))
+	for i, child := range node.Content {
+		clone.Content[i] = d.clone(child)
+	}
+	d.blank[&clone] = d.blank[node]
+	return &clone
+}
+
+// detectIndent returns the indentation width used in lines, defaulting to 2
+func detectIndent(lines []string) int {
+	for _, line := range lines {
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || trimmed == line || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if width := len(line) - len(trimmed); width >= 2 && width <= 8 {
+			return width
+		}
+		break
+	}
+	return 2
+}
+
+// blankLines finds the block mapping keys and sequence items that are
+// preceded by empty lines, not counting comments in between, and returns
+// those lines as written
+func blankLines(root *yaml.Node, lines []string) map[*yaml.Node]string {
+	blank := make(map[*yaml.Node]string)
+	emptyLinesBefore := func(line int) string {
+		end := min(line-2, len(lines)-1)
+		for end >= 0 && strings.HasPrefix(strings.TrimSpace(lines[end]), "#") {
+			end--
+		}
+		start := end
+		for start >= 0 && strings.TrimSpace(lines[start]) == "" {
+			start--
+		}
+		if start == end {
+			return ""
+		}
+		return strings.Join(lines[start+1:end+1], "\n") + "\n"
+	}
+
+	forEachEntry(root, func(entry *yaml.Node) {
+		if empty := emptyLinesBefore(entry.Line); empty != "" {
+			blank[entry] = empty
+		}
+	})
+	// The first key of a mapping in a list shares the line of the list item,
+	// the empty line belongs to the item so that it moves along with it
+	forEachEntry(root, func(entry *yaml.Node) {
+		if entry.Kind == yaml.MappingNode && len(entry.Content) > 0 && entry.Content[0].Line == entry.Line {
+			delete(blank, entry.Content[0])
+		}
+	})
+	return blank
+}
+
+// forEachEntry calls fn for every key of block mappings and every item of
+// block sequences below node
+func forEachEntry(node *yaml.Node, fn func(entry *yaml.Node)) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			forEachEntry(child, fn)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Style&yaml.FlowStyle == 0 {
+				fn(node.Content[i])
+			}
+			forEachEntry(node.Content[i+1], fn)
+		}
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			if node.Style&yaml.FlowStyle == 0 {
+				fn(item)
+			}
+			forEachEntry(item, fn)
+		}
+	}
+}
+
+// restoreBlankLines re-inserts the empty lines recorded in blank into the
+// encoded document. The output is parsed again to find where the recorded
+// nodes ended up, the structure of both trees is identical.
+func restoreBlankLines(data []byte, root *yaml.Node, blank map[*yaml.Node]string) []byte {
+	var encoded yaml.Node
+	if len(blank) == 0 || yaml.Unmarshal(data, &encoded) != nil {
+		return data
+	}
+
+	var edited, reparsed []*yaml.Node
+	forEachEntry(root, func(entry *yaml.Node) { edited = append(edited, entry) })
+	forEachEntry(&encoded, func(entry *yaml.Node) { reparsed = append(reparsed, entry) })
+	if len(edited) != len(reparsed) {
+		return data
+	}
+
+	lines := strings.Split(string(data), "\n")
+	before := make(map[int]string)
+	for i, entry := range edited {
+		if blank[entry] == "" {
+			continue
+		}
+		// Keep the comments above the entry with it, the foot comments of the
+		// entry before stay above the empty lines
+		if at := reparsed[i].Line - 1 - headCommentLines(reparsed[i]); at > 0 {
+			before[at] = blank[entry]
+		}
+	}
+
+	var out strings.Builder
+	for i, line := range lines {
+		out.WriteString(before[i])
+		out.WriteString(line)
+		if i < len(lines)-1 {
+			out.WriteString("\n")
+		}
+	}
+	return []byte(out.String())
+}
+
+// headCommentLines returns how many lines the comment above entry takes up
+func headCommentLines(entry *yaml.Node) int {
+	comment := entry.HeadComment
+	if entry.Kind == yaml.MappingNode && len(entry.Content) > 0 && entry.Content[0].Line == entry.Line {
+		// The comment above a list item may belong to its first key
+		comment += entry.Content[0].HeadComment
+	}
+	if comment == "" {
+		return 0
+	}
+	return strings.Count(comment, "\n") + 1
+}
+
+// runeMarker stands in for characters outside the Basic Multilingual Plane,
+// such as emoji, while encoding: yaml.v3 would write them as escapes like
+// \U0001F50D. It is followed by the code point as six hex digits.
+const runeMarker = "IZRUNE"
+
+var markedRune = regexp.MustCompile(runeMarker + `([0-9A-F]{6})`)
+
+// protectRunes replaces the characters outside the Basic Multilingual Plane in
+// the scalars below node by markers and returns a function putting them back,
+// or nil when the document already contains the marker
+func protectRunes(node *yaml.Node) (restore func()) {
+	var scalars []*yaml.Node
+	var values []string
+	var walk func(n *yaml.Node) bool
+	walk = func(n *yaml.Node) bool {
+		for _, text := range []string{n.Value, n.HeadComment, n.LineComment, n.FootComment} {
+			if strings.Contains(text, runeMarker) {
+				return false
+			}
+		}
+		if n.Kind == yaml.ScalarNode && strings.ContainsFunc(n.Value, func(r rune) bool { return r > 0xFFFF }) {
+			scalars, values = append(scalars, n), append(values, n.Value)
+		}
+		for _, child := range n.Content {
+			if !walk(child) {
+				return false
+			}
+		}
+		return true
+	}
+	if !walk(node) {
+		// The markers could not be told apart from the text
+		return nil
+	}
+
+	for _, scalar := range scalars {
+		var marked strings.Builder
+		for _, r := range scalar.Value {
+			if r > 0xFFFF {
+				fmt.Fprintf(&marked, "%s%06X", runeMarker, r)
+			} else {
+				marked.WriteRune(r)
+			}
+		}
+		scalar.Value = marked.String()
+	}
+	return func() {
+		for i, scalar := range scalars {
+			scalar.Value = values[i]
+		}
+	}
+}
+
+// unprotectRunes puts the characters replaced by protectRunes back into data
+func unprotectRunes(data []byte) []byte {
+	return markedRune.ReplaceAllFunc(data, func(marker []byte) []byte {
+		code, _ := strconv.ParseUint(string(marker[len(runeMarker):]), 16, 32)
+		return []byte(string(rune(code)))
+	})
+}
@@ -0,0 +1,327 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// sample is a config with comments, empty lines and quoting to keep intact
+const sample = `# Commands I use every day
+name: "test"
+
+variables:
+  - name: host # where to connect
+    default: 'localhost'
+
+commands:
+  # Network tools
+  - name: Network
+    expanded: true
+    children:
+      - name: "Ping Host"
+        command: "ping -c 4 {host}"
+        confirm: false
+
+      - name: Trace
+        command: traceroute {host}
+
+  - name: Deploy
+    command: |
+      make build
+      make deploy
+`
+
+func TestDocumentRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+	}{
+		{"sample", sample},
+		{"four spaces", "commands:\n    - name: A\n      command: echo a\n    - name: B\n      children:\n        - name: C\n          command: echo c\n"},
+		{"plain list", "- name: A\n  command: echo a\n\n- name: B\n  command: echo b\n"},
+		{"flow values", "commands:\n  - name: A\n    argv: [echo, a]\n    env: {X: \"1\"}\n    children: []\n"},
+		{"emoji", "name: \"🔍 iz\"\ncommands:\n  - name: 🚀 Deploy\n    command: echo '✅ done 🎉'\n"},
+		{"no final newline", "commands:\n  - name: A\n    command: echo a"},
+		{"spaces on empty lines", "commands:\n  - name: A\n    command: echo a\n    \n  - name: B\n    command: echo b\n\n\n  - name: C\n    command: echo c\n"},
+		{"foot comments", "commands:\n  - name: A\n    command: echo a\n    # about A\n\n  # about B\n  - name: B\n    command: echo b\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfig(t, "config.yaml", tt.config)
+			doc, err := OpenDocument(path)
+			if err != nil {
+				t.Fatalf("OpenDocument: %v", err)
+			}
+			if err := doc.Save(); err != nil {
+				t.Fatalf("Save: %v", err)
+			}
+			if got := readFile(t, path); got != tt.config {
+				t.Errorf("Save() changed the file:\n%s\nwant\n%s", got, tt.config)
+			}
+		})
+	}
+}
+
+func TestDocumentRoundTripFiles(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", "")
+	if err := EnsureConfigExists(); err != nil {
+		t.Fatal(err)
+	}
+	defaultConfig, err := GetConfigPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, source := range []string{"../../examples/config.yaml", defaultConfig} {
+		t.Run(filepath.Base(filepath.Dir(source)), func(t *testing.T) {
+			want := readFile(t, source)
+			path := writeConfig(t, "config.yaml", want)
+			doc, err := OpenDocument(path)
+			if err != nil {
+				t.Fatalf("OpenDocument: %v", err)
+			}
+			if err := doc.Save(); err != nil {
+				t.Fatalf("Save: %v", err)
+			}
+			if got := readFile(t, path); got != want {
+				t.Errorf("Save() changed %s:\n%s", source, got)
+			}
+		})
+	}
+}
+
+func TestDocumentEditKeepsEmoji(t *testing.T) {
+	path := writeConfig(t, "config.yaml", "name: \"🔍 iz\"\ncommands:\n  - name: A\n    command: echo a\n")
+	doc, err := OpenDocument(path)
+	if err != nil {
+		t.Fatalf("OpenDocument: %v", err)
+	}
+	if err := doc.SetField(3, "description", "Say 👋"); err != nil {
+		t.Fatal(err)
+	}
+	if err := doc.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	want := "name: \"🔍 iz\"\ncommands:\n  - name: A\n    command: echo a\n    description: Say 👋\n"
+	if got := readFile(t, path); got != want {
+		t.Errorf("Save() wrote\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestDocumentEdits(t *testing.T) {
+	yes := true
+	tests := []struct {
+		name string
+		edit func(d *Document) error
+		want string
+	}{
+		{
+			name: "set field in key order",
+			edit: func(d *Document) error { return d.SetField(17, "description", "Trace the route") },
+			want: `
+      - name: Trace
+        command: traceroute {host}
+        description: Trace the route
+`,
+		},
+		{
+			name: "set field keeps quoting",
+			edit: func(d *Document) error { return d.SetField(13, "command", "ping -c 2 {host}") },
+			want: `
+      - name: "Ping Host"
+        command: "ping -c 2 {host}"
+        confirm: false
+`,
+		},
+		{
+			name: "remove field",
+			edit: func(d *Document) error { return d.SetConfirm(13, nil) },
+			want: `
+      - name: "Ping Host"
+        command: "ping -c 4 {host}"
+
+      - name: Trace
+`,
+		},
+		{
+			name: "set confirm",
+			edit: func(d *Document) error { return d.SetConfirm(17, &yes) },
+			want: `
+      - name: Trace
+        command: traceroute {host}
+        confirm: true
+`,
+		},
+		{
+			name: "insert after",
+			edit: func(d *Document) error {
+				return d.Insert(13, ConfigNode{Name: "Dig", Command: "dig {host}"}, false)
+			},
+			want: `
+        confirm: false
+
+      - name: Dig
+        command: dig {host}
+
+      - name: Trace
+`,
+		},
+		{
+			name: "insert into folder",
+			edit: func(d *Document) error {
+				return d.Insert(10, ConfigNode{Name: "Tools", Children: []ConfigNode{}}, true)
+			},
+			want: `
+      - name: Trace
+        command: traceroute {host}
+
+      - name: Tools
+        children: []
+
+  - name: Deploy
+`,
+		},
+		{
+			name: "insert at top level",
+			edit: func(d *Document) error { return d.Insert(0, ConfigNode{Name: "Logs", Command: "tail log"}, false) },
+			want: `
+      make deploy
+
+  - name: Logs
+    command: tail log
+`,
+		},
+		{
+			name: "delete",
+			edit: func(d *Document) error { return d.Delete(17) },
+			want: `
+        confirm: false
+
+  - name: Deploy
+`,
+		},
+		{
+			name: "duplicate",
+			edit: func(d *Document) error { return d.Duplicate(20, "Deploy copy") },
+			want: `
+  - name: Deploy
+    command: |
+      make build
+      make deploy
+
+  - name: Deploy copy
+    command: |
+      make build
+      make deploy
+`,
+		},
+		{
+			name: "move",
+			edit: func(d *Document) error { return d.Move(17, -1) },
+			want: `
+    children:
+      - name: Trace
+        command: traceroute {host}
+
+      - name: "Ping Host"
+`,
+		},
+		{
+			name: "move out",
+			edit: func(d *Document) error { return d.MoveOut(17) },
+			want: `
+        confirm: false
+
+  - name: Trace
+    command: traceroute {host}
+
+  - name: Deploy
+`,
+		},
+		{
+			name: "move into",
+			edit: func(d *Document) error {
+				_, err := d.MoveInto(20)
+				return err
+			},
+			want: `
+      - name: Trace
+        command: traceroute {host}
+
+      - name: Deploy
+        command: |
+          make build
+          make deploy
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfig(t, "config.yaml", sample)
+			doc, err := OpenDocument(path)
+			if err != nil {
+				t.Fatalf("OpenDocument: %v", err)
+			}
+			if err := tt.edit(doc); err != nil {
+				t.Fatalf("edit: %v", err)
+			}
+			if err := doc.Save(); err != nil {
+				t.Fatalf("Save: %v", err)
+			}
+			got := readFile(t, path)
+			if !containsLines(got, tt.want) {
+				t.Errorf("Save() wrote\n%s\nwant it to contain\n%s", got, tt.want)
+			}
+			if !strings.HasPrefix(got, "# Commands I use every day\nname: \"test\"\n\nvariables:") {
+				t.Errorf("Save() lost the head of the file:\n%s", got)
+			}
+		})
+	}
+}
+
+func TestDocumentEditErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(d *Document) error
+	}{
+		{"unknown line", func(d *Document) error { return d.Delete(3) }},
+		{"top level", func(d *Document) error { return d.Delete(0) }},
+		{"insert into command", func(d *Document) error { return d.Insert(20, ConfigNode{Name: "X"}, true) }},
+		{"move past the top", func(d *Document) error { return d.Move(10, -1) }},
+		{"move past the bottom", func(d *Document) error { return d.Move(20, 1) }},
+		{"move out of the top level", func(d *Document) error { return d.MoveOut(10) }},
+		{"move into a command", func(d *Document) error {
+			_, err := d.MoveInto(17)
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := OpenDocument(writeConfig(t, "config.yaml", sample))
+			if err != nil {
+				t.Fatalf("OpenDocument: %v", err)
+			}
+			if err := tt.edit(doc); err == nil {
+				t.Error("edit succeeded, want an error")
+			}
+		})
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// containsLines reports whether the lines of want, which starts with a
+// newline, appear in got
+func containsLines(got, want string) bool {
+	return strings.Contains("\n"+got, want)
+}
@@ -0,0 +1,256 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// IncludeRef is a single include path together with the line it appears on
+type IncludeRef struct {
+	Path string
+	Line int
+}
+
+// IncludeList is a list of include paths, which may also be written as a single string
+type IncludeList []IncludeRef
+
+// UnmarshalYAML accepts a scalar or a sequence of scalars
+func (l *IncludeList) UnmarshalYAML(value *yaml.Node) error {
+	switch value.Kind {
+	case yaml.ScalarNode:
+		*l = IncludeList{{Path: value.Value, Line: value.Line}}
+	case yaml.SequenceNode:
+		for _, item := range value.Content {
+			if item.Kind != yaml.ScalarNode {
+				return fmt.Errorf("line %d: include entries must be paths", item.Line)
+			}
+			*l = append(*l, IncludeRef{Path: item.Value, Line: item.Line})
+		}
+	default:
+		return fmt.Errorf("line %d: include must be a path or a list of paths", value.Line)
+	}
+	return nil
+}
+
+// loader reads a config file and everything it includes
+type loader struct {
+	// stack holds the files currently being loaded, for cycle detection
+	stack []string
+	files []string
+}
+
+// loadConfig loads a top-level config file
+func (l *loader) loadConfig(filename string) (*Config, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+
+	if err := l.enter(filename); err != nil {
+		return nil, err
+	}
+	defer l.leave()
+
+	setSource(cfg.Commands, filename)
+	if cfg.Commands, err = l.expand(cfg.Commands, filename, &cfg.Variables); err != nil {
+		return nil, err
+	}
+	for _, ref := range cfg.Include {
+		nodes, err := l.include(ref.Path, filename, ref.Line, &cfg.Variables)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Commands = append(cfg.Commands, nodes...)
+	}
+
+	cfg.Files = l.files
+	return &cfg, nil
+}
+
+// enter pushes filename onto the include stack, failing on cycles
+func (l *loader) enter(filename string) error {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return err
+	}
+	for i, f := range l.stack {
+		if f == abs {
+			chain := append(append([]string{}, l.stack[i:]...), abs)
+			return fmt.Errorf("include cycle: %s", strings.Join(chain, " -> "))
+		}
+	}
+	l.stack = append(l.stack, abs)
+	l.files = append(l.files, filename)
+	return nil
+}
+
+func (l *loader) leave() {
+	l.stack = l.stack[:len(l.stack)-1]
+}
+
+// expand replaces include entries in nodes, recursing into children
+func (l *loader) expand(nodes []ConfigNode, filename string, variables *[]VariableConfig) ([]ConfigNode, error) {
+	if nodes == nil {
+		return nil, nil
+	}
+	// An empty list stays non-nil, children: [] marks an empty folder
+	expanded := []ConfigNode{}
+	for _, node := range nodes {
+		if node.Include != "" {
+			included, err := l.include(node.Include, filename, node.Line, variables)
+			if err != nil {
+				return nil, err
+			}
+			expanded = append(expanded, included...)
+			continue
+		}
+
+		children, err := l.expand(node.Children, filename, variables)
+		if err != nil {
+			return nil, err
+		}
+		node.Children = children
+		expanded = append(expanded, node)
+	}
+	return expanded, nil
+}
+
+// include loads the nodes of every file matching pattern, relative to the including file.
+// Variables defined by included files are added unless they are already defined.
+func (l *loader) include(pattern, from string, line int, variables *[]VariableConfig) ([]ConfigNode, error) {
+	fail := func(err error) error {
+		return fmt.Errorf("%s:%d: include %q: %w", from, line, pattern, err)
+	}
+
+	matches, err := resolveInclude(pattern, from)
+	if err != nil {
+		return nil, fail(err)
+	}
+
+	var nodes []ConfigNode
+	for _, match := range matches {
+		if err := l.enter(match); err != nil {
+			return nil, fail(err)
+		}
+		included, err := l.loadIncluded(match, variables)
+		l.leave()
+		if err != nil {
+			return nil, fail(err)
+		}
+		nodes = append(nodes, included...)
+	}
+	return nodes, nil
+}
+
+// loadIncluded reads an included file, which holds either a list of nodes
+// or a mapping with commands and variables like the main config
+func (l *loader) loadIncluded(filename string, variables *[]VariableConfig) ([]ConfigNode, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+
+	var nodes []ConfigNode
+	var includes IncludeList
+	root := doc.Content[0]
+	switch root.Kind {
+	case yaml.SequenceNode:
+		if err := root.Decode(&nodes); err != nil {
+			return nil, fmt.Errorf("%s: %w", filename, err)
+		}
+	case yaml.MappingNode:
+		var cfg Config
+		if err := root.Decode(&cfg); err != nil {
+			return nil, fmt.Errorf("%s: %w", filename, err)
+		}
+		nodes = cfg.Commands
+		includes = cfg.Include
+		addVariables(variables, cfg.Variables)
+	default:
+		return nil, fmt.Errorf("%s: expected a list of commands or a mapping with commands", filename)
+	}
+
+	setSource(nodes, filename)
+	nodes, err = l.expand(nodes, filename, variables)
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range includes {
+		included, err := l.include(ref.Path, filename, ref.Line, variables)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, included...)
+	}
+	return nodes, nil
+}
+
+// setSource records the defining file on nodes and all their descendants
+func setSource(nodes []ConfigNode, filename string) {
+	for i := range nodes {
+		nodes[i].Source = filename
+		setSource(nodes[i].Children, filename)
+	}
+}
+
+// resolveInclude turns an include pattern into the sorted list of files it refers to
+func resolveInclude(pattern, from string) ([]string, error) {
+	path := pattern
+	if strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(home, path[2:])
+	} else if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(from), path)
+	}
+
+	if !strings.ContainsAny(path, "*?[") {
+		if _, err := os.Stat(path); err != nil {
+			return nil, err
+		}
+		return []string{path}, nil
+	}
+
+	matches, err := filepath.Glob(path)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// addVariables appends variables that are not defined yet
+func addVariables(variables *[]VariableConfig, extra []VariableConfig) {
+	for _, variable := range extra {
+		defined := false
+		for _, existing := range *variables {
+			if existing.Name == variable.Name {
+				defined = true
+				break
+			}
+		}
+		if !defined {
+			*variables = append(*variables, variable)
+		}
+	}
+}
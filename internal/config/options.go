@@ -0,0 +1,64 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kind returns the output format, lines when none is set
+func (s OptionsSource) Kind() string {
+	if s.Format == "" {
+		return FormatLines
+	}
+	return s.Format
+}
+
+// CacheFor returns how long loaded options may be reused, 0 when they are not cached
+func (s OptionsSource) CacheFor() time.Duration {
+	d, err := time.ParseDuration(s.Cache)
+	if err != nil {
+		return 0
+	}
+	return d
+}
+
+// Column returns the 0-based tsv column named by a label_field or value_field
+// setting, or -1 when field is not a column number
+func Column(field string) int {
+	n, err := strconv.Atoi(field)
+	if err != nil || n < 1 {
+		return -1
+	}
+	return n - 1
+}
+
+// check reports problems with the options_from settings
+func (s OptionsSource) check() []string {
+	var problems []string
+	if strings.TrimSpace(s.Command) == "" {
+		problems = append(problems, "options_from needs a command")
+	}
+	if !slices.Contains(OptionFormats, s.Kind()) {
+		return append(problems, fmt.Sprintf("options_from format must be one of %s, got %q", strings.Join(OptionFormats, ", "), s.Format))
+	}
+	if s.Cache != "" {
+		if d, err := time.ParseDuration(s.Cache); err != nil || d < 0 {
+			problems = append(problems, fmt.Sprintf("options_from cache must be a duration such as 30s, got %q", s.Cache))
+		}
+	}
+
+	fields := []struct{ key, value string }{{"label_field", s.LabelField}, {"value_field", s.ValueField}}
+	for _, field := range fields {
+		switch {
+		case field.value == "":
+		case s.Kind() == FormatLines:
+			problems = append(problems, fmt.Sprintf("options_from %s does not apply to the lines format", field.key))
+		case s.Kind() == FormatTSV && Column(field.value) < 0:
+			problems = append(problems, fmt.Sprintf("options_from %s must be a column number starting at 1, got %q", field.key, field.value))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ProjectConfigNames are the file names searched for project-local commands, in order of preference
+var ProjectConfigNames = []string{".iz.yaml", "iz.yaml"}
+
+// Merge modes for combining a project config with the user config
+const (
+	MergeFolder = "folder"
+	MergeRoot   = "root"
+)
+
+// IsProjectConfig reports whether filename is named like a project config
+func IsProjectConfig(filename string) bool {
+	base := filepath.Base(filename)
+	for _, name := range ProjectConfigNames {
+		if base == name {
+			return true
+		}
+	}
+	return false
+}
+
+// FindProjectConfig walks up from dir and returns the first project config
+// file found, or an empty string if there is none
+func FindProjectConfig(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		for _, name := range ProjectConfigNames {
+			candidate := filepath.Join(dir, name)
+			info, err := os.Stat(candidate)
+			if err == nil && !info.IsDir() {
+				return candidate, nil
+			}
+			if err != nil && !os.IsNotExist(err) {
+				return "", fmt.Errorf("could not check %s: %w", candidate, err)
+			}
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// mergeConfig adds the commands and variables of other to cfg. In folder mode
+// the commands are grouped under a top-level folder named after other, which
+// also holds the variables of other. In root mode they are placed next to the
+// existing top-level commands and the variables of other override those of
+// cfg with the same name.
+func mergeConfig(cfg, other *Config, mode string) {
+	switch mode {
+	case MergeRoot:
+		cfg.Commands = append(other.Commands, cfg.Commands...)
+		mergeVariables(cfg, other.Variables)
+	default:
+		source := other.Files[0]
+		name := other.Name
+		if name == "" {
+			name = filepath.Base(filepath.Dir(source))
+		}
+		folder := ConfigNode{
+			Name:        name,
+			Description: other.Description,
+			Expanded:    true,
+			Children:    other.Commands,
+			// Scoped to the project's commands, the user's top-level variables stay as they are
+			Variables: other.Variables,
+			Source:    source,
+		}
+		cfg.Commands = append([]ConfigNode{folder}, cfg.Commands...)
+	}
+
+	cfg.Files = append(cfg.Files, other.Files...)
+}
+
+// mergeVariables adds variables to the top-level ones of cfg, replacing those
+// with the same name
+func mergeVariables(cfg *Config, variables []VariableConfig) {
+	for _, variable := range variables {
+		replaced := false
+		for i := range cfg.Variables {
+			if cfg.Variables[i].Name == variable.Name {
+				cfg.Variables[i] = variable
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			cfg.Variables = append(cfg.Variables, variable)
+		}
+	}
+}
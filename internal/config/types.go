@@ -0,0 +1,244 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Variable types, which decide how values are checked before a command runs
+const (
+	TypeString   = "string"
+	TypeInt      = "int"
+	TypeFloat    = "float"
+	TypeBool     = "bool"
+	TypePath     = "path"
+	TypeFile     = "file"
+	TypeDir      = "dir"
+	TypeURL      = "url"
+	TypeHost     = "host"
+	TypePort     = "port"
+	TypeDuration = "duration"
+)
+
+// VariableTypes lists the valid values of the type field
+var VariableTypes = []string{
+	TypeString, TypeInt, TypeFloat, TypeBool, TypePath, TypeFile,
+	TypeDir, TypeURL, TypeHost, TypePort, TypeDuration,
+}
+
+var hostPattern = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*\.?$`)
+
+// Kind returns the type of the variable, string when none is set
+func (v VariableConfig) Kind() string {
+	if v.Type == "" {
+		return TypeString
+	}
+	return v.Type
+}
+
+// IsPath reports whether values of the variable name filesystem paths
+func (v VariableConfig) IsPath() bool {
+	switch v.Kind() {
+	case TypePath, TypeFile, TypeDir:
+		return true
+	}
+	return false
+}
+
+// Check reports why value is not acceptable for the variable. Empty values
+// are not checked, whether they are allowed is decided by Required.
+func (v VariableConfig) Check(value string) error {
+	if value == "" {
+		return nil
+	}
+	if err := checkType(v.Kind(), value); err != nil {
+		return err
+	}
+	if err := v.checkRange(value); err != nil {
+		return err
+	}
+	if v.Pattern != "" {
+		re, err := compilePattern(v.Pattern)
+		if err != nil {
+			return err
+		}
+		if !re.MatchString(value) {
+			return fmt.Errorf("must match %s", v.Pattern)
+		}
+	}
+	return nil
+}
+
+// checkDefinition reports problems with the type, min, max and pattern settings
+func (v VariableConfig) checkDefinition() []string {
+	var problems []string
+	known := false
+	for _, t := range VariableTypes {
+		known = known || v.Kind() == t
+	}
+	if !known {
+		return []string{fmt.Sprintf("type must be one of %s, got %q", strings.Join(VariableTypes, ", "), v.Type)}
+	}
+
+	for _, bound := range []struct{ key, value string }{{"min", v.Min}, {"max", v.Max}} {
+		if bound.value == "" {
+			continue
+		}
+		if _, err := v.parseLimit(bound.value); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", bound.key, err))
+		}
+	}
+	if v.Kind() == TypeBool && (v.Min != "" || v.Max != "" || v.Pattern != "") {
+		problems = append(problems, "min, max and pattern do not apply to bool variables")
+	}
+	if v.Pattern != "" {
+		if _, err := compilePattern(v.Pattern); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if v.Secret && v.Remember != nil && *v.Remember {
+		problems = append(problems, "secret values are never remembered")
+	}
+	return problems
+}
+
+// checkType checks that value can be read as the given type
+func checkType(kind, value string) error {
+	switch kind {
+	case TypeInt:
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return fmt.Errorf("must be a whole number")
+		}
+	case TypeFloat:
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return fmt.Errorf("must be a number")
+		}
+	case TypeBool:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("must be true or false")
+		}
+	case TypeFile, TypeDir:
+		info, err := os.Stat(ExpandHome(value))
+		switch {
+		case err != nil:
+			return fmt.Errorf("%s does not exist", value)
+		case kind == TypeFile && info.IsDir():
+			return fmt.Errorf("%s is a directory, not a file", value)
+		case kind == TypeDir && !info.IsDir():
+			return fmt.Errorf("%s is not a directory", value)
+		}
+	case TypeURL:
+		u, err := url.Parse(value)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("must be a URL such as https://example.com")
+		}
+	case TypeHost:
+		if net.ParseIP(value) == nil && !hostPattern.MatchString(value) {
+			return fmt.Errorf("must be a host name or IP address")
+		}
+	case TypePort:
+		port, err := strconv.Atoi(value)
+		if err != nil || port < 1 || port > 65535 {
+			return fmt.Errorf("must be a port between 1 and 65535")
+		}
+	case TypeDuration:
+		if _, err := time.ParseDuration(value); err != nil {
+			return fmt.Errorf("must be a duration such as 30s or 5m")
+		}
+	}
+	return nil
+}
+
+// checkRange checks value against min and max. Numbers and durations are
+// compared by value, other types by their length.
+func (v VariableConfig) checkRange(value string) error {
+	measure, err := v.measure(value)
+	if err != nil {
+		return err
+	}
+	unit := ""
+	if v.measuresLength() {
+		unit = " characters"
+	}
+	if v.Min != "" {
+		if min, err := v.parseLimit(v.Min); err == nil && measure < min {
+			return fmt.Errorf("must be at least %s%s", v.Min, unit)
+		}
+	}
+	if v.Max != "" {
+		if max, err := v.parseLimit(v.Max); err == nil && measure > max {
+			return fmt.Errorf("must be at most %s%s", v.Max, unit)
+		}
+	}
+	return nil
+}
+
+// parseLimit converts a min or max setting into a number comparable with measure
+func (v VariableConfig) parseLimit(s string) (float64, error) {
+	if v.measuresLength() {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("must be a length, got %q", s)
+		}
+		return float64(n), nil
+	}
+	return v.measure(s)
+}
+
+// measure converts a value into a number: itself for numbers, nanoseconds for
+// durations and the length for other types
+func (v VariableConfig) measure(s string) (float64, error) {
+	if v.measuresLength() {
+		return float64(utf8.RuneCountInString(s)), nil
+	}
+	if v.Kind() == TypeDuration {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, fmt.Errorf("must be a duration, got %q", s)
+		}
+		return float64(d), nil
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("must be a number, got %q", s)
+	}
+	return n, nil
+}
+
+// measuresLength reports whether min and max limit the length of values
+func (v VariableConfig) measuresLength() bool {
+	switch v.Kind() {
+	case TypeInt, TypeFloat, TypePort, TypeDuration:
+		return false
+	}
+	return true
+}
+
+// compilePattern compiles a pattern that has to match the whole value
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+	}
+	return re, nil
+}
+
+// ExpandHome replaces a leading ~ in path with the home directory
+func ExpandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
@@ -0,0 +1,541 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmy/iz/internal/template"
+	"gopkg.in/yaml.v3"
+)
+
+// Diagnostic severities
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Diagnostic is a problem found in a config file
+type Diagnostic struct {
+	File     string
+	Line     int
+	Column   int
+	Severity string
+	Message  string
+}
+
+// String formats the diagnostic as file:line:column: severity: message
+func (d Diagnostic) String() string {
+	location := d.File
+	if d.Line > 0 {
+		location += fmt.Sprintf(":%d", d.Line)
+		if d.Column > 0 {
+			location += fmt.Sprintf(":%d", d.Column)
+		}
+	}
+	return fmt.Sprintf("%s: %s: %s", location, d.Severity, d.Message)
+}
+
+// HasErrors reports whether any diagnostic is an error
+func HasErrors(diagnostics []Diagnostic) bool {
+	for _, d := range diagnostics {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the given config files and everything they include, and
+// reports every problem at once. The files share one scope of global variables,
+// like the merged configuration built by LoadConfig.
+func Validate(filenames ...string) []Diagnostic {
+	v := &validator{globals: make(map[string]VariableConfig)}
+	for _, filename := range filenames {
+		v.file(filename, false)
+	}
+	v.checkPlaceholders()
+
+	sort.SliceStable(v.diagnostics, func(i, j int) bool {
+		a, b := v.diagnostics[i], v.diagnostics[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Line < b.Line
+	})
+	return v.diagnostics
+}
+
+// validator collects diagnostics while walking config files
+type validator struct {
+	diagnostics []Diagnostic
+	// stack holds the files currently being validated, for cycle detection
+	stack []string
+	// globals holds all global variables by name
+	globals map[string]VariableConfig
+	// commands are checked for undefined placeholders once all globals are known
+	commands []commandRef
+	// scope holds the variables of the folders around the nodes being checked
+	scope []VariableConfig
+}
+
+// commandRef is a command node remembered for the placeholder check
+type commandRef struct {
+	file string
+	node ConfigNode
+	// inherited are the variables of the folders above the node, outermost first
+	inherited []VariableConfig
+}
+
+func (v *validator) add(file string, line, column int, severity, format string, args ...interface{}) {
+	v.diagnostics = append(v.diagnostics, Diagnostic{
+		File:     file,
+		Line:     line,
+		Column:   column,
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// yamlErrorLine extracts the line number from yaml error messages
+var yamlErrorLine = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// addYAMLError reports a YAML error, splitting multi-line unmarshal errors
+func (v *validator) addYAMLError(file string, err error) {
+	message := strings.TrimPrefix(err.Error(), "yaml: unmarshal errors:\n")
+	for _, line := range strings.Split(message, "\n") {
+		line = strings.TrimSpace(line)
+		if m := yamlErrorLine.FindStringSubmatch(line); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			v.add(file, n, 0, SeverityError, "%s", m[2])
+		} else if line != "" {
+			v.add(file, 0, 0, SeverityError, "%s", strings.TrimPrefix(line, "yaml: "))
+		}
+	}
+}
+
+// file validates a config file. Included files may also contain a plain list of commands.
+func (v *validator) file(filename string, included bool) {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		abs = filename
+	}
+	for _, f := range v.stack {
+		if f == abs {
+			// The include that closes the cycle has already been reported
+			return
+		}
+	}
+	v.stack = append(v.stack, abs)
+	defer func() { v.stack = v.stack[:len(v.stack)-1] }()
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		v.add(filename, 0, 0, SeverityError, "%v", err)
+		return
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		v.addYAMLError(filename, err)
+		return
+	}
+	if len(doc.Content) == 0 {
+		if !included {
+			v.add(filename, 0, 0, SeverityWarning, "config file is empty")
+		}
+		return
+	}
+
+	root := doc.Content[0]
+	if included && root.Kind == yaml.SequenceNode {
+		var nodes []ConfigNode
+		v.decode(filename, root, reflect.ValueOf(&nodes).Elem())
+		v.checkNodes(filename, nodes)
+		return
+	}
+
+	var cfg Config
+	v.decode(filename, root, reflect.ValueOf(&cfg).Elem())
+
+	switch cfg.Settings.Merge {
+	case "", MergeFolder, MergeRoot:
+	default:
+		v.add(filename, findKeyLine(root, "settings"), 0, SeverityError,
+			"settings.merge must be %q or %q, got %q", MergeFolder, MergeRoot, cfg.Settings.Merge)
+	}
+
+	v.checkVariables(filename, cfg.Variables)
+	for _, variable := range cfg.Variables {
+		v.globals[variable.Name] = variable
+	}
+	v.checkNodes(filename, cfg.Commands)
+	for _, ref := range cfg.Include {
+		v.include(filename, ref.Line, ref.Path)
+	}
+}
+
+// include validates every file matched by an include pattern
+func (v *validator) include(from string, line int, pattern string) {
+	matches, err := resolveInclude(pattern, from)
+	if err != nil {
+		v.add(from, line, 0, SeverityError, "include %q: %v", pattern, err)
+		return
+	}
+	if len(matches) == 0 {
+		v.add(from, line, 0, SeverityWarning, "include %q matches no files", pattern)
+	}
+
+	for _, match := range matches {
+		abs, _ := filepath.Abs(match)
+		for i, f := range v.stack {
+			if f == abs {
+				chain := append(append([]string{}, v.stack[i:]...), abs)
+				v.add(from, line, 0, SeverityError, "include cycle: %s", strings.Join(chain, " -> "))
+				return
+			}
+		}
+		v.file(match, true)
+	}
+}
+
+// checkNodes performs the semantic checks on a list of sibling nodes
+func (v *validator) checkNodes(file string, nodes []ConfigNode) {
+	seen := make(map[string]int)
+	for _, node := range nodes {
+		if node.Include != "" {
+			if node.Name != "" || node.HasCommand() || len(node.Children) > 0 {
+				v.add(file, node.Line, 0, SeverityError, "include entries cannot also define name, command or children")
+			}
+			v.include(file, node.Line, node.Include)
+			continue
+		}
+
+		if node.Name == "" {
+			v.add(file, node.Line, 0, SeverityError, "node has no name")
+		} else if line, ok := seen[node.Name]; ok {
+			v.add(file, node.Line, 0, SeverityError, "duplicate name %q, already used on line %d", node.Name, line)
+		} else {
+			seen[node.Name] = node.Line
+		}
+
+		hasCommand := node.HasCommand()
+		switch {
+		case node.Command != "" && len(node.Argv) > 0:
+			v.add(file, node.Line, 0, SeverityError, "%q has both command and argv", node.Name)
+		case len(node.Steps) > 0 && (node.Command != "" || len(node.Argv) > 0):
+			v.add(file, node.Line, 0, SeverityError, "%q has both a command and steps", node.Name)
+		case hasCommand && len(node.Children) > 0:
+			v.add(file, node.Line, 0, SeverityError, "%q has both a command and children", node.Name)
+		case !hasCommand && node.Children == nil && node.Name != "":
+			v.add(file, node.Line, 0, SeverityWarning, "%q has neither a command nor children", node.Name)
+		}
+
+		for _, source := range node.TemplateSources() {
+			if _, err := template.Parse(source); err != nil {
+				v.add(file, node.Line, 0, SeverityError, "%q: %v", node.Name, err)
+			}
+		}
+		if node.Shell != "" && !slices.Contains(Shells, node.Shell) {
+			v.add(file, node.Line, 0, SeverityError, "%q: shell must be one of %s, got %q",
+				node.Name, strings.Join(Shells, ", "), node.Shell)
+		}
+		if node.Timeout != "" {
+			if d, err := time.ParseDuration(node.Timeout); err != nil || d <= 0 {
+				v.add(file, node.Line, 0, SeverityError, "%q: timeout must be a duration such as 30s or 5m, got %q",
+					node.Name, node.Timeout)
+			}
+		}
+		if node.Concurrency < 0 {
+			v.add(file, node.Line, 0, SeverityError, "%q: concurrency must be at least 1, got %d", node.Name, node.Concurrency)
+		}
+		if node.Stdin != "" && len(node.Children) > 0 {
+			v.add(file, node.Line, 0, SeverityWarning, "%q: stdin only applies to commands, not folders", node.Name)
+		}
+		for i, step := range node.Steps {
+			if strings.TrimSpace(step.Command) == "" {
+				v.add(file, node.Line, 0, SeverityError, "%q: step %d has no command", node.Name, i+1)
+			}
+		}
+
+		for name := range node.Env {
+			if name == "" || strings.ContainsAny(name, "= ") {
+				v.add(file, node.Line, 0, SeverityError, "%q: invalid environment variable name %q", node.Name, name)
+			}
+		}
+
+		v.checkVariables(file, node.Variables)
+		if hasCommand {
+			v.commands = append(v.commands, commandRef{file: file, node: node, inherited: slices.Clone(v.scope)})
+		}
+
+		// Variables of a folder are visible to everything below it
+		outer := v.scope
+		v.scope = append(slices.Clone(v.scope), node.Variables...)
+		v.checkNodes(file, node.Children)
+		v.scope = outer
+	}
+}
+
+// checkVariables validates variable definitions
+func (v *validator) checkVariables(file string, variables []VariableConfig) {
+	seen := make(map[string]bool)
+	for _, variable := range variables {
+		if variable.Name == "" {
+			v.add(file, variable.Line, 0, SeverityError, "variable has no name")
+			continue
+		}
+		if seen[variable.Name] {
+			v.add(file, variable.Line, 0, SeverityError, "variable %q is defined twice", variable.Name)
+		}
+		seen[variable.Name] = true
+
+		switch variable.Quote {
+		case "", QuoteShell, QuoteNone, QuoteRaw:
+		default:
+			v.add(file, variable.Line, 0, SeverityError, "variable %q: quote must be %q, %q or %q, got %q",
+				variable.Name, QuoteShell, QuoteNone, QuoteRaw, variable.Quote)
+		}
+
+		for _, problem := range variable.checkDefinition() {
+			v.add(file, variable.Line, 0, SeverityError, "variable %q: %s", variable.Name, problem)
+		}
+		if variable.Default != "" && variable.Kind() != TypeFile && variable.Kind() != TypeDir && !variable.dynamicDefault() {
+			// Files and directories may not exist where the config is checked,
+			// defaults referring to other variables are only known when asked for
+			if err := variable.Check(variable.Default); err != nil {
+				v.add(file, variable.Line, 0, SeverityError, "variable %q: default %q %v", variable.Name, variable.Default, err)
+			}
+		}
+		if variable.OptionsFrom != nil {
+			for _, problem := range variable.OptionsFrom.check() {
+				v.add(file, variable.Line, 0, SeverityError, "variable %q: %s", variable.Name, problem)
+			}
+		}
+		// Loaded options are only known when the command runs
+		if variable.Default != "" && len(variable.Options) > 0 && variable.OptionsFrom == nil && !variable.dynamicDefault() {
+			found := false
+			for _, option := range variable.Options {
+				if option.Value == variable.Default {
+					found = true
+					break
+				}
+			}
+			if !found {
+				v.add(file, variable.Line, 0, SeverityError, "variable %q: default %q is not among its options",
+					variable.Name, variable.Default)
+			}
+		}
+	}
+}
+
+// checkPlaceholders reports placeholders without a matching variable of the
+// command, a folder above it or the top level
+func (v *validator) checkPlaceholders() {
+	for _, ref := range v.commands {
+		local := make(map[string]VariableConfig)
+		for _, variable := range ref.node.Variables {
+			local[variable.Name] = variable
+		}
+		lookup := func(name string) *VariableConfig {
+			if variable, ok := local[name]; ok {
+				return &variable
+			}
+			for i := len(ref.inherited) - 1; i >= 0; i-- {
+				if ref.inherited[i].Name == name {
+					return &ref.inherited[i]
+				}
+			}
+			if variable, ok := v.globals[name]; ok {
+				return &variable
+			}
+			return nil
+		}
+
+		var missing []string
+		seen := make(map[string]bool)
+		for _, source := range ref.node.TemplateSources() {
+			t, err := template.Parse(source)
+			if err != nil {
+				continue
+			}
+			for _, name := range t.Variables() {
+				if lookup(name) == nil && !seen[name] {
+					seen[name] = true
+					missing = append(missing, "{"+name+"}")
+				}
+			}
+		}
+		// Commands with needs also use the variables of the commands they
+		// need, which only the tree knows
+		if len(missing) > 0 && len(ref.node.Needs) == 0 {
+			v.add(ref.file, ref.node.Line, 0, SeverityError, "%q uses %s without a matching variable definition",
+				ref.node.Name, strings.Join(missing, ", "))
+			continue
+		}
+		v.checkReferences(ref, lookup)
+	}
+}
+
+// checkReferences reports variables of a command that refer to undefined
+// variables or depend on each other
+func (v *validator) checkReferences(ref commandRef, lookup func(name string) *VariableConfig) {
+	var names []string
+	for _, source := range ref.node.TemplateSources() {
+		if t, err := template.Parse(source); err == nil {
+			names = append(names, t.Variables()...)
+		}
+	}
+	order, err := OrderVariables(names, lookup)
+	if err != nil {
+		v.add(ref.file, ref.node.Line, 0, SeverityError, "%q: %v", ref.node.Name, err)
+		return
+	}
+
+	for _, name := range order {
+		variable := lookup(name)
+		if variable == nil {
+			continue
+		}
+		// Inherited variables are reported at the command, they may live in another file
+		line := ref.node.Line
+		if slices.ContainsFunc(ref.node.Variables, func(local VariableConfig) bool { return local.Name == name }) {
+			line = variable.Line
+		}
+		for _, dep := range variable.References() {
+			if lookup(dep) == nil {
+				v.add(ref.file, line, 0, SeverityError, "variable %q refers to {%s} without a matching variable definition",
+					name, dep)
+			}
+		}
+	}
+}
+
+// decode walks a YAML node alongside the Go value it decodes into and reports
+// unknown fields and values of the wrong type with their position. Unlike
+// yaml.Node.Decode it keeps going past errors, so that every problem is found
+// and the semantic checks still see all nodes.
+func (v *validator) decode(file string, node *yaml.Node, out reflect.Value) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	t := out.Type()
+
+	switch {
+	case t.Kind() == reflect.Ptr:
+		if out.IsNil() {
+			out.Set(reflect.New(t.Elem()))
+		}
+		v.decode(file, node, out.Elem())
+	case t == reflect.TypeOf(OptionsSource{}) && node.Kind == yaml.ScalarNode:
+		// options_from may be given as the command alone
+		out.Set(reflect.ValueOf(OptionsSource{Command: node.Value}))
+	case t.Kind() == reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			v.add(file, node.Line, node.Column, SeverityError, "expected a mapping")
+			return
+		}
+		if line := out.FieldByName("Line"); line.IsValid() && line.Kind() == reflect.Int {
+			line.SetInt(int64(node.Line))
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			field, ok := fieldByTag(t, key.Value)
+			if !ok {
+				message := fmt.Sprintf("unknown field %q", key.Value)
+				if suggestion := suggestField(t, key.Value); suggestion != "" {
+					message += fmt.Sprintf(", did you mean %q?", suggestion)
+				}
+				// LoadConfig ignores unknown fields, so they do not stop iz from starting
+				v.add(file, key.Line, key.Column, SeverityWarning, "%s", message)
+				continue
+			}
+			v.decode(file, value, out.FieldByIndex(field.Index))
+		}
+	case t.Kind() == reflect.Slice && t != reflect.TypeOf(IncludeList{}):
+		if node.Kind != yaml.SequenceNode {
+			v.add(file, node.Line, node.Column, SeverityError, "expected a list")
+			return
+		}
+		items := reflect.MakeSlice(t, 0, len(node.Content))
+		for _, item := range node.Content {
+			elem := reflect.New(t.Elem()).Elem()
+			v.decode(file, item, elem)
+			items = reflect.Append(items, elem)
+		}
+		out.Set(items)
+	default:
+		if err := node.Decode(out.Addr().Interface()); err != nil {
+			message := strings.TrimSpace(strings.TrimPrefix(err.Error(), "yaml: unmarshal errors:\n"))
+			if m := yamlErrorLine.FindStringSubmatch(message); m != nil {
+				message = m[2]
+			}
+			v.add(file, node.Line, node.Column, SeverityError, "%s", message)
+		}
+	}
+}
+
+// fieldByTag finds the struct field decoded from the given YAML key
+func fieldByTag(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if name == key && name != "-" {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// suggestField returns a known key of t within a small edit distance of key
+func suggestField(t reflect.Type, key string) string {
+	best, bestDistance := "", 3
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		if d := editDistance(strings.ToLower(key), name); d < bestDistance {
+			best, bestDistance = name, d
+		}
+	}
+	return best
+}
+
+// editDistance computes the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// findKeyLine returns the line of a key in a mapping node, or the mapping's own line
+func findKeyLine(mapping *yaml.Node, key string) int {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i].Line
+		}
+	}
+	return mapping.Line
+}
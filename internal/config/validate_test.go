@@ -0,0 +1,235 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// writeConfig writes content to a config file in a fresh directory and returns its path
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		// want lists the diagnostics as line: severity: message
+		want []string
+	}{
+		{
+			name: "valid",
+			config: `variables:
+  - name: host
+commands:
+  - name: Network
+    variables:
+      - name: count
+        default: "4"
+    children:
+      - name: Ping
+        command: "ping -c {count} {host}"
+`,
+		},
+		{
+			name: "options_from as a string",
+			config: `variables:
+  - name: cluster
+  - name: namespace
+    options_from: "kubectl --context {cluster} get ns -o name"
+`,
+		},
+		{
+			name:   "empty",
+			config: "",
+			want:   []string{"0: warning: config file is empty"},
+		},
+		{
+			name: "unknown field",
+			config: `commands:
+  - name: Ping
+    comand: ping
+    command: ping localhost
+`,
+			want: []string{`3: warning: unknown field "comand", did you mean "command"?`},
+		},
+		{
+			name: "wrong type",
+			config: `commands:
+  - name: Ping
+    command: ping localhost
+    confirm: maybe
+`,
+			want: []string{"4: error: cannot unmarshal !!str `maybe` into bool"},
+		},
+		{
+			name: "command and children",
+			config: `commands:
+  - name: Ping
+    command: ping localhost
+    children:
+      - name: Other
+        command: "true"
+`,
+			want: []string{`2: error: "Ping" has both a command and children`},
+		},
+		{
+			name: "duplicate names",
+			config: `commands:
+  - name: Ping
+    command: ping a
+  - name: Ping
+    command: ping b
+`,
+			want: []string{`4: error: duplicate name "Ping", already used on line 2`},
+		},
+		{
+			name: "neither command nor children",
+			config: `commands:
+  - name: Ping
+`,
+			want: []string{`2: warning: "Ping" has neither a command nor children`},
+		},
+		{
+			name: "undefined placeholder",
+			config: `commands:
+  - name: Ping
+    command: ping {host}
+`,
+			want: []string{`2: error: "Ping" uses {host} without a matching variable definition`},
+		},
+		{
+			name: "folder variable out of scope",
+			config: `commands:
+  - name: A
+    variables:
+      - name: host
+    children:
+      - name: Ping
+        command: ping {host}
+  - name: B
+    children:
+      - name: Ping
+        command: ping {host}
+`,
+			want: []string{`10: error: "Ping" uses {host} without a matching variable definition`},
+		},
+		{
+			name: "default not among options",
+			config: `variables:
+  - name: env
+    default: staging
+    options:
+      - {label: Dev, value: dev}
+      - {label: Prod, value: prod}
+`,
+			want: []string{`2: error: variable "env": default "staging" is not among its options`},
+		},
+		{
+			name: "variable defined twice",
+			config: `variables:
+  - name: host
+  - name: host
+`,
+			want: []string{`3: error: variable "host" is defined twice`},
+		},
+		{
+			name: "shell and timeout",
+			config: `commands:
+  - name: Ping
+    command: ping localhost
+    shell: tcsh
+    timeout: soon
+`,
+			want: []string{
+				`2: error: "Ping": shell must be one of sh, bash, zsh, fish, none, got "tcsh"`,
+				`2: error: "Ping": timeout must be a duration such as 30s or 5m, got "soon"`,
+			},
+		},
+		{
+			name: "merge setting",
+			config: `settings:
+  merge: sideways
+`,
+			want: []string{`1: error: settings.merge must be "folder" or "root", got "sideways"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfig(t, "config.yaml", tt.config)
+			var got []string
+			for _, d := range Validate(path) {
+				if d.File != path {
+					t.Errorf("diagnostic for %s, want %s", d.File, path)
+				}
+				got = append(got, fmt.Sprintf("%d: %s: %s", d.Line, d.Severity, d.Message))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Validate() =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateIncludeCycle(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.yaml")
+	b := filepath.Join(dir, "b.yaml")
+	if err := os.WriteFile(a, []byte("include:\n  - b.yaml\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(b, []byte("include:\n  - a.yaml\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	diagnostics := Validate(a)
+	if !HasErrors(diagnostics) {
+		t.Fatalf("Validate() = %v, want an include cycle error", diagnostics)
+	}
+	want := fmt.Sprintf("include cycle: %s -> %s -> %s", a, b, a)
+	if !slices.ContainsFunc(diagnostics, func(d Diagnostic) bool { return d.Message == want }) {
+		t.Errorf("Validate() = %v, want %q", diagnostics, want)
+	}
+}
+
+func TestHasErrors(t *testing.T) {
+	warning := Diagnostic{Severity: SeverityWarning, Message: "w"}
+	failure := Diagnostic{Severity: SeverityError, Message: "e"}
+	tests := []struct {
+		diagnostics []Diagnostic
+		want        bool
+	}{
+		{nil, false},
+		{[]Diagnostic{warning}, false},
+		{[]Diagnostic{warning, failure}, true},
+	}
+	for _, tt := range tests {
+		if got := HasErrors(tt.diagnostics); got != tt.want {
+			t.Errorf("HasErrors(%v) = %v, want %v", tt.diagnostics, got, tt.want)
+		}
+	}
+}
+
+func TestDiagnosticString(t *testing.T) {
+	tests := []struct {
+		d    Diagnostic
+		want string
+	}{
+		{Diagnostic{File: "c.yaml", Severity: SeverityError, Message: "bad"}, "c.yaml: error: bad"},
+		{Diagnostic{File: "c.yaml", Line: 3, Severity: SeverityWarning, Message: "odd"}, "c.yaml:3: warning: odd"},
+		{Diagnostic{File: "c.yaml", Line: 3, Column: 5, Severity: SeverityError, Message: "bad"}, "c.yaml:3:5: error: bad"},
+	}
+	for _, tt := range tests {
+		if got := tt.d.String(); got != tt.want {
+			t.Errorf("String() = %q, want %q", got, tt.want)
+		}
+	}
+}
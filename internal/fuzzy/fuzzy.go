@@ -0,0 +1,85 @@
+// Package fuzzy implements the subsequence matching used to filter commands.
+package fuzzy
+
+import (
+	"unicode"
+)
+
+const (
+	scoreMatch       = 16
+	bonusConsecutive = 12
+	bonusBoundary    = 10
+	bonusFirst       = 8
+	penaltyGap       = 1
+	maxGapPenalty    = 12
+)
+
+// Match reports whether the characters of pattern appear in text in order,
+// ignoring case. The score rewards consecutive characters and characters at
+// the start of words; positions are the matched rune indexes in text.
+func Match(pattern, text string) (score int, positions []int, ok bool) {
+	p := []rune(pattern)
+	t := []rune(text)
+	if len(p) == 0 {
+		return 0, nil, true
+	}
+
+	// Find where the first complete match ends
+	pi, end := 0, -1
+	for i, r := range t {
+		if unicode.ToLower(r) == unicode.ToLower(p[pi]) {
+			pi++
+			if pi == len(p) {
+				end = i
+				break
+			}
+		}
+	}
+	if end < 0 {
+		return 0, nil, false
+	}
+
+	// Walk back from there to find the shortest match ending at end
+	positions = make([]int, len(p))
+	pi = len(p) - 1
+	for i := end; i >= 0 && pi >= 0; i-- {
+		if unicode.ToLower(t[i]) == unicode.ToLower(p[pi]) {
+			positions[pi] = i
+			pi--
+		}
+	}
+
+	for i, pos := range positions {
+		score += scoreMatch
+		if isBoundary(t, pos) {
+			score += bonusBoundary
+		}
+		if i == 0 {
+			if pos == 0 {
+				score += bonusFirst
+			}
+			continue
+		}
+		if gap := pos - positions[i-1] - 1; gap == 0 {
+			score += bonusConsecutive
+		} else {
+			score -= min(gap*penaltyGap, maxGapPenalty)
+		}
+	}
+	return score, positions, true
+}
+
+// isBoundary reports whether the rune at i starts a word
+func isBoundary(t []rune, i int) bool {
+	if i == 0 {
+		return true
+	}
+	prev, cur := t[i-1], t[i]
+	switch {
+	case !unicode.IsLetter(prev) && !unicode.IsDigit(prev):
+		return true
+	case unicode.IsLower(prev) && unicode.IsUpper(cur):
+		return true
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package fuzzy
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern   string
+		text      string
+		ok        bool
+		positions []int
+	}{
+		{"", "anything", true, nil},
+		{"ping", "Ping Host", true, []int{0, 1, 2, 3}},
+		{"PH", "ping host", true, []int{0, 5}},
+		{"nph", "Network/Ping Host", true, []int{0, 8, 13}},
+		{"gh", "Ping Host", true, []int{3, 5}},
+		{"héé", "Héé", true, []int{0, 1, 2}},
+		{"hp", "Ping Host", false, nil},
+		{"pingg", "Ping", false, nil},
+		{"x", "", false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" in "+tt.text, func(t *testing.T) {
+			_, positions, ok := Match(tt.pattern, tt.text)
+			if ok != tt.ok {
+				t.Fatalf("Match(%q, %q) ok = %v, want %v", tt.pattern, tt.text, ok, tt.ok)
+			}
+			if !slices.Equal(positions, tt.positions) {
+				t.Errorf("Match(%q, %q) positions = %v, want %v", tt.pattern, tt.text, positions, tt.positions)
+			}
+		})
+	}
+}
+
+func TestMatchScore(t *testing.T) {
+	// Each pattern should rank the first text above the second
+	tests := []struct {
+		pattern       string
+		better, worse string
+	}{
+		{"ping", "Ping Host", "Upload Image Now Go"},
+		{"ph", "Ping Host", "Graph"},
+		{"dep", "Deploy", "Run Deep Checks"},
+		{"log", "Logs", "Show Blog"},
+		{"ch", "CheckHealth", "Cache"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			better, _, ok := Match(tt.pattern, tt.better)
+			if !ok {
+				t.Fatalf("Match(%q, %q) did not match", tt.pattern, tt.better)
+			}
+			worse, _, ok := Match(tt.pattern, tt.worse)
+			if !ok {
+				t.Fatalf("Match(%q, %q) did not match", tt.pattern, tt.worse)
+			}
+			if better <= worse {
+				t.Errorf("score of %q = %d, not above %d of %q", tt.better, better, worse, tt.worse)
+			}
+		})
+	}
+}
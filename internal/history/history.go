@@ -0,0 +1,229 @@
+// Package history records the commands iz ran in a JSON Lines file in the
+// state directory.
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/charmy/iz/internal/config"
+	"github.com/charmy/iz/internal/state"
+	"github.com/charmy/iz/internal/tree"
+)
+
+// Entry is a single recorded run, one JSON object per line of the history file
+type Entry struct {
+	Time time.Time `json:"time"`
+	// Path is the path of the command in the tree, e.g. "Network/Ping Host"
+	Path    string   `json:"path,omitempty"`
+	Command string   `json:"command"`
+	Argv    []string `json:"argv,omitempty"`
+	// Values are the variable values the command was expanded with
+	Values     map[string]string `json:"values,omitempty"`
+	Cwd        string            `json:"cwd,omitempty"`
+	ExitCode   int               `json:"exit_code"`
+	DurationMS int64             `json:"duration_ms"`
+	// Error is set when the command could not be executed at all
+	Error string `json:"error,omitempty"`
+	// Redacted is set when values of secret or not remembered variables were
+	// left out, such runs cannot be repeated without entering them again
+	Redacted bool `json:"redacted,omitempty"`
+}
+
+// NewEntry starts an entry for running spec of the command at path. The
+// values of the node's secret and not remembered variables are masked and not
+// recorded.
+func NewEntry(path string, node *tree.TreeNode, spec tree.RunSpec, values map[string]string) Entry {
+	e := Entry{Path: path, Command: spec.String(), Argv: spec.Argv, Values: maps.Clone(values)}
+	e.Cwd = config.ExpandHome(spec.Dir)
+	if e.Cwd == "" {
+		e.Cwd, _ = os.Getwd()
+	}
+	if node == nil || len(node.Unrecorded()) == 0 {
+		return e
+	}
+
+	redacted := node.RedactUnrecorded(spec, values)
+	e.Command, e.Argv = redacted.String(), redacted.Argv
+	for _, name := range node.Unrecorded() {
+		delete(e.Values, name)
+	}
+	e.Redacted = true
+	return e
+}
+
+// Duration returns how long the command ran
+func (e Entry) Duration() time.Duration {
+	return time.Duration(e.DurationMS) * time.Millisecond
+}
+
+// Failed reports whether the command could not run or exited non-zero
+func (e Entry) Failed() bool {
+	return e.Error != "" || e.ExitCode != 0
+}
+
+// Finish records the outcome of the run
+func (e *Entry) Finish(started, finished time.Time, exitCode int, err error) {
+	e.Time = started
+	e.DurationMS = finished.Sub(started).Milliseconds()
+	e.ExitCode = exitCode
+	if err != nil {
+		e.Error = err.Error()
+	}
+}
+
+// GetHistoryPath returns the path of the history file in the state directory
+func GetHistoryPath() (string, error) {
+	dir, err := state.GetStateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "history.jsonl"), nil
+}
+
+// Append adds an entry to the end of the history file
+func Append(e Entry) error {
+	path, err := GetHistoryPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("could not create state directory: %w", err)
+	}
+
+	// A single write of a whole line keeps concurrent iz processes from
+	// interleaving their entries
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("could not open history file: %w", err)
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("could not write history file: %w", err)
+	}
+	info, statErr := f.Stat()
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if statErr == nil && info.Size() > maxSize {
+		return trim(path)
+	}
+	return nil
+}
+
+// maxSize is how large the history file may grow before its older half is dropped
+const maxSize = 2 << 20
+
+// trim drops the oldest entries of the history file at path, keeping the
+// newest ones within half of maxSize
+func trim(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read history file: %w", err)
+	}
+	if len(data) <= maxSize {
+		return nil
+	}
+	keep := data[len(data)-maxSize/2:]
+	// Start at a whole entry
+	if i := bytes.IndexByte(keep, '\n'); i >= 0 {
+		keep = keep[i+1:]
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, keep, 0600); err != nil {
+		return fmt.Errorf("could not write history file: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// Load returns the recorded runs, most recent first. A missing file yields no
+// entries, lines that cannot be parsed are skipped.
+func Load() ([]Entry, error) {
+	path, err := GetHistoryPath()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read history file: %w", err)
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	slices.Reverse(entries)
+	return entries, nil
+}
+
+// Frecency ranks the paths of recorded runs by how often and how recently
+// they ran, best first. Each run counts less the older it is.
+func Frecency(entries []Entry, now time.Time) []string {
+	scores := make(map[string]int)
+	lastRun := make(map[string]time.Time)
+	for _, e := range entries {
+		if e.Path == "" {
+			continue
+		}
+		scores[e.Path] += recencyWeight(now.Sub(e.Time))
+		if e.Time.After(lastRun[e.Path]) {
+			lastRun[e.Path] = e.Time
+		}
+	}
+
+	paths := make([]string, 0, len(scores))
+	for path := range scores {
+		paths = append(paths, path)
+	}
+	slices.SortFunc(paths, func(a, b string) int {
+		if scores[a] != scores[b] {
+			return scores[b] - scores[a]
+		}
+		return lastRun[b].Compare(lastRun[a])
+	})
+	return paths
+}
+
+// recencyWeight is the score of a single run that happened age ago
+func recencyWeight(age time.Duration) int {
+	switch {
+	case age < 4*time.Hour:
+		return 100
+	case age < 24*time.Hour:
+		return 80
+	case age < 7*24*time.Hour:
+		return 60
+	case age < 30*24*time.Hour:
+		return 40
+	case age < 90*24*time.Hour:
+		return 20
+	default:
+		return 10
+	}
+}
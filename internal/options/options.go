@@ -0,0 +1,212 @@
+// Package options loads the options of variables from the output of shell
+// commands, as configured with options_from.
+package options
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmy/iz/internal/config"
+)
+
+// timeout limits how long an options command may run
+const timeout = 10 * time.Second
+
+// cached are loaded options that are reused until they expire
+type cached struct {
+	options []config.VariableOption
+	expires time.Time
+}
+
+var (
+	cacheMu sync.Mutex
+	cache   = make(map[config.OptionsSource]cached)
+)
+
+// Load runs the command of src and turns its output into options. Options
+// are served from memory while the cache duration of src has not passed.
+func Load(src config.OptionsSource) ([]config.VariableOption, error) {
+	cacheMu.Lock()
+	c, ok := cache[src]
+	cacheMu.Unlock()
+	if ok && time.Now().Before(c.expires) {
+		return c.options, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", src.Command)
+	// Commands started by the shell may hold on to its output after it was
+	// killed, Output gives up waiting for them
+	killGroupOnCancel(cmd)
+	cmd.WaitDelay = time.Second
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("%s timed out after %v", src.Command, timeout)
+	}
+	if err != nil {
+		if line, _, _ := strings.Cut(strings.TrimSpace(stderr.String()), "\n"); line != "" {
+			return nil, fmt.Errorf("%v: %s", err, line)
+		}
+		return nil, err
+	}
+
+	options, err := Parse(src, out)
+	if err != nil {
+		return nil, err
+	}
+	if d := src.CacheFor(); d > 0 {
+		cacheMu.Lock()
+		cache[src] = cached{options: options, expires: time.Now().Add(d)}
+		cacheMu.Unlock()
+	}
+	return options, nil
+}
+
+// Parse turns the output of an options command into options according to
+// the format of src
+func Parse(src config.OptionsSource, out []byte) ([]config.VariableOption, error) {
+	switch src.Kind() {
+	case config.FormatJSON:
+		return parseJSON(src, out)
+	case config.FormatTSV:
+		return parseTSV(src, out), nil
+	default:
+		var options []config.VariableOption
+		for _, line := range lines(out) {
+			options = append(options, config.VariableOption{Label: strings.TrimSpace(line), Value: strings.TrimSpace(line)})
+		}
+		return options, nil
+	}
+}
+
+// parseTSV reads one option per line, taking the label and value from the
+// configured columns, by default the first
+func parseTSV(src config.OptionsSource, out []byte) []config.VariableOption {
+	valueColumn := max(config.Column(src.ValueField), 0)
+	labelColumn := valueColumn
+	if src.LabelField != "" {
+		labelColumn = max(config.Column(src.LabelField), 0)
+	}
+
+	var options []config.VariableOption
+	for _, line := range lines(out) {
+		columns := strings.Split(line, "\t")
+		if valueColumn >= len(columns) {
+			continue
+		}
+		option := config.VariableOption{Label: columns[valueColumn], Value: strings.TrimSpace(columns[valueColumn])}
+		if labelColumn < len(columns) {
+			option.Label = columns[labelColumn]
+		}
+		options = append(options, option)
+	}
+	return options
+}
+
+// parseJSON reads an array of values, one value per line, or an object with
+// an items array as printed by kubectl
+func parseJSON(src config.OptionsSource, out []byte) ([]config.VariableOption, error) {
+	var items []any
+	decoder := json.NewDecoder(bytes.NewReader(out))
+	decoder.UseNumber()
+	for {
+		var v any
+		err := decoder.Decode(&v)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read options: %v", err)
+		}
+		switch v := v.(type) {
+		case []any:
+			items = append(items, v...)
+		case map[string]any:
+			if list, ok := v["items"].([]any); ok {
+				items = append(items, list...)
+			} else {
+				items = append(items, v)
+			}
+		default:
+			items = append(items, v)
+		}
+	}
+
+	var options []config.VariableOption
+	for _, item := range items {
+		value, ok := field(item, src.ValueField)
+		if !ok || value == "" {
+			continue
+		}
+		label := value
+		if src.LabelField != "" {
+			if l, ok := field(item, src.LabelField); ok {
+				label = l
+			}
+		}
+		options = append(options, config.VariableOption{Label: label, Value: value})
+	}
+	return options, nil
+}
+
+// field returns the value at a dotted path such as metadata.name as text.
+// An empty path yields v itself.
+func field(v any, path string) (string, bool) {
+	if path != "" {
+		for _, key := range strings.Split(path, ".") {
+			switch container := v.(type) {
+			case map[string]any:
+				var ok bool
+				if v, ok = container[key]; !ok {
+					return "", false
+				}
+			case []any:
+				i, err := strconv.Atoi(key)
+				if err != nil || i < 0 || i >= len(container) {
+					return "", false
+				}
+				v = container[i]
+			default:
+				return "", false
+			}
+		}
+	}
+
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		return strconv.FormatBool(v), true
+	case nil, map[string]any, []any:
+		return "", false
+	}
+	return fmt.Sprint(v), true
+}
+
+// lines returns the non-empty lines of out
+func lines(out []byte) []string {
+	var result []string
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if line := strings.TrimRight(scanner.Text(), "\r"); strings.TrimSpace(line) != "" {
+			result = append(result, line)
+		}
+	}
+	return result
+}
@@ -0,0 +1,136 @@
+package options
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/charmy/iz/internal/config"
+)
+
+// opts builds options from label, value pairs
+func opts(pairs ...string) []config.VariableOption {
+	var options []config.VariableOption
+	for i := 0; i+1 < len(pairs); i += 2 {
+		options = append(options, config.VariableOption{Label: pairs[i], Value: pairs[i+1]})
+	}
+	return options
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		src  config.OptionsSource
+		out  string
+		want []config.VariableOption
+	}{
+		{
+			name: "lines",
+			out:  "a\n  b  \n\n\r\nc\r\n",
+			want: opts("a", "a", "b", "b", "c", "c"),
+		},
+		{
+			name: "no output",
+			out:  "",
+		},
+		{
+			name: "tsv first column",
+			src:  config.OptionsSource{Format: config.FormatTSV},
+			out:  "db1\tprimary\ndb2\treplica\n",
+			want: opts("db1", "db1", "db2", "db2"),
+		},
+		{
+			name: "tsv columns",
+			src:  config.OptionsSource{Format: config.FormatTSV, LabelField: "2", ValueField: "1"},
+			out:  "db1\tprimary\ndb2\n",
+			want: opts("primary", "db1", "db2", "db2"),
+		},
+		{
+			name: "tsv missing value column",
+			src:  config.OptionsSource{Format: config.FormatTSV, ValueField: "3"},
+			out:  "db1\tprimary\n",
+		},
+		{
+			name: "json array",
+			src:  config.OptionsSource{Format: config.FormatJSON},
+			out:  `["a", 2, true, null, ""]`,
+			want: opts("a", "a", "2", "2", "true", "true"),
+		},
+		{
+			name: "json lines",
+			src:  config.OptionsSource{Format: config.FormatJSON, ValueField: "id", LabelField: "name"},
+			out:  "{\"id\": 1, \"name\": \"one\"}\n{\"id\": 2}\n{\"name\": \"none\"}\n",
+			want: opts("one", "1", "2", "2"),
+		},
+		{
+			name: "json items",
+			src:  config.OptionsSource{Format: config.FormatJSON, ValueField: "metadata.name"},
+			out:  `{"items": [{"metadata": {"name": "web"}}, {"metadata": {"name": "api"}}]}`,
+			want: opts("web", "web", "api", "api"),
+		},
+		{
+			name: "json index",
+			src:  config.OptionsSource{Format: config.FormatJSON, ValueField: "ports.0"},
+			out:  `[{"ports": [80, 443]}, {"ports": []}]`,
+			want: opts("80", "80"),
+		},
+		{
+			name: "json large number",
+			src:  config.OptionsSource{Format: config.FormatJSON},
+			out:  `[12345678901234567890]`,
+			want: opts("12345678901234567890", "12345678901234567890"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.src, []byte(tt.out))
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseInvalidJSON(t *testing.T) {
+	src := config.OptionsSource{Format: config.FormatJSON}
+	if options, err := Parse(src, []byte(`["a", `)); err == nil {
+		t.Errorf("Parse() = %v, want an error", options)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	options, err := Load(config.OptionsSource{Command: "printf 'a\\nb\\n'"})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if want := opts("a", "a", "b", "b"); !reflect.DeepEqual(options, want) {
+		t.Errorf("Load() = %v, want %v", options, want)
+	}
+
+	_, err = Load(config.OptionsSource{Command: "echo first >&2; echo second >&2; exit 3"})
+	if err == nil || !strings.HasSuffix(err.Error(), ": first") {
+		t.Errorf("Load() error = %v, want the first line of stderr", err)
+	}
+}
+
+func TestLoadCache(t *testing.T) {
+	runs := filepath.Join(t.TempDir(), "runs")
+	src := config.OptionsSource{Command: "echo run >> " + runs + "; echo a", Cache: "1m"}
+	for range 2 {
+		if _, err := Load(src); err != nil {
+			t.Fatalf("Load: %v", err)
+		}
+	}
+	data, err := os.ReadFile(runs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), "run"); n != 1 {
+		t.Errorf("command ran %d times, want once", n)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build windows
+
+package options
+
+import "os/exec"
+
+// killGroupOnCancel keeps the default of killing only the process itself on Windows
+func killGroupOnCancel(cmd *exec.Cmd) {}
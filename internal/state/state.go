@@ -0,0 +1,151 @@
+// Package state persists what iz remembers between sessions, such as which
+// folders were open. Nodes are identified by their slash separated tree path.
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// maxValues limits how many values are remembered per variable
+const maxValues = 10
+
+// State is the content of the state file
+type State struct {
+	// Expanded records for every folder whether it was open
+	Expanded map[string]bool `json:"expanded,omitempty"`
+	// Selected is the path of the node under the cursor
+	Selected string `json:"selected,omitempty"`
+	// Filter is the query of the filter that was active on exit
+	Filter string `json:"filter,omitempty"`
+	// Favorites are the paths of starred commands, in the order they were starred
+	Favorites []string `json:"favorites,omitempty"`
+
+	// Values holds the recently used variable values of each command,
+	// most recent first
+	Values map[string]map[string][]string `json:"values,omitempty"`
+	// Globals holds the recently used values of top-level variables,
+	// shared by all commands
+	Globals map[string][]string `json:"globals,omitempty"`
+
+	path string
+}
+
+// GetStateDir returns the directory holding state files,
+// $XDG_STATE_HOME/iz or ~/.local/state/iz
+func GetStateDir() (string, error) {
+	if xdgState := os.Getenv("XDG_STATE_HOME"); xdgState != "" {
+		return filepath.Join(xdgState, "iz"), nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("could not get user home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".local", "state", "iz"), nil
+}
+
+// Load reads the state file. A missing file yields an empty state.
+func Load() (*State, error) {
+	dir, err := GetStateDir()
+	if err != nil {
+		return &State{}, err
+	}
+	s := &State{path: filepath.Join(dir, "state.json")}
+
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return s, fmt.Errorf("could not read state file: %w", err)
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return s, fmt.Errorf("%s: %w", s.path, err)
+	}
+	return s, nil
+}
+
+// Save writes the state file, creating its directory when needed
+func (s *State) Save() error {
+	if s.path == "" {
+		dir, err := GetStateDir()
+		if err != nil {
+			return err
+		}
+		s.path = filepath.Join(dir, "state.json")
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("could not create state directory: %w", err)
+	}
+
+	// Replace the file atomically so a crash never leaves it half written
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("could not write state file: %w", err)
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// IsFavorite reports whether the command at path is starred
+func (s *State) IsFavorite(path string) bool {
+	return slices.Contains(s.Favorites, path)
+}
+
+// ToggleFavorite stars or unstars the command at path and reports whether it is starred now
+func (s *State) ToggleFavorite(path string) bool {
+	if i := slices.Index(s.Favorites, path); i >= 0 {
+		s.Favorites = slices.Delete(s.Favorites, i, i+1)
+		return false
+	}
+	s.Favorites = append(s.Favorites, path)
+	return true
+}
+
+// RecentValues returns the values recently used for a variable of a command,
+// most recent first. Global variables fall back to the values used by any command.
+func (s *State) RecentValues(command, variable string, global bool) []string {
+	if values := s.Values[command][variable]; len(values) > 0 {
+		return values
+	}
+	if global {
+		return s.Globals[variable]
+	}
+	return nil
+}
+
+// RememberValue records value as the most recently used one of a variable
+func (s *State) RememberValue(command, variable, value string, global bool) {
+	if s.Values == nil {
+		s.Values = make(map[string]map[string][]string)
+	}
+	if s.Values[command] == nil {
+		s.Values[command] = make(map[string][]string)
+	}
+	s.Values[command][variable] = prepend(s.Values[command][variable], value)
+
+	if global {
+		if s.Globals == nil {
+			s.Globals = make(map[string][]string)
+		}
+		s.Globals[variable] = prepend(s.Globals[variable], value)
+	}
+}
+
+// prepend moves value to the front of values, keeping at most maxValues
+func prepend(values []string, value string) []string {
+	result := []string{value}
+	for _, v := range values {
+		if v != value && len(result) < maxValues {
+			result = append(result, v)
+		}
+	}
+	return result
+}
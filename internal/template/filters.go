@@ -0,0 +1,65 @@
+package template
+
+import (
+	"regexp"
+	"strings"
+)
+
+// filters maps filter names to their implementation; arg is the text after the colon
+var filters = map[string]func(value, arg string) string{
+	"upper": func(value, arg string) string { return strings.ToUpper(value) },
+	"lower": func(value, arg string) string { return strings.ToLower(value) },
+	"trim":  func(value, arg string) string { return strings.TrimSpace(value) },
+	"quote": func(value, arg string) string { return ShellQuote(value) },
+	"join": func(value, arg string) string {
+		return strings.Join(SplitList(value), arg)
+	},
+}
+
+// SplitList splits a list value on newlines, commas and whitespace
+func SplitList(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	})
+}
+
+// safeShellWord matches values that never need quoting in a POSIX shell. A
+// leading = is quoted, zsh expands =cmd to the path of cmd.
+var safeShellWord = regexp.MustCompile(`^[A-Za-z0-9@%+:,./_-][A-Za-z0-9@%+=:,./_-]*$`)
+
+// ShellQuote quotes s so that a POSIX shell reads it back as a single word
+func ShellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	if safeShellWord.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
+
+// safeFishWord matches values that never need quoting in fish
+var safeFishWord = regexp.MustCompile(`^[A-Za-z0-9@+=:,./_-]+$`)
+
+// FishQuote quotes s so that fish reads it back as a single word. Unlike a
+// POSIX shell, fish treats a backslash before a quote or another backslash as
+// an escape even inside single quotes.
+func FishQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	if safeFishWord.MatchString(s) {
+		return s
+	}
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return "'" + strings.ReplaceAll(s, "'", `\'`) + "'"
+}
+
+// QuoteFor returns the function quoting values for shell. Every shell but
+// fish reads POSIX quoting.
+func QuoteFor(shell string) func(string) string {
+	if shell == "fish" {
+		return FishQuote
+	}
+	return ShellQuote
+}
@@ -0,0 +1,75 @@
+package template
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", "''"},
+		{"db1.example.com", "db1.example.com"},
+		{"user@host:/tmp/a_b-c", "user@host:/tmp/a_b-c"},
+		{"key=value", "key=value"},
+		{"=ls", "'=ls'"},
+		{"a b", "'a b'"},
+		{"$HOME", "'$HOME'"},
+		{"it's", `'it'"'"'s'`},
+		{`a\b`, `'a\b'`},
+		{"; rm -rf ~", "'; rm -rf ~'"},
+	}
+	for _, tt := range tests {
+		if got := ShellQuote(tt.in); got != tt.want {
+			t.Errorf("ShellQuote(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFishQuote(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", "''"},
+		{"db1.example.com", "db1.example.com"},
+		{"50%", "'50%'"},
+		{"a b", "'a b'"},
+		{"it's", `'it\'s'`},
+		{`a\`, `'a\\'`},
+		{`a\' ; rm -rf ~ #`, `'a\\\' ; rm -rf ~ #'`},
+	}
+	for _, tt := range tests {
+		if got := FishQuote(tt.in); got != tt.want {
+			t.Errorf("FishQuote(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestQuoteFor(t *testing.T) {
+	for _, shell := range []string{"", "sh", "bash", "zsh"} {
+		if got := QuoteFor(shell)("it's"); got != ShellQuote("it's") {
+			t.Errorf("QuoteFor(%q) quotes like %q, want POSIX quoting", shell, got)
+		}
+	}
+	if got := QuoteFor("fish")("it's"); got != FishQuote("it's") {
+		t.Errorf(`QuoteFor("fish") quotes like %q, want fish quoting`, got)
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"a", []string{"a"}},
+		{"a,b c", []string{"a", "b", "c"}},
+		{" a ,, b\r\n\tc ", []string{"a", "b", "c"}},
+	}
+	for _, tt := range tests {
+		if got := SplitList(tt.in); !slices.Equal(got, tt.want) {
+			t.Errorf("SplitList(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
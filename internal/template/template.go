@@ -0,0 +1,274 @@
+// Package template implements the placeholder syntax used in commands.
+//
+// Templates are parsed in a single pass and rendered deterministically:
+//
+//	{name}            value of the variable
+//	{name:-default}   value, or default when the value is empty
+//	{name|upper}      value passed through one or more filters
+//	{?-p {port}}      optional segment, dropped when a variable inside is empty
+//	\{ and \}         literal braces
+//
+// A brace that does not start a valid placeholder is kept literally, so shell
+// snippets like awk '{print $1}' or find -exec {} \; need no escaping.
+package template
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// QuoteFunc prepares a rendered value for insertion into the output.
+// It is not called for values that were already quoted with the quote filter.
+type QuoteFunc func(name, value string) (string, error)
+
+// Verbatim is a QuoteFunc that inserts values unchanged
+func Verbatim(name, value string) (string, error) {
+	return value, nil
+}
+
+// Template is a parsed command template
+type Template struct {
+	nodes []node
+}
+
+type node interface{}
+
+type textNode string
+
+type varNode struct {
+	name       string
+	def        string
+	hasDefault bool
+	filters    []filterCall
+}
+
+type optionalNode struct {
+	nodes []node
+}
+
+type filterCall struct {
+	name string
+	arg  string
+}
+
+// Parse parses s. Malformed placeholders are treated as literal text;
+// an error is only returned for unknown filters.
+func Parse(s string) (*Template, error) {
+	p := &parser{src: s}
+	nodes, _, err := p.parse(false)
+	if err != nil {
+		return nil, err
+	}
+	return &Template{nodes: nodes}, nil
+}
+
+type parser struct {
+	src string
+	pos int
+}
+
+// parse reads nodes until the end of input or, inside an optional segment,
+// the closing brace. closed reports whether that closing brace was found.
+func (p *parser) parse(nested bool) (nodes []node, closed bool, err error) {
+	var text strings.Builder
+
+	flush := func() {
+		if text.Len() > 0 {
+			nodes = append(nodes, textNode(text.String()))
+			text.Reset()
+		}
+	}
+
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case c == '\\' && p.pos+1 < len(p.src) && (p.src[p.pos+1] == '{' || p.src[p.pos+1] == '}'):
+			text.WriteByte(p.src[p.pos+1])
+			p.pos += 2
+		case c == '}' && nested:
+			p.pos++
+			flush()
+			return nodes, true, nil
+		case c == '{' && strings.HasPrefix(p.src[p.pos:], "{?"):
+			start := p.pos
+			p.pos += 2
+			inner, ok, err := p.parse(true)
+			if err != nil {
+				return nil, false, err
+			}
+			if !ok {
+				// Unterminated optional segment, keep it literally
+				p.pos = start + 1
+				text.WriteByte('{')
+				continue
+			}
+			flush()
+			nodes = append(nodes, optionalNode{nodes: inner})
+		case c == '{':
+			v, n, err := parsePlaceholder(p.src[p.pos:])
+			if err != nil {
+				return nil, false, err
+			}
+			if n == 0 {
+				text.WriteByte(c)
+				p.pos++
+				continue
+			}
+			flush()
+			nodes = append(nodes, v)
+			p.pos += n
+		default:
+			text.WriteByte(c)
+			p.pos++
+		}
+	}
+
+	flush()
+	return nodes, !nested, nil
+}
+
+var placeholderPattern = regexp.MustCompile(`^\{([A-Za-z_][\w-]*)(:-[^|}]*)?((?:\|[a-z]+(?::[^|}]*)?)*)\}`)
+
+// parsePlaceholder parses a placeholder at the start of s and returns it with
+// its length, or a zero length if s does not start with a valid placeholder
+func parsePlaceholder(s string) (varNode, int, error) {
+	m := placeholderPattern.FindStringSubmatch(s)
+	if m == nil {
+		return varNode{}, 0, nil
+	}
+
+	v := varNode{name: m[1]}
+	if m[2] != "" {
+		v.def = m[2][2:]
+		v.hasDefault = true
+	}
+	if m[3] != "" {
+		for _, f := range strings.Split(m[3][1:], "|") {
+			name, arg, _ := strings.Cut(f, ":")
+			if _, ok := filters[name]; !ok {
+				return varNode{}, 0, fmt.Errorf("unknown filter %q in {%s}", name, m[0][1:len(m[0])-1])
+			}
+			v.filters = append(v.filters, filterCall{name: name, arg: arg})
+		}
+	}
+	return v, len(m[0]), nil
+}
+
+// Variables returns the names of all referenced variables in order of first appearance
+func (t *Template) Variables() []string {
+	var names []string
+	seen := make(map[string]bool)
+	walk(t.nodes, false, func(v varNode, optional bool) {
+		if !seen[v.name] {
+			seen[v.name] = true
+			names = append(names, v.name)
+		}
+	})
+	return names
+}
+
+// Default returns the inline default of a variable, e.g. 4 for {count:-4}
+func (t *Template) Default(name string) (string, bool) {
+	def, found := "", false
+	walk(t.nodes, false, func(v varNode, optional bool) {
+		if v.name == name && v.hasDefault && !found {
+			def, found = v.def, true
+		}
+	})
+	return def, found
+}
+
+// Optional reports whether a variable may be left empty: every reference to it
+// either has an inline default or sits inside an optional segment
+func (t *Template) Optional(name string) bool {
+	optionalEverywhere := true
+	walk(t.nodes, false, func(v varNode, optional bool) {
+		if v.name == name && !optional && !v.hasDefault {
+			optionalEverywhere = false
+		}
+	})
+	return optionalEverywhere
+}
+
+// HasOptional reports whether the template contains an optional segment
+func (t *Template) HasOptional() bool {
+	for _, n := range t.nodes {
+		if _, ok := n.(optionalNode); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func walk(nodes []node, optional bool, fn func(v varNode, optional bool)) {
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case varNode:
+			fn(n, optional)
+		case optionalNode:
+			walk(n.nodes, true, fn)
+		}
+	}
+}
+
+// Render expands the template with values. quote is applied to every value
+// after its filters unless the quote filter was used explicitly.
+func (t *Template) Render(values map[string]string, quote QuoteFunc) (string, error) {
+	return t.RenderFor("", values, quote)
+}
+
+// RenderFor is Render for a command run by shell: the quote filter quotes
+// values the way that shell reads them back, see QuoteFor
+func (t *Template) RenderFor(shell string, values map[string]string, quote QuoteFunc) (string, error) {
+	var b strings.Builder
+	if _, err := render(&b, t.nodes, values, quote, QuoteFor(shell)); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// render writes nodes to b and reports whether every variable had a non-empty value
+func render(b *strings.Builder, nodes []node, values map[string]string, quote QuoteFunc, shellQuote func(string) string) (bool, error) {
+	complete := true
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case textNode:
+			b.WriteString(string(n))
+		case varNode:
+			value := values[n.name]
+			if value == "" && n.hasDefault {
+				value = n.def
+			}
+			if value == "" {
+				complete = false
+			}
+
+			quoted := false
+			for _, f := range n.filters {
+				if f.name == "quote" {
+					value, quoted = shellQuote(value), true
+					continue
+				}
+				value = filters[f.name](value, f.arg)
+			}
+			if !quoted {
+				var err error
+				if value, err = quote(n.name, value); err != nil {
+					return false, err
+				}
+			}
+			b.WriteString(value)
+		case optionalNode:
+			var segment strings.Builder
+			ok, err := render(&segment, n.nodes, values, quote, shellQuote)
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				b.WriteString(segment.String())
+			}
+		}
+	}
+	return complete, nil
+}
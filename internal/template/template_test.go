@@ -0,0 +1,152 @@
+package template
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		values   map[string]string
+		want     string
+	}{
+		{"plain text", "echo hello", nil, "echo hello"},
+		{"variable", "ping {host}", map[string]string{"host": "db1"}, "ping db1"},
+		{"missing variable", "ping {host}", nil, "ping "},
+		{"default", "ping -c {count:-4}", nil, "ping -c 4"},
+		{"default overridden", "ping -c {count:-4}", map[string]string{"count": "2"}, "ping -c 2"},
+		{"filters", "{name|trim|upper}", map[string]string{"name": " ab "}, "AB"},
+		{"join", "{list|join:,}", map[string]string{"list": "a b\nc,d"}, "a,b,c,d"},
+		{"quote filter", "echo {msg|quote}", map[string]string{"msg": "a b"}, "echo 'a b'"},
+		{"optional dropped", "ping{? -c {count}} {host}", map[string]string{"host": "h"}, "ping h"},
+		{"optional kept", "ping{? -c {count}} {host}", map[string]string{"host": "h", "count": "3"}, "ping -c 3 h"},
+		{"optional with default", "ls{? -l {long:-yes}}", nil, "ls -l yes"},
+		{"escaped braces", `echo \{host\}`, map[string]string{"host": "h"}, "echo {host}"},
+		{"shell braces", `awk '{print $1}'`, nil, `awk '{print $1}'`},
+		{"find exec", `find . -exec rm {} \;`, nil, `find . -exec rm {} \;`},
+		{"unterminated optional", "echo {? {x}", map[string]string{"x": "1"}, "echo {? 1"},
+		{"single pass", "echo {a}", map[string]string{"a": "{b}", "b": "x"}, "echo {b}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := Parse(tt.template)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.template, err)
+			}
+			got, err := tmpl.Render(tt.values, Verbatim)
+			if err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Render(%q) = %q, want %q", tt.template, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseUnknownFilter(t *testing.T) {
+	if _, err := Parse("echo {name|shout}"); err == nil {
+		t.Fatal("Parse accepted an unknown filter")
+	}
+}
+
+func TestRenderQuote(t *testing.T) {
+	bracket := func(name, value string) (string, error) { return "[" + value + "]", nil }
+	tests := []struct {
+		name     string
+		shell    string
+		template string
+		values   map[string]string
+		want     string
+	}{
+		{"quote func", "", "echo {a} {b}", map[string]string{"a": "1", "b": "2"}, "echo [1] [2]"},
+		{"quote filter skips quote func", "", "echo {a|quote}", map[string]string{"a": "x y"}, "echo 'x y'"},
+		{"posix", "bash", "echo {a|quote}", map[string]string{"a": "it's"}, `echo 'it'"'"'s'`},
+		{"fish", "fish", "echo {a|quote}", map[string]string{"a": "it's"}, `echo 'it\'s'`},
+		{"fish backslash", "fish", "echo {a|quote}", map[string]string{"a": `a\`}, `echo 'a\\'`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := Parse(tt.template)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.template, err)
+			}
+			got, err := tmpl.RenderFor(tt.shell, tt.values, bracket)
+			if err != nil {
+				t.Fatalf("RenderFor: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("RenderFor(%q, %q) = %q, want %q", tt.shell, tt.template, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderQuoteError(t *testing.T) {
+	refuse := errors.New("refused")
+	tmpl, err := Parse("echo {a}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tmpl.Render(map[string]string{"a": "x"}, func(name, value string) (string, error) {
+		return "", refuse
+	})
+	if !errors.Is(err, refuse) {
+		t.Errorf("Render error = %v, want %v", err, refuse)
+	}
+}
+
+func TestVariables(t *testing.T) {
+	tests := []struct {
+		template string
+		want     []string
+		optional []string
+	}{
+		{"echo hello", nil, nil},
+		{"{a} {b} {a}", []string{"a", "b"}, nil},
+		{"ping{? -c {count}} {host}", []string{"count", "host"}, []string{"count"}},
+		{"{x:-1} {y}", []string{"x", "y"}, []string{"x"}},
+		{"{x} {?{x}}", []string{"x"}, nil},
+		{`\{a\} '{print $1}'`, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			tmpl, err := Parse(tt.template)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.template, err)
+			}
+			if got := tmpl.Variables(); !slices.Equal(got, tt.want) {
+				t.Errorf("Variables() = %q, want %q", got, tt.want)
+			}
+			var optional []string
+			for _, name := range tmpl.Variables() {
+				if tmpl.Optional(name) {
+					optional = append(optional, name)
+				}
+			}
+			if !slices.Equal(optional, tt.optional) {
+				t.Errorf("optional variables = %q, want %q", optional, tt.optional)
+			}
+			if got, want := tmpl.HasOptional(), strings.Contains(tt.template, "{?"); got != want {
+				t.Errorf("HasOptional() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestDefault(t *testing.T) {
+	tmpl, err := Parse("{count:-4} {count:-5} {host}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if def, ok := tmpl.Default("count"); !ok || def != "4" {
+		t.Errorf(`Default("count") = %q, %v, want "4", true`, def, ok)
+	}
+	if _, ok := tmpl.Default("host"); ok {
+		t.Error(`Default("host") found a default`)
+	}
+}
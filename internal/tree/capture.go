@@ -0,0 +1,154 @@
+package tree
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Capture is a command running as a child process whose output is streamed
+// back to the UI line by line instead of being written to the terminal
+type Capture struct {
+	Command string
+	Started time.Time
+
+	cmd  *exec.Cmd
+	msgs chan tea.Msg
+}
+
+// OutputLineMsg carries a single line of captured output
+type OutputLineMsg struct {
+	Capture *Capture
+	Line    string
+	Stderr  bool
+}
+
+// maxLineLength is the length from which captured lines are broken up
+const maxLineLength = 1024 * 1024
+
+// captureWaitDelay is how long the output of processes the command started
+// in the background is still read once the command exited
+const captureWaitDelay = time.Second
+
+// StartCapture starts the command with stdout and stderr captured.
+// Use Wait to receive the resulting OutputLineMsg and CommandFinishedMsg messages.
+func StartCapture(spec RunSpec) (*Capture, error) {
+	cmd := spec.cmd()
+	setProcessGroup(cmd)
+	stdout, stdoutWriter := io.Pipe()
+	stderr, stderrWriter := io.Pipe()
+	cmd.Stdout, cmd.Stderr = stdoutWriter, stderrWriter
+	cmd.WaitDelay = captureWaitDelay
+
+	c := &Capture{
+		Command: spec.String(),
+		Started: time.Now(),
+		cmd:     cmd,
+		msgs:    make(chan tea.Msg, 256),
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	stop := spec.watchTimeout(func() { _ = signalProcessGroup(cmd, syscall.SIGKILL) })
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go c.scan(stdout, false, &wg)
+	go c.scan(stderr, true, &wg)
+
+	go func() {
+		// Wait returns once the output is copied to the pipes, or shortly
+		// after the command exited when a background process keeps it open
+		err := cmd.Wait()
+		if errors.Is(err, exec.ErrWaitDelay) {
+			err = nil
+		}
+		exitCode, err := exitStatus(err)
+		err = stop(err)
+		_ = stdoutWriter.Close()
+		_ = stderrWriter.Close()
+		wg.Wait()
+		c.msgs <- CommandFinishedMsg{
+			Command:  c.Command,
+			ExitCode: exitCode,
+			Started:  c.Started,
+			Finished: time.Now(),
+			Err:      err,
+			Capture:  c,
+		}
+		close(c.msgs)
+	}()
+
+	return c, nil
+}
+
+func (c *Capture) scan(r io.Reader, isStderr bool, wg *sync.WaitGroup) {
+	defer wg.Done()
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineLength)
+	scanner.Split(scanLines)
+	for scanner.Scan() {
+		c.msgs <- OutputLineMsg{Capture: c, Line: scanner.Text(), Stderr: isStderr}
+	}
+	// The command must not block writing to a pipe nobody reads
+	_, _ = io.Copy(io.Discard, r)
+}
+
+// scanLines splits like bufio.ScanLines, breaking lines longer than
+// maxLineLength without splitting a UTF-8 character
+func scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	advance, token, err = bufio.ScanLines(data, atEOF)
+	if advance > 0 || err != nil || len(data) < maxLineLength {
+		return advance, token, err
+	}
+	n := len(data)
+	for i := n - 1; i >= 0 && i >= n-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) && i > 0 {
+				n = i
+			}
+			break
+		}
+	}
+	return n, data[:n], nil
+}
+
+// Wait returns a command that delivers the next message from the capture.
+// It has to be called again after every OutputLineMsg to keep the stream flowing.
+func (c *Capture) Wait() tea.Cmd {
+	return func() tea.Msg {
+		msg, ok := <-c.msgs
+		if !ok {
+			return nil
+		}
+		return msg
+	}
+}
+
+// Stop kills the captured process and everything it started
+func (c *Capture) Stop() error {
+	return c.Signal(syscall.SIGKILL)
+}
+
+// Signal sends sig to the captured process and everything it started
+func (c *Capture) Signal(sig syscall.Signal) error {
+	if c.cmd.Process == nil {
+		return nil
+	}
+	return signalProcessGroup(c.cmd, sig)
+}
+
+// Pid returns the process id of the captured command
+func (c *Capture) Pid() int {
+	if c.cmd.Process == nil {
+		return 0
+	}
+	return c.cmd.Process.Pid
+}
@@ -0,0 +1,75 @@
+package tree
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// captureAll runs command and returns its captured lines and result
+func captureAll(t *testing.T, command string) ([]string, CommandFinishedMsg) {
+	t.Helper()
+	c, err := StartCapture(RunSpec{Command: command})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	done := make(chan CommandFinishedMsg)
+	var lines []string
+	go func() {
+		for {
+			switch msg := c.Wait()().(type) {
+			case OutputLineMsg:
+				lines = append(lines, msg.Line)
+			case CommandFinishedMsg:
+				done <- msg
+				return
+			}
+		}
+	}()
+	select {
+	case result := <-done:
+		return lines, result
+	case <-time.After(10 * time.Second):
+		t.Fatalf("capturing %q did not finish", command)
+		return nil, CommandFinishedMsg{}
+	}
+}
+
+func TestCaptureLongLine(t *testing.T) {
+	lines, result := captureAll(t, "head -c 2500000 /dev/zero | tr '\\0' a; echo; echo done; exit 3")
+	if result.ExitCode != 3 || result.Err != nil {
+		t.Errorf("result = %d, %v, want exit code 3", result.ExitCode, result.Err)
+	}
+	if len(lines) != 4 || lines[3] != "done" {
+		t.Fatalf("got %d lines ending with %q, want the long line in 3 and done", len(lines), lines[len(lines)-1])
+	}
+	if got := strings.Join(lines[:3], ""); got != strings.Repeat("a", 2500000) {
+		t.Errorf("long line has %d characters, want 2500000", len(got))
+	}
+}
+
+func TestCaptureBackgroundProcess(t *testing.T) {
+	// The background sleep keeps stdout open after the command exited
+	started := time.Now()
+	lines, result := captureAll(t, "sleep 30 & echo started")
+	if result.ExitCode != 0 || result.Err != nil {
+		t.Errorf("result = %d, %v, want exit code 0", result.ExitCode, result.Err)
+	}
+	if len(lines) != 1 || lines[0] != "started" {
+		t.Errorf("lines = %q, want started", lines)
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("capture took %v", elapsed)
+	}
+}
+
+func TestScanLines(t *testing.T) {
+	// The buffer is full in the middle of the last character
+	data := []byte(strings.Repeat("a", maxLineLength-1) + "é")[:maxLineLength]
+	advance, token, err := scanLines(data, false)
+	if err != nil || advance != maxLineLength-1 || string(token) != string(data[:maxLineLength-1]) {
+		t.Errorf("scanLines() = %d, %d bytes, %v, want the line up to the split character", advance, len(token), err)
+	}
+}
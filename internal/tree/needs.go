@@ -0,0 +1,254 @@
+package tree
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/charmy/iz/internal/config"
+)
+
+// FindNeed returns the command that ref in the needs of node stands for: the
+// command with that id, else the one at that path relative to the folder of
+// node, else the one at that path from the top level
+func FindNeed(root, node *TreeNode, ref string) (*TreeNode, error) {
+	var found *TreeNode
+	Walk(root, func(n *TreeNode) {
+		if found == nil && !n.Shortcut && n.ID != "" && n.ID == ref {
+			found = n
+		}
+	})
+
+	if found == nil {
+		folder := ""
+		if i := strings.LastIndex(node.Path, "/"); i >= 0 {
+			folder = node.Path[:i]
+		}
+		var err error
+		if found, err = FindNode(root, JoinPath(folder, ref)); err != nil || found.Shortcut {
+			if found, err = FindNode(root, ref); err != nil {
+				return nil, fmt.Errorf("%q needs %q, which is neither an id nor a path", node.Path, ref)
+			}
+		}
+	}
+	if found.IsFolder || !found.Runnable() {
+		return nil, fmt.Errorf("%q needs %q, which is a folder", node.Path, found.Path)
+	}
+	return found, nil
+}
+
+// neededCommands returns the commands node needs, directly or through others,
+// each after the ones it needs and node last, together with the commands each
+// of them needs directly, by path
+func neededCommands(root, node *TreeNode) ([]*TreeNode, map[string][]*TreeNode, error) {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	marks := make(map[string]int)
+	needs := make(map[string][]*TreeNode)
+	var order []*TreeNode
+	var path []string
+
+	var visit func(n *TreeNode) error
+	visit = func(n *TreeNode) error {
+		switch marks[n.Path] {
+		case done:
+			return nil
+		case visiting:
+			return cycleError(append(path[slices.Index(path, n.Path):], n.Path))
+		}
+		marks[n.Path] = visiting
+		path = append(path, n.Path)
+		for _, ref := range n.Needs {
+			dep, err := FindNeed(root, n, ref)
+			if err != nil {
+				return err
+			}
+			if !slices.Contains(needs[n.Path], dep) {
+				needs[n.Path] = append(needs[n.Path], dep)
+			}
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		marks[n.Path] = done
+		order = append(order, n)
+		return nil
+	}
+
+	if err := visit(node); err != nil {
+		return nil, nil, err
+	}
+	return order, needs, nil
+}
+
+// cycleError lists the paths of commands that need each other, the first
+// one repeated at the end
+type cycleError []string
+
+func (e cycleError) Error() string {
+	return "commands need each other: " + strings.Join(e, " → ")
+}
+
+// key is the same for every command the cycle is found from
+func (e cycleError) key() string {
+	members := slices.Clone(e[:len(e)-1])
+	slices.Sort(members)
+	return strings.Join(members, "\n")
+}
+
+// PlanNeeds returns a node that runs node after the commands it needs, or node
+// itself when it needs none. The commands, or the steps of those that have
+// them, become steps that wait for the ones they need and run in parallel
+// otherwise. The variables of all of them are asked for once and shared.
+func PlanNeeds(root, node *TreeNode) (*TreeNode, error) {
+	if len(node.Needs) == 0 {
+		return node, nil
+	}
+	order, needs, err := neededCommands(root, node)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := *node
+	plan.Command, plan.Argv, plan.Env, plan.Stdin, plan.Steps = "", nil, nil, "", nil
+	// The variables of node come first, the others are taken from the
+	// first command defining them
+	plan.Variables = slices.Clone(node.Variables)
+	last := make(map[string]int)
+	for _, n := range order {
+		for _, v := range n.Variables {
+			if plan.Variable(v.Name) == nil {
+				plan.Variables = append(plan.Variables, v)
+			}
+		}
+
+		var after []int
+		for _, dep := range needs[n.Path] {
+			after = append(after, last[dep.Path])
+		}
+		if len(n.Steps) == 0 {
+			plan.Steps = append(plan.Steps, Step{Name: n.Path, Needs: after, Node: n})
+		} else {
+			first := len(plan.Steps)
+			for i, step := range n.Steps {
+				step.Name = n.Path + " › " + step.Name
+				step.Node = n
+				step.Needs = after
+				if i > 0 {
+					step.Needs = []int{first + i - 1}
+				}
+				plan.Steps = append(plan.Steps, step)
+			}
+		}
+		last[n.Path] = len(plan.Steps) - 1
+	}
+	return &plan, nil
+}
+
+// NeedsTree renders the commands node needs as a tree below it, e.g.
+//
+//	Deploy
+//	├─ Build
+//	└─ Migrate
+//
+// Commands needed more than once are expanded at their first appearance only.
+func NeedsTree(root, node *TreeNode) ([]string, error) {
+	if _, _, err := neededCommands(root, node); err != nil {
+		return nil, err
+	}
+
+	lines := []string{node.Path}
+	seen := make(map[string]bool)
+	var walk func(n *TreeNode, indent string)
+	walk = func(n *TreeNode, indent string) {
+		for i, ref := range n.Needs {
+			dep, _ := FindNeed(root, n, ref)
+			branch, next := "├─ ", "│  "
+			if i == len(n.Needs)-1 {
+				branch, next = "└─ ", "   "
+			}
+			if seen[dep.Path] && len(dep.Needs) > 0 {
+				lines = append(lines, indent+branch+dep.Path+" …")
+				continue
+			}
+			seen[dep.Path] = true
+			lines = append(lines, indent+branch+dep.Path)
+			walk(dep, indent+next)
+		}
+	}
+	walk(node, "")
+	return lines, nil
+}
+
+// CheckNeeds reports duplicate ids and needs that do not name a command or
+// form a cycle, at the line of the command they were found in
+func CheckNeeds(root *TreeNode) []config.Diagnostic {
+	var diagnostics []config.Diagnostic
+	report := func(n *TreeNode, format string, args ...any) {
+		diagnostics = append(diagnostics, config.Diagnostic{
+			File:     n.Source,
+			Line:     n.Line,
+			Severity: config.SeverityError,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	ids := make(map[string]*TreeNode)
+	reported := make(map[string]bool)
+	Walk(root, func(n *TreeNode) {
+		if n.Shortcut {
+			return
+		}
+		if n.ID != "" {
+			if other, ok := ids[n.ID]; ok {
+				report(n, "%q: id %q is already used by %q", n.Path, n.ID, other.Path)
+			}
+			ids[n.ID] = n
+		}
+		if len(n.Needs) == 0 {
+			return
+		}
+		if n.IsFolder {
+			report(n, "%q: needs only applies to commands, not folders", n.Path)
+			return
+		}
+		for _, ref := range n.Needs {
+			if _, err := FindNeed(root, n, ref); err != nil {
+				report(n, "%v", err)
+			}
+		}
+		// Every command on or before a cycle finds it, the first one reports it
+		var cycle cycleError
+		plan, err := PlanNeeds(root, n)
+		if errors.As(err, &cycle) && !reported[cycle.key()] {
+			reported[cycle.key()] = true
+			report(n, "%v", err)
+		}
+		if err == nil {
+			if missing := undefinedVariables(plan); len(missing) > 0 {
+				report(n, "%q uses %s without a matching variable definition", n.Name, strings.Join(missing, ", "))
+			}
+		}
+	})
+	return diagnostics
+}
+
+// undefinedVariables returns the placeholders of plan, as {name}, that none
+// of its commands defines a variable for
+func undefinedVariables(plan *TreeNode) []string {
+	names, err := plan.InputVariables()
+	if err != nil {
+		return nil
+	}
+	var missing []string
+	for _, name := range names {
+		if plan.Variable(name) == nil {
+			missing = append(missing, "{"+name+"}")
+		}
+	}
+	return missing
+}
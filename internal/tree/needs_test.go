@@ -0,0 +1,184 @@
+package tree
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/charmy/iz/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+const needsConfig = `
+commands:
+  - name: Build
+    id: build
+    command: make {target}
+    variables:
+      - name: target
+  - name: Deps
+    children:
+      - name: Migrate
+        needs: [build]
+        command: migrate
+      - name: Deploy
+        needs: [Migrate, build]
+        variables:
+          - name: env
+        steps:
+          - name: Push
+            command: push {env}
+          - name: Restart
+            command: restart
+  - name: Loop
+    children:
+      - name: A
+        needs: [B]
+        command: a
+      - name: B
+        needs: [C]
+        command: b
+      - name: C
+        needs: [A]
+        command: c
+  - name: Self
+    needs: [Self]
+    command: s
+  - name: Broken
+    needs: [nothing]
+    command: x
+  - name: Folder
+    needs: [Deps]
+    command: y
+`
+
+// buildTree builds the tree of a config given as YAML
+func buildTree(t *testing.T, source string) *TreeNode {
+	t.Helper()
+	var cfg config.Config
+	if err := yaml.Unmarshal([]byte(source), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	return BuildTreeFromConfig(&cfg)
+}
+
+func TestPlanNeeds(t *testing.T) {
+	tests := []struct {
+		path string
+		// steps are the steps of the plan as name <- indexes of the steps they wait for
+		steps     []string
+		variables []string
+		err       string
+	}{
+		{
+			path:      "Build",
+			variables: []string{"target"},
+		},
+		{
+			path:      "Deps/Migrate",
+			steps:     []string{"Build <- []", "Deps/Migrate <- [0]"},
+			variables: []string{"target"},
+		},
+		{
+			path: "Deps/Deploy",
+			steps: []string{
+				"Build <- []",
+				"Deps/Migrate <- [0]",
+				"Deps/Deploy › Push <- [1 0]",
+				"Deps/Deploy › Restart <- [2]",
+			},
+			variables: []string{"env", "target"},
+		},
+		{
+			path: "Loop/A",
+			err:  "commands need each other: Loop/A → Loop/B → Loop/C → Loop/A",
+		},
+		{
+			path: "Loop/C",
+			err:  "commands need each other: Loop/C → Loop/A → Loop/B → Loop/C",
+		},
+		{
+			path: "Self",
+			err:  "commands need each other: Self → Self",
+		},
+		{
+			path: "Broken",
+			err:  `"Broken" needs "nothing", which is neither an id nor a path`,
+		},
+		{
+			path: "Folder",
+			err:  `"Folder" needs "Deps", which is a folder`,
+		},
+	}
+	root := buildTree(t, needsConfig)
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			node, err := FindNode(root, tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			plan, err := PlanNeeds(root, node)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("PlanNeeds() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("PlanNeeds(): %v", err)
+			}
+
+			var steps []string
+			for _, step := range plan.Steps {
+				steps = append(steps, fmt.Sprintf("%s <- %v", step.Name, step.Needs))
+			}
+			if !slices.Equal(steps, tt.steps) {
+				t.Errorf("steps = %q, want %q", steps, tt.steps)
+			}
+			var variables []string
+			for _, v := range plan.Variables {
+				variables = append(variables, v.Name)
+			}
+			if !slices.Equal(variables, tt.variables) {
+				t.Errorf("variables = %q, want %q", variables, tt.variables)
+			}
+		})
+	}
+}
+
+func TestCheckNeeds(t *testing.T) {
+	want := []string{
+		"commands need each other: Loop/A → Loop/B → Loop/C → Loop/A",
+		"commands need each other: Self → Self",
+		`"Broken" needs "nothing", which is neither an id nor a path`,
+		`"Folder" needs "Deps", which is a folder`,
+	}
+	var got []string
+	for _, d := range CheckNeeds(buildTree(t, needsConfig)) {
+		got = append(got, d.Message)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("CheckNeeds() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestNeedsTree(t *testing.T) {
+	root := buildTree(t, needsConfig)
+	node, err := FindNode(root, "Deps/Deploy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"Deps/Deploy",
+		"├─ Deps/Migrate",
+		"│  └─ Build",
+		"└─ Build",
+	}
+	got, err := NeedsTree(root, node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("NeedsTree() =\n%q\nwant\n%q", got, want)
+	}
+}
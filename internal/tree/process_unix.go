@@ -0,0 +1,66 @@
+//go:build !windows
+
+package tree
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"unsafe"
+)
+
+// setProcessGroup starts cmd in its own process group so that it can be
+// signalled together with all of its children
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// signalProcessGroup sends sig to the process group started by cmd
+func signalProcessGroup(cmd *exec.Cmd, sig syscall.Signal) error {
+	return syscall.Kill(-cmd.Process.Pid, sig)
+}
+
+// startForeground starts cmd in its own process group. When iz is in the
+// foreground of the terminal tty, the group takes the terminal over the way a
+// shell starts a job, so Ctrl+C and reads from the terminal reach the command
+// and whatever it started. The returned function hands the terminal back.
+func startForeground(cmd *exec.Cmd, tty io.Reader) (func(), error) {
+	fd, ok := terminalFd(tty)
+	if !ok {
+		setProcessGroup(cmd)
+		return func() {}, cmd.Start()
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Foreground: true, Ctty: fd}
+	if err := cmd.Start(); err != nil {
+		return func() {}, err
+	}
+	return func() {
+		// iz is in the background now, taking the terminal back would stop it
+		signal.Ignore(syscall.SIGTTOU)
+		defer signal.Reset(syscall.SIGTTOU)
+		pgrp := int32(syscall.Getpgrp())
+		_, _, _ = syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.TIOCSPGRP, uintptr(unsafe.Pointer(&pgrp)))
+	}, nil
+}
+
+// terminalFd returns the descriptor of tty when it is a terminal with iz's
+// process group in the foreground
+func terminalFd(tty io.Reader) (int, bool) {
+	f, ok := tty.(*os.File)
+	if !ok {
+		return 0, false
+	}
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return 0, false
+	}
+	fd, foreground := 0, false
+	_ = conn.Control(func(d uintptr) {
+		var pgrp int32
+		_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, d, syscall.TIOCGPGRP, uintptr(unsafe.Pointer(&pgrp)))
+		fd, foreground = int(d), errno == 0 && int(pgrp) == syscall.Getpgrp()
+	})
+	return fd, foreground
+}
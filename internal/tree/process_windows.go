@@ -0,0 +1,22 @@
+//go:build windows
+
+package tree
+
+import (
+	"io"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup is a no-op on Windows
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// signalProcessGroup can only kill the process itself on Windows
+func signalProcessGroup(cmd *exec.Cmd, sig syscall.Signal) error {
+	return cmd.Process.Kill()
+}
+
+// startForeground starts cmd, which shares the console with iz on Windows
+func startForeground(cmd *exec.Cmd, tty io.Reader) (func(), error) {
+	return func() {}, cmd.Start()
+}
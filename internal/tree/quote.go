@@ -0,0 +1,93 @@
+package tree
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmy/iz/internal/config"
+	"github.com/charmy/iz/internal/template"
+)
+
+// shellMetaChars are characters the shell would interpret in an unquoted value
+const shellMetaChars = "|&;<>()$`\\\"'*?[]#~\n"
+
+// QuoteValue prepares a variable value for insertion into a command run by
+// shell according to the variable's quoting mode
+func QuoteValue(value, mode, shell string) (string, error) {
+	switch mode {
+	case "", config.QuoteShell:
+		return template.QuoteFor(shell)(value), nil
+	case config.QuoteNone:
+		if i := strings.IndexAny(value, shellMetaChars); i >= 0 {
+			return "", fmt.Errorf("value contains shell metacharacter %q", value[i])
+		}
+		return value, nil
+	case config.QuoteRaw:
+		return value, nil
+	default:
+		return "", fmt.Errorf("unknown quote mode %q", mode)
+	}
+}
+
+// formatArgv renders an argument vector as an equivalent shell command line
+func formatArgv(argv []string) string {
+	words := make([]string, len(argv))
+	for i, arg := range argv {
+		words[i] = template.ShellQuote(arg)
+	}
+	return strings.Join(words, " ")
+}
+
+// SplitWords splits a command line into words the way sh would, honoring
+// single and double quotes and backslashes but expanding nothing. It is used
+// for commands run without a shell.
+func SplitWords(line string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+	for _, r := range line {
+		switch {
+		case escaped:
+			escaped = false
+			if quote == '"' && !strings.ContainsRune("\"\\$`\n", r) {
+				word.WriteRune('\\')
+			}
+			// A backslash before a newline continues the line
+			if r != '\n' {
+				word.WriteRune(r)
+				inWord = true
+			}
+		case r == '\\' && quote != '\'':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if escaped {
+		return nil, fmt.Errorf("command ends with a backslash")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
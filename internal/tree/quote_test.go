@@ -0,0 +1,91 @@
+package tree
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSplitWords(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"", nil},
+		{"   ", nil},
+		{"ls", []string{"ls"}},
+		{"  ls   -l\t/tmp \n", []string{"ls", "-l", "/tmp"}},
+		{`echo 'a b' "c d"`, []string{"echo", "a b", "c d"}},
+		{`echo ''`, []string{"echo", ""}},
+		{`echo a''b`, []string{"echo", "ab"}},
+		{`echo 'it'"'"'s'`, []string{"echo", "it's"}},
+		{`echo a\ b`, []string{"echo", "a b"}},
+		{`echo '\n' "\n" "\"" "\\" \x`, []string{"echo", `\n`, `\n`, `"`, `\`, "x"}},
+		{`echo "$HOME" '$HOME' ~ *`, []string{"echo", "$HOME", "$HOME", "~", "*"}},
+		{"echo a \\\n b", []string{"echo", "a", "b"}},
+		{"echo \"a\\\nb\"", []string{"echo", "ab"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got, err := SplitWords(tt.line)
+			if err != nil {
+				t.Fatalf("SplitWords(%q): %v", tt.line, err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("SplitWords(%q) = %q, want %q", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitWordsErrors(t *testing.T) {
+	for _, line := range []string{`echo 'a`, `echo "a`, `echo a\`} {
+		if words, err := SplitWords(line); err == nil {
+			t.Errorf("SplitWords(%q) = %q, want an error", line, words)
+		}
+	}
+}
+
+func TestSplitWordsFormatArgv(t *testing.T) {
+	// Splitting a formatted argument vector gives it back
+	tests := [][]string{
+		{"ls"},
+		{"echo", ""},
+		{"echo", "a b", "it's", `back\slash`, `"quoted"`, "$HOME", "tab\there"},
+	}
+	for _, argv := range tests {
+		line := formatArgv(argv)
+		got, err := SplitWords(line)
+		if err != nil {
+			t.Fatalf("SplitWords(%q): %v", line, err)
+		}
+		if !slices.Equal(got, argv) {
+			t.Errorf("SplitWords(formatArgv(%q)) = %q", argv, got)
+		}
+	}
+}
+
+func TestQuoteValue(t *testing.T) {
+	tests := []struct {
+		value, mode, shell string
+		want               string
+		wantErr            bool
+	}{
+		{"a b", "", "", "'a b'", false},
+		{"a b", "shell", "bash", "'a b'", false},
+		{"it's", "shell", "fish", `'it\'s'`, false},
+		{"plain", "none", "", "plain", false},
+		{"a;b", "none", "", "", true},
+		{"$(date)", "raw", "", "$(date)", false},
+		{"x", "loose", "", "", true},
+	}
+	for _, tt := range tests {
+		got, err := QuoteValue(tt.value, tt.mode, tt.shell)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("QuoteValue(%q, %q, %q) error = %v, want error %v", tt.value, tt.mode, tt.shell, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("QuoteValue(%q, %q, %q) = %q, want %q", tt.value, tt.mode, tt.shell, got, tt.want)
+		}
+	}
+}
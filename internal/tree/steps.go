@@ -0,0 +1,320 @@
+package tree
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/charmy/iz/internal/config"
+)
+
+// Step is one step of a command made of steps
+type Step struct {
+	Name    string
+	Command string
+	// Cwd is the working directory of the step, resolved like the one of the
+	// command. Empty runs the step where the command runs.
+	Cwd             string
+	ContinueOnError bool
+	Confirm         bool
+	// Needs holds the indexes of the steps that have to succeed first, the
+	// previous one unless the step is part of a plan, see PlanNeeds
+	Needs []int
+	// Node is the command the step belongs to in a plan. A step without a
+	// command stands for the whole command of Node.
+	Node *TreeNode
+}
+
+// StepSpec is a step with its command expanded, ready to run
+type StepSpec struct {
+	Name            string
+	Spec            RunSpec
+	ContinueOnError bool
+	Confirm         bool
+	Needs           []int
+}
+
+// Stops reports whether the step finishing with result ends the run of the
+// steps after it
+func (s StepSpec) Stops(result CommandFinishedMsg) bool {
+	return result.Failed() && !s.ContinueOnError
+}
+
+// convertSteps converts the steps of a command running in cwd. Steps without
+// a name are numbered.
+func convertSteps(cfgs []config.StepConfig, cwd, source string) []Step {
+	var steps []Step
+	for i, cfg := range cfgs {
+		step := Step{
+			Name:            cfg.Name,
+			Command:         cfg.Command,
+			ContinueOnError: cfg.ContinueOnError,
+			Confirm:         cfg.Confirm,
+		}
+		if step.Name == "" {
+			step.Name = fmt.Sprintf("step %d", i+1)
+		}
+		if cfg.Cwd != "" {
+			step.Cwd = resolveCwd(cfg.Cwd, cwd, source)
+		}
+		if i > 0 {
+			step.Needs = []int{i - 1}
+		}
+		steps = append(steps, step)
+	}
+	return steps
+}
+
+// expandSteps expands the command of every step, see Expand
+func (n *TreeNode) expandSteps(values map[string]string) (RunSpec, error) {
+	var steps []StepSpec
+	for _, step := range n.Steps {
+		spec, err := n.expandStep(step, values)
+		if err != nil {
+			return RunSpec{}, fmt.Errorf("step %q: %w", step.Name, err)
+		}
+		steps = append(steps, StepSpec{
+			Name:            step.Name,
+			Spec:            spec,
+			ContinueOnError: step.ContinueOnError,
+			Confirm:         step.Confirm,
+			Needs:           step.Needs,
+		})
+	}
+	return RunSpec{Dir: n.Cwd, Steps: steps}, nil
+}
+
+// expandStep expands a single step in the context of the node it belongs to
+func (n *TreeNode) expandStep(step Step, values map[string]string) (RunSpec, error) {
+	owner := n
+	if step.Node != nil {
+		owner = step.Node
+	}
+	if step.Command == "" {
+		return owner.Expand(values)
+	}
+
+	command, err := ReplaceVariables(step.Command, values, owner.Variables, owner.Shell)
+	if err != nil {
+		return RunSpec{}, err
+	}
+	spec, err := owner.WithContext(RunSpec{Command: command}, values)
+	if err != nil {
+		return RunSpec{}, err
+	}
+	if step.Cwd != "" {
+		spec.Dir = step.Cwd
+	}
+	return spec, nil
+}
+
+// Sequential reports whether each step only waits for the one before it
+func Sequential(steps []StepSpec) bool {
+	for i, step := range steps {
+		if i > 0 && !slices.Equal(step.Needs, []int{i - 1}) || i == 0 && len(step.Needs) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// stepsString joins the step commands into one shell command line that
+// stops at the first failing step unless it may fail, for showing and
+// recording the steps
+func stepsString(steps []StepSpec) string {
+	var b strings.Builder
+	for i, step := range steps {
+		if i > 0 {
+			if steps[i-1].ContinueOnError {
+				b.WriteString("; ")
+			} else {
+				b.WriteString(" && ")
+			}
+		}
+		command := step.Spec.String()
+		if strings.ContainsAny(command, ";&|\n") {
+			// A subshell keeps exit and the operators inside the step
+			command = "(" + command + ")"
+		}
+		b.WriteString(command)
+	}
+	return b.String()
+}
+
+// runSteps runs the steps with the current process' stdio attached,
+// announcing each on out and asking on in before the ones that want
+// confirmation. It returns the exit code of the step that stopped the run.
+func runSteps(steps []StepSpec, in io.Reader, out io.Writer) (int, error) {
+	if !Sequential(steps) {
+		return runParallel(steps, in, out)
+	}
+	for i, step := range steps {
+		fmt.Fprintf(out, "==> [%d/%d] %s\n", i+1, len(steps), step.Name)
+		if step.Confirm && !confirmStep(step, in, out) {
+			return 1, fmt.Errorf("step %q was not confirmed", step.Name)
+		}
+
+		exitCode, err := RunCommand(step.Spec)
+		if err != nil || exitCode != 0 {
+			if step.ContinueOnError {
+				fmt.Fprintf(out, "==> %s failed, continuing\n", step.Name)
+				continue
+			}
+			if err != nil {
+				err = fmt.Errorf("step %q: %w", step.Name, err)
+			}
+			return exitCode, err
+		}
+	}
+	return 0, nil
+}
+
+// runParallel runs every step as soon as the ones it needs succeeded, with
+// each line of output prefixed by the name of its step. Once a step failed no
+// more steps are started.
+func runParallel(steps []StepSpec, in io.Reader, out io.Writer) (int, error) {
+	type result struct {
+		step     int
+		exitCode int
+		err      error
+	}
+	var mu sync.Mutex
+	done := make(chan result)
+	results := make([]*result, len(steps))
+	started := make([]bool, len(steps))
+	running := 0
+	var stop *result
+
+	ready := func(i int) bool {
+		for _, need := range steps[i].Needs {
+			r := results[need]
+			if r == nil || (r.err != nil || r.exitCode != 0) && !steps[need].ContinueOnError {
+				return false
+			}
+		}
+		return true
+	}
+
+	for {
+		for i, step := range steps {
+			if stop != nil || started[i] || !ready(i) {
+				continue
+			}
+			mu.Lock()
+			fmt.Fprintf(out, "==> %s\n", step.Name)
+			confirmed := !step.Confirm || confirmStep(step, in, out)
+			mu.Unlock()
+			if !confirmed {
+				stop = &result{step: i, exitCode: 1, err: fmt.Errorf("step %q was not confirmed", step.Name)}
+				break
+			}
+
+			started[i] = true
+			running++
+			go func(i int, spec RunSpec) {
+				prefix := fmt.Sprintf("[%s] ", steps[i].Name)
+				stdout := &prefixWriter{w: os.Stdout, prefix: prefix, mu: &mu}
+				stderr := &prefixWriter{w: os.Stderr, prefix: prefix, mu: &mu}
+				exitCode, err := runWith(spec, nil, stdout, stderr)
+				stdout.Flush()
+				stderr.Flush()
+				done <- result{step: i, exitCode: exitCode, err: err}
+			}(i, step.Spec)
+		}
+		if running == 0 {
+			break
+		}
+
+		r := <-done
+		running--
+		results[r.step] = &r
+		if r.err == nil && r.exitCode == 0 {
+			continue
+		}
+		mu.Lock()
+		if steps[r.step].ContinueOnError {
+			fmt.Fprintf(out, "==> %s failed, continuing\n", steps[r.step].Name)
+		} else if stop == nil {
+			fmt.Fprintf(out, "==> %s failed, no more steps are started\n", steps[r.step].Name)
+			if r.err != nil {
+				r.err = fmt.Errorf("step %q: %w", steps[r.step].Name, r.err)
+			}
+			stop = &r
+		}
+		mu.Unlock()
+	}
+
+	if stop == nil {
+		return 0, nil
+	}
+	return stop.exitCode, stop.err
+}
+
+// confirmStep asks on out whether to run the step and reads the answer from in
+func confirmStep(step StepSpec, in io.Reader, out io.Writer) bool {
+	fmt.Fprintf(out, "Run step %q? [y/N] ", step.Name)
+	switch strings.ToLower(strings.TrimSpace(readLine(in))) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+// prefixWriter writes whole lines to w, each starting with prefix. Writers
+// sharing mu do not interleave their lines.
+type prefixWriter struct {
+	w      io.Writer
+	prefix string
+	mu     *sync.Mutex
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			return len(b), nil
+		}
+		p.writeLine(p.buf[:i])
+		p.buf = p.buf[i+1:]
+	}
+}
+
+// Flush writes the last line when it did not end with a newline
+func (p *prefixWriter) Flush() {
+	if len(p.buf) > 0 {
+		p.writeLine(p.buf)
+		p.buf = nil
+	}
+}
+
+func (p *prefixWriter) writeLine(line []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprintf(p.w, "%s%s\n", p.prefix, line)
+}
+
+// readLine reads a line from r byte by byte, leaving the rest of the input
+// to the steps
+func readLine(r io.Reader) string {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := r.Read(b)
+		if n > 0 {
+			if b[0] == '\n' {
+				break
+			}
+			line = append(line, b[0])
+		}
+		if err != nil {
+			break
+		}
+	}
+	return string(line)
+}
@@ -1,81 +1,231 @@
 package tree
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
+	"os"
 	"os/exec"
-	"regexp"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmy/iz/internal/config"
+	"github.com/charmy/iz/internal/template"
 )
 
 // TreeNode represents a hierarchical command structure
 type TreeNode struct {
 	Name        string
+	Path        string
 	Children    []*TreeNode
 	Expanded    bool
 	IsFolder    bool
 	Level       int
 	Command     string
+	Argv        []string
 	Description string
 	Confirm     bool
 	Variables   []config.VariableConfig
+	Source      string
+	Line        int
+	// Env, Cwd and Shell are the execution context, set on the node itself or
+	// inherited from the nearest folder above it
+	Env   map[string]string
+	Cwd   string
+	Shell string
+	// Timeout stops the command, inherited like the execution context
+	Timeout time.Duration
+	// Concurrency limits how many runs fanned out over several values run
+	// at once, inherited too. Zero stands for DefaultConcurrency.
+	Concurrency int
+	// Stdin is passed to the command as its standard input
+	Stdin string
+	// Steps are run one after the other in place of Command
+	Steps []Step
+	// ID and Needs as in the config, see PlanNeeds
+	ID    string
+	Needs []string
+	// Origins maps settings taken from the node or an ancestor, see the
+	// Origin constants, VariableOrigin and EnvOrigin, to the path of the node
+	// that set them. "" stands for the top level of the config.
+	Origins map[string]string
+	// Shortcut is set on the Favorites and Recent folders and the entries in
+	// them, which stand in for the command with the same Path
+	Shortcut bool
 }
 
 // ConvertConfigToTree converts configuration to tree structure
-func ConvertConfigToTree(cfg *config.ConfigNode, defaultConfirm bool, globalVariables []config.VariableConfig) *TreeNode {
-	confirmSetting := defaultConfirm
-	if cfg.Confirm != nil {
-		confirmSetting = *cfg.Confirm
+func ConvertConfigToTree(cfg *config.ConfigNode, parentPath string, defaultConfirm bool, globalVariables []config.VariableConfig) *TreeNode {
+	s := scope{confirm: defaultConfirm, origins: make(map[string]string)}
+	for _, v := range globalVariables {
+		v.Global = true
+		s.variables = append(s.variables, v)
+		s.origins[VariableOrigin(v.Name)] = ""
+	}
+	return convertNode(cfg, parentPath, s)
+}
+
+// scope holds the settings a node inherits from its ancestors
+type scope struct {
+	confirm     bool
+	variables   []config.VariableConfig
+	env         map[string]string
+	cwd         string
+	shell       string
+	timeout     time.Duration
+	concurrency int
+	origins     map[string]string
+}
+
+// Keys of TreeNode.Origins for the settings other than variables and env
+const (
+	OriginConfirm     = "confirm"
+	OriginCwd         = "cwd"
+	OriginShell       = "shell"
+	OriginTimeout     = "timeout"
+	OriginConcurrency = "concurrency"
+)
+
+// DefaultConcurrency is how many runs fanned out over several values run at
+// once unless the command says otherwise
+const DefaultConcurrency = 4
+
+// VariableOrigin returns the key of TreeNode.Origins for a variable
+func VariableOrigin(name string) string {
+	return "variable " + name
+}
+
+// EnvOrigin returns the key of TreeNode.Origins for an environment variable
+func EnvOrigin(name string) string {
+	return "env " + name
+}
+
+// convertNode converts cfg and its children, the settings of cfg override the inherited ones
+func convertNode(cfg *config.ConfigNode, parentPath string, inherited scope) *TreeNode {
+	path := JoinPath(parentPath, cfg.Name)
+	s := scope{
+		confirm:     inherited.confirm,
+		env:         maps.Clone(inherited.env),
+		cwd:         inherited.cwd,
+		shell:       inherited.shell,
+		timeout:     inherited.timeout,
+		concurrency: inherited.concurrency,
+		origins:     maps.Clone(inherited.origins),
 	}
 
-	// Merge global variables with local variables (local overrides global)
-	mergedVariables := mergeVariables(globalVariables, cfg.Variables)
+	if cfg.Confirm != nil {
+		s.confirm = *cfg.Confirm
+		s.origins[OriginConfirm] = path
+	}
+	if cfg.Cwd != "" {
+		s.cwd = resolveCwd(cfg.Cwd, inherited.cwd, cfg.Source)
+		s.origins[OriginCwd] = path
+	}
+	if cfg.Shell != "" {
+		s.shell = cfg.Shell
+		s.origins[OriginShell] = path
+	}
+	// Invalid timeouts are reported by the validator
+	if d, err := time.ParseDuration(cfg.Timeout); err == nil && d > 0 {
+		s.timeout = d
+		s.origins[OriginTimeout] = path
+	}
+	if cfg.Concurrency > 0 {
+		s.concurrency = cfg.Concurrency
+		s.origins[OriginConcurrency] = path
+	}
+	for name, value := range cfg.Env {
+		if s.env == nil {
+			s.env = make(map[string]string)
+		}
+		s.env[name] = value
+		s.origins[EnvOrigin(name)] = path
+	}
+	// Local variables override inherited ones
+	s.variables = mergeVariables(inherited.variables, cfg.Variables)
+	for _, v := range cfg.Variables {
+		s.origins[VariableOrigin(v.Name)] = path
+	}
 
 	node := &TreeNode{
 		Name:        cfg.Name,
+		Path:        path,
 		Expanded:    cfg.Expanded,
-		IsFolder:    len(cfg.Children) > 0,
+		IsFolder:    len(cfg.Children) > 0 || (cfg.Children != nil && !cfg.HasCommand()),
 		Command:     cfg.Command,
+		Argv:        cfg.Argv,
 		Description: cfg.Description,
-		Confirm:     confirmSetting,
-		Variables:   mergedVariables,
+		Confirm:     s.confirm,
+		Variables:   s.variables,
+		Env:         s.env,
+		Cwd:         s.cwd,
+		Shell:       s.shell,
+		Timeout:     s.timeout,
+		Concurrency: s.concurrency,
+		Stdin:       cfg.Stdin,
+		Steps:       convertSteps(cfg.Steps, s.cwd, cfg.Source),
+		ID:          cfg.ID,
+		Needs:       cfg.Needs,
+		Origins:     s.origins,
+		Source:      cfg.Source,
+		Line:        cfg.Line,
 	}
 
 	for i := range cfg.Children {
-		node.Children = append(node.Children, ConvertConfigToTree(&cfg.Children[i], defaultConfirm, globalVariables))
+		node.Children = append(node.Children, convertNode(&cfg.Children[i], node.Path, s))
 	}
 
 	return node
 }
 
-// mergeVariables merges global variables with local variables (local overrides global)
-func mergeVariables(globalVars, localVars []config.VariableConfig) []config.VariableConfig {
+// resolveCwd resolves a relative working directory against the inherited one
+// or, without one, the directory of the config file defining it
+func resolveCwd(cwd, inherited, source string) string {
+	switch {
+	case cwd == "~" || strings.HasPrefix(cwd, "~/") || filepath.IsAbs(cwd):
+		return cwd
+	case inherited != "":
+		return filepath.Join(inherited, cwd)
+	case source != "":
+		return filepath.Join(filepath.Dir(source), cwd)
+	}
+	return cwd
+}
+
+// mergeVariables merges inherited variables with local variables (local overrides inherited)
+func mergeVariables(inheritedVars, localVars []config.VariableConfig) []config.VariableConfig {
 	// Create a map of local variables by name for fast lookup
 	localVarMap := make(map[string]config.VariableConfig)
 	for _, localVar := range localVars {
 		localVarMap[localVar.Name] = localVar
 	}
 
-	// Start with global variables
-	merged := make([]config.VariableConfig, 0, len(globalVars)+len(localVars))
-	globalVarMap := make(map[string]bool)
+	// Start with inherited variables
+	merged := make([]config.VariableConfig, 0, len(inheritedVars)+len(localVars))
+	inheritedVarMap := make(map[string]bool)
 
-	for _, globalVar := range globalVars {
-		if localVar, exists := localVarMap[globalVar.Name]; exists {
-			// Local variable overrides global
+	for _, inheritedVar := range inheritedVars {
+		if localVar, exists := localVarMap[inheritedVar.Name]; exists {
+			// Local variable overrides inherited
 			merged = append(merged, localVar)
 		} else {
-			// Use global variable
-			merged = append(merged, globalVar)
+			merged = append(merged, inheritedVar)
 		}
-		globalVarMap[globalVar.Name] = true
+		inheritedVarMap[inheritedVar.Name] = true
 	}
 
-	// Add any local variables that weren't in global variables
+	// Add any local variables that weren't inherited
 	for _, localVar := range localVars {
-		if !globalVarMap[localVar.Name] {
+		if !inheritedVarMap[localVar.Name] {
 			merged = append(merged, localVar)
 		}
 	}
@@ -97,56 +247,745 @@ func BuildTreeFromConfig(cfg *config.Config) *TreeNode {
 		Description: cfg.Description,
 		Confirm:     defaultConfirm,
 	}
+	if len(cfg.Files) > 0 {
+		root.Source = cfg.Files[0]
+	}
 
 	for i := range cfg.Commands {
-		root.Children = append(root.Children, ConvertConfigToTree(&cfg.Commands[i], defaultConfirm, cfg.Variables))
+		root.Children = append(root.Children, ConvertConfigToTree(&cfg.Commands[i], "", defaultConfirm, cfg.Variables))
 	}
 
 	return root
 }
 
-// ExtractVariables extracts unique variable placeholders from command string
-// Supports {variable} format and returns deduplicated list
-func ExtractVariables(command string) []string {
-	re := regexp.MustCompile(`\{([\w-]+)\}`)
-	matches := re.FindAllStringSubmatch(command, -1)
+// Names of the folders holding shortcuts at the top of the tree
+const (
+	FavoritesFolder = "★ Favorites"
+	RecentFolder    = "⏱ Recent"
+)
+
+// maxRecent limits the number of commands in the Recent folder
+const maxRecent = 10
+
+// SetShortcuts replaces the Favorites and Recent folders at the top of root
+// with ones listing the commands at the given paths. Paths that no longer name
+// a command are skipped, favorites are left out of Recent and empty folders
+// are not added at all.
+func SetShortcuts(root *TreeNode, favorites, recent []string) {
+	expanded := map[string]bool{FavoritesFolder: true, RecentFolder: false}
+	var children []*TreeNode
+	for _, child := range root.Children {
+		if child.Shortcut {
+			expanded[child.Path] = child.Expanded
+			continue
+		}
+		children = append(children, child)
+	}
+	root.Children = children
+
+	var shortcuts []*TreeNode
+	if folder := shortcutFolder(root, FavoritesFolder, favorites, nil, len(favorites)); folder != nil {
+		folder.Expanded = expanded[FavoritesFolder]
+		shortcuts = append(shortcuts, folder)
+	}
+	if folder := shortcutFolder(root, RecentFolder, recent, favorites, maxRecent); folder != nil {
+		folder.Expanded = expanded[RecentFolder]
+		shortcuts = append(shortcuts, folder)
+	}
+	root.Children = append(shortcuts, root.Children...)
+}
+
+// shortcutFolder returns a folder with copies of up to limit commands at
+// paths, skipping those in exclude, or nil when there are none
+func shortcutFolder(root *TreeNode, name string, paths, exclude []string, limit int) *TreeNode {
+	folder := &TreeNode{Name: name, Path: name, IsFolder: true, Shortcut: true}
+	for _, path := range paths {
+		if len(folder.Children) == limit {
+			break
+		}
+		node, err := FindNode(root, path)
+		if err != nil || node.IsFolder || !node.Runnable() || slices.Contains(exclude, path) {
+			continue
+		}
+		shortcut := *node
+		shortcut.Shortcut = true
+		folder.Children = append(folder.Children, &shortcut)
+	}
+	if len(folder.Children) == 0 {
+		return nil
+	}
+	return folder
+}
+
+// Walk calls fn for node and all of its descendants, parents before children
+func Walk(node *TreeNode, fn func(*TreeNode)) {
+	fn(node)
+	for _, child := range node.Children {
+		Walk(child, fn)
+	}
+}
+
+// FindParent returns the folder containing node, or nil for root itself
+func FindParent(root, node *TreeNode) *TreeNode {
+	for _, child := range root.Children {
+		if child == node {
+			return root
+		}
+		if parent := FindParent(child, node); parent != nil {
+			return parent
+		}
+	}
+	return nil
+}
+
+// JoinPath appends a node name to a slash separated tree path
+func JoinPath(parentPath, name string) string {
+	if parentPath == "" {
+		return name
+	}
+	return parentPath + "/" + name
+}
+
+// FindNode looks up a node by its slash separated path below root, e.g. "Network/Ping Host"
+func FindNode(root *TreeNode, path string) (*TreeNode, error) {
+	node := root
+	for _, name := range strings.Split(strings.Trim(path, "/"), "/") {
+		var next *TreeNode
+		for _, child := range node.Children {
+			if child.Name == name {
+				next = child
+				break
+			}
+		}
+		if next == nil {
+			return nil, fmt.Errorf("no command or folder named %q in %q", name, node.Name)
+		}
+		node = next
+	}
+	return node, nil
+}
+
+// ResolveVariables returns the values for every placeholder in the node's command.
+// Explicit values take precedence over the defaults of the merged variable configs;
+// an error lists all placeholders that end up without a value.
+func ResolveVariables(node *TreeNode, values map[string]string) (map[string]string, error) {
+	if _, err := node.templates(); err != nil {
+		return nil, err
+	}
+	placeholders, err := node.InputVariables()
+	if err != nil {
+		return nil, err
+	}
+
+	used := make(map[string]bool)
+	for _, name := range placeholders {
+		used[name] = true
+	}
+	var unknown []string
+	for name := range values {
+		if !used[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown variables for %q: %s", node.Path, strings.Join(unknown, ", "))
+	}
+
+	resolved := make(map[string]string)
+	var missing []string
+	inactive := make(map[string]bool)
+	for _, name := range placeholders {
+		if vc := node.Variable(name); vc != nil && !vc.Active(resolved) {
+			// Conditional variables that do not apply are left empty
+			inactive[name] = true
+			continue
+		}
+		if value, ok := values[name]; ok {
+			resolved[name] = value
+			continue
+		}
+		if vc := node.Variable(name); vc != nil && vc.Default != "" {
+			resolved[name] = vc.ExpandDefault(resolved)
+			continue
+		}
+		if vc := node.Variable(name); vc != nil && vc.Kind() == config.TypeBool && len(vc.Options) == 0 {
+			// Like the unchecked toggle of the input dialog
+			resolved[name] = "false"
+			continue
+		}
+		if node.Optional(name) {
+			continue
+		}
+		missing = append(missing, name)
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing values for variables: %s", strings.Join(missing, ", "))
+	}
+
+	var invalid []string
+	for _, name := range placeholders {
+		if vc := node.Variable(name); vc != nil && !inactive[name] {
+			if err := vc.Check(resolved[name]); err != nil {
+				invalid = append(invalid, fmt.Sprintf("%s %v", name, err))
+			}
+		}
+	}
+	if len(invalid) > 0 {
+		return nil, fmt.Errorf("invalid values: %s", strings.Join(invalid, "; "))
+	}
+
+	return resolved, nil
+}
+
+// Variable returns the merged configuration of the named variable, if any
+func (n *TreeNode) Variable(name string) *config.VariableConfig {
+	for i := range n.Variables {
+		if n.Variables[i].Name == name {
+			return &n.Variables[i]
+		}
+	}
+	return nil
+}
+
+// secretMask replaces the values of secret variables wherever commands are shown
+const secretMask = "••••"
+
+// Secrets returns the names of the node's secret variables
+func (n *TreeNode) Secrets() []string {
+	var names []string
+	for _, v := range n.Variables {
+		if v.Secret {
+			names = append(names, v.Name)
+		}
+	}
+	return names
+}
+
+// Unrecorded returns the names of the node's variables whose values are not
+// kept: secrets and variables that are not remembered
+func (n *TreeNode) Unrecorded() []string {
+	var names []string
+	for _, v := range n.Variables {
+		if !v.Remembered() {
+			names = append(names, v.Name)
+		}
+	}
+	return names
+}
+
+// Redact returns spec with the values of the node's secret variables masked,
+// for showing the command without them
+func (n *TreeNode) Redact(spec RunSpec, values map[string]string) RunSpec {
+	return n.redact(spec, values, n.Secrets())
+}
+
+// RedactUnrecorded returns spec with the values of the node's unrecorded
+// variables masked, for recording the command without them
+func (n *TreeNode) RedactUnrecorded(spec RunSpec, values map[string]string) RunSpec {
+	return n.redact(spec, values, n.Unrecorded())
+}
+
+// redact returns spec with the values of the variables names masked. The
+// node is expanded again with the mask in place of those values, so only the
+// places where they are substituted change.
+func (n *TreeNode) redact(spec RunSpec, values map[string]string, names []string) RunSpec {
+	masked := maps.Clone(values)
+	changed := false
+	for _, name := range names {
+		if values[name] != "" {
+			masked[name] = secretMask
+			changed = true
+		}
+	}
+	if !changed {
+		return spec
+	}
+
+	redacted, err := n.Expand(masked)
+	if err != nil {
+		// Expanding the values worked, show nothing rather than the values
+		return RunSpec{Command: secretMask, Dir: spec.Dir}
+	}
+	redacted.Dir = spec.Dir
+	return redacted
+}
+
+// Runnable reports whether the node has a command, argv or steps to execute
+func (n *TreeNode) Runnable() bool {
+	return n.Command != "" || len(n.Argv) > 0 || len(n.Steps) > 0
+}
+
+// DisplayCommand returns the node's command line with its placeholders
+// unexpanded, or the names of its steps
+func (n *TreeNode) DisplayCommand() string {
+	switch {
+	case len(n.Steps) > 0:
+		names := make([]string, len(n.Steps))
+		for i, step := range n.Steps {
+			names[i] = step.Name
+		}
+		return strings.Join(names, " → ")
+	case len(n.Argv) > 0:
+		return strings.Join(n.Argv, " ")
+	}
+	return n.Command
+}
+
+// templates parses the node's command, each argv entry or each step command
+// as a template
+func (n *TreeNode) templates() ([]*template.Template, error) {
+	sources := n.Argv
+	if len(n.Steps) > 0 {
+		sources = nil
+		var templates []*template.Template
+		for _, step := range n.Steps {
+			if step.Command == "" {
+				// The whole command of another node, see PlanNeeds
+				t, err := step.Node.templates()
+				if err != nil {
+					return nil, err
+				}
+				templates = append(templates, t...)
+				continue
+			}
+			t, err := template.Parse(step.Command)
+			if err != nil {
+				return nil, err
+			}
+			templates = append(templates, t)
+		}
+		return templates, nil
+	} else if len(sources) == 0 {
+		sources = []string{n.Command}
+	}
+	templates := make([]*template.Template, len(sources))
+	for i, source := range sources {
+		t, err := template.Parse(source)
+		if err != nil {
+			return nil, err
+		}
+		templates[i] = t
+	}
+	return templates, nil
+}
 
-	var variables []string
+// Placeholders returns the variables referenced by the node's command or argv
+func (n *TreeNode) Placeholders() []string {
+	templates, _ := n.templates()
+	var names []string
 	seen := make(map[string]bool)
+	for _, t := range templates {
+		for _, name := range t.Variables() {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// InputVariables returns the variables to ask for: the placeholders of the
+// command, env and stdin and the variables their defaults, options and
+// conditions refer to, each after the ones it depends on
+func (n *TreeNode) InputVariables() ([]string, error) {
+	names := n.Placeholders()
+	context, err := n.contextTemplates()
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range context {
+		names = append(names, t.Variables()...)
+	}
+	return config.OrderVariables(names, n.Variable)
+}
+
+// contextTemplates parses the env values and stdin of the node and of the
+// nodes its steps belong to
+func (n *TreeNode) contextTemplates() ([]*template.Template, error) {
+	sources := []string{n.Stdin}
+	for _, name := range slices.Sorted(maps.Keys(n.Env)) {
+		sources = append(sources, n.Env[name])
+	}
+	templates := make([]*template.Template, len(sources))
+	for i, source := range sources {
+		t, err := template.Parse(source)
+		if err != nil {
+			return nil, err
+		}
+		templates[i] = t
+	}
+
+	var seen []*TreeNode
+	for _, step := range n.Steps {
+		if step.Node == nil || slices.Contains(seen, step.Node) {
+			continue
+		}
+		seen = append(seen, step.Node)
+		more, err := step.Node.contextTemplates()
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, more...)
+	}
+	return templates, nil
+}
+
+// InlineDefault returns the default given in the command itself, e.g. 4 for {count:-4}
+func (n *TreeNode) InlineDefault(name string) (string, bool) {
+	templates, _ := n.templates()
+	for _, t := range templates {
+		if def, ok := t.Default(name); ok {
+			return def, true
+		}
+	}
+	return "", false
+}
+
+// Optional reports whether a placeholder may be left empty because it has an
+// inline default or only appears inside optional segments. The required
+// setting of the variable overrides this.
+func (n *TreeNode) Optional(name string) bool {
+	if vc := n.Variable(name); vc != nil && vc.Required != nil {
+		return !*vc.Required
+	}
+	templates, _ := n.templates()
+	context, _ := n.contextTemplates()
+	for _, t := range append(templates, context...) {
+		if !t.Optional(name) {
+			return false
+		}
+	}
+	return true
+}
 
-	for _, match := range matches {
-		if len(match) > 1 {
-			varName := match[1]
-			if !seen[varName] {
-				variables = append(variables, varName)
-				seen[varName] = true
+// Expand substitutes values into the node's command. Shell commands quote each
+// value according to its variable's quote mode; argv entries are never parsed
+// by a shell and receive values verbatim. An argv entry consisting of optional
+// segments that all disappear is dropped entirely.
+func (n *TreeNode) Expand(values map[string]string) (RunSpec, error) {
+	if len(n.Steps) > 0 {
+		return n.expandSteps(values)
+	}
+	if len(n.Argv) > 0 {
+		templates, err := n.templates()
+		if err != nil {
+			return RunSpec{}, err
+		}
+		var argv []string
+		for _, t := range templates {
+			arg, err := t.Render(values, template.Verbatim)
+			if err != nil {
+				return RunSpec{}, err
+			}
+			if arg == "" && t.HasOptional() {
+				continue
 			}
+			argv = append(argv, arg)
+		}
+		return n.WithContext(RunSpec{Argv: argv}, values)
+	}
+
+	command, err := ReplaceVariables(n.Command, values, n.Variables, n.Shell)
+	if err != nil {
+		return RunSpec{}, err
+	}
+	return n.WithContext(RunSpec{Command: command}, values)
+}
+
+// WithContext returns spec set up to run in the working directory and shell
+// of the node, with its environment, stdin and timeout. Placeholders in the
+// env values and stdin are filled in with values.
+func (n *TreeNode) WithContext(spec RunSpec, values map[string]string) (RunSpec, error) {
+	spec.Dir = n.Cwd
+	spec.Shell = n.Shell
+	spec.Timeout = n.Timeout
+
+	render := func(source string) (string, error) {
+		t, err := template.Parse(source)
+		if err != nil {
+			return "", err
+		}
+		return t.Render(values, template.Verbatim)
+	}
+	var err error
+	if spec.Stdin, err = render(n.Stdin); err != nil {
+		return RunSpec{}, err
+	}
+	spec.Env = nil
+	for _, name := range slices.Sorted(maps.Keys(n.Env)) {
+		value, err := render(n.Env[name])
+		if err != nil {
+			return RunSpec{}, err
 		}
+		spec.Env = append(spec.Env, name+"="+value)
 	}
 
-	return variables
+	if n.Shell == config.ShellNone && len(spec.Argv) == 0 {
+		// Values were shell-quoted, splitting the line keeps each one a single argument
+		words, err := SplitWords(spec.Command)
+		if err != nil {
+			return RunSpec{}, err
+		}
+		if len(words) == 0 {
+			return RunSpec{}, fmt.Errorf("%q has an empty command", n.Path)
+		}
+		spec.Command, spec.Argv = "", words
+	}
+	return spec, nil
 }
 
-// ReplaceVariables substitutes variable placeholders with provided values
-func ReplaceVariables(command string, values map[string]string) string {
-	result := command
-	for varName, value := range values {
-		placeholder := fmt.Sprintf("{%s}", varName)
-		result = strings.ReplaceAll(result, placeholder, value)
+// ExtractVariables extracts unique variable placeholders from command string
+// in order of first appearance; see package template for the syntax
+func ExtractVariables(command string) []string {
+	t, err := template.Parse(command)
+	if err != nil {
+		return nil
+	}
+	return t.Variables()
+}
+
+// ReplaceVariables renders the command template with the provided values,
+// quoting each value for shell according to the quote mode of its variable config
+func ReplaceVariables(command string, values map[string]string, variables []config.VariableConfig, shell string) (string, error) {
+	t, err := template.Parse(command)
+	if err != nil {
+		return "", err
+	}
+
+	modes := make(map[string]string)
+	for _, v := range variables {
+		modes[v.Name] = v.Quote
+	}
+	return t.RenderFor(shell, values, func(name, value string) (string, error) {
+		quoted, err := QuoteValue(value, modes[name], shell)
+		if err != nil {
+			return "", fmt.Errorf("variable %q: %w", name, err)
+		}
+		return quoted, nil
+	})
+}
+
+// RunSpec is a command with all variables substituted, ready to execute
+type RunSpec struct {
+	// Command is executed with `sh -c`, or the -c option of Shell
+	Command string
+	// Argv is executed directly, without a shell, when set
+	Argv []string
+
+	// Dir is the working directory, iz's own when empty
+	Dir string
+	// Env holds NAME=value pairs added to iz's environment
+	Env   []string
+	Shell string
+	// Stdin is passed as standard input instead of the terminal when set
+	Stdin string
+	// Timeout kills the command once it ran that long, unless it is 0
+	Timeout time.Duration
+	// Steps are run one after the other instead of Command or Argv
+	Steps []StepSpec
+}
+
+// String returns the command line as it would be typed into a shell
+func (r RunSpec) String() string {
+	if len(r.Steps) > 0 {
+		return stepsString(r.Steps)
+	}
+	if len(r.Argv) > 0 {
+		return formatArgv(r.Argv)
+	}
+	return r.Command
+}
+
+// cmd builds the process for the spec
+func (r RunSpec) cmd() *exec.Cmd {
+	var cmd *exec.Cmd
+	switch {
+	case len(r.Argv) > 0:
+		cmd = exec.Command(r.Argv[0], r.Argv[1:]...)
+	case r.Shell != "":
+		cmd = exec.Command(r.Shell, "-c", r.Command)
+	default:
+		cmd = exec.Command("sh", "-c", r.Command)
+	}
+	cmd.Dir = config.ExpandHome(r.Dir)
+	if len(r.Env) > 0 {
+		cmd.Env = append(os.Environ(), r.Env...)
+	}
+	if r.Stdin != "" {
+		cmd.Stdin = strings.NewReader(r.Stdin)
+	}
+	return cmd
+}
+
+// watchTimeout calls kill once the timeout of the spec has passed. The
+// returned function stops the watch and turns the error of a killed command
+// into one saying it timed out.
+func (r RunSpec) watchTimeout(kill func()) func(err error) error {
+	if r.Timeout <= 0 {
+		return func(err error) error { return err }
+	}
+	var fired atomic.Bool
+	timer := time.AfterFunc(r.Timeout, func() {
+		fired.Store(true)
+		kill()
+	})
+	return func(err error) error {
+		timer.Stop()
+		if fired.Load() {
+			return fmt.Errorf("timed out after %v", r.Timeout)
+		}
+		return err
 	}
-	return result
 }
 
 // CommandFinishedMsg signals completion of command execution
-type CommandFinishedMsg struct{}
+type CommandFinishedMsg struct {
+	Command  string
+	ExitCode int
+	Started  time.Time
+	Finished time.Time
+	// Err is set when the command could not be executed at all
+	Err error
+	// Capture is set when the command ran with its output captured
+	Capture *Capture
+}
+
+// Duration returns how long the command ran
+func (msg CommandFinishedMsg) Duration() time.Duration {
+	return msg.Finished.Sub(msg.Started)
+}
+
+// Failed reports whether the command could not run or exited non-zero
+func (msg CommandFinishedMsg) Failed() bool {
+	return msg.Err != nil || msg.ExitCode != 0
+}
+
+// exitStatus splits the error returned by exec.Cmd.Wait into the exit code
+// and an error that is only set when the command could not be executed
+func exitStatus(err error) (int, error) {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return -1, err
+	}
+	return 0, nil
+}
+
+// terminalCommand runs a command on the real terminal and pauses afterwards
+// so the output can be read before the UI takes over the screen again
+type terminalCommand struct {
+	cmd      *exec.Cmd
+	spec     RunSpec
+	started  time.Time
+	finished time.Time
+	exitCode int
+	stdin    io.Reader
+	stdout   io.Writer
+}
+
+// SetStdin hands the terminal to the command unless it has its own stdin
+func (t *terminalCommand) SetStdin(r io.Reader) {
+	t.stdin = r
+	if t.cmd.Stdin == nil {
+		t.cmd.Stdin = r
+	}
+}
+func (t *terminalCommand) SetStdout(w io.Writer) { t.stdout = w; t.cmd.Stdout = w }
+func (t *terminalCommand) SetStderr(w io.Writer) { t.cmd.Stderr = w }
+
+func (t *terminalCommand) Run() error {
+	t.started = time.Now()
+	restore, err := startForeground(t.cmd, t.stdin)
+	if err != nil {
+		t.finished = t.started
+		t.exitCode = -1
+		return err
+	}
+	stop := t.spec.watchTimeout(func() { _ = signalProcessGroup(t.cmd, syscall.SIGKILL) })
+	exitCode, err := exitStatus(t.cmd.Wait())
+	restore()
+	timedOut := stop(nil)
+	t.finished = time.Now()
+	t.exitCode = exitCode
+	if err != nil {
+		return err
+	}
+	if timedOut != nil {
+		fmt.Fprintf(t.stdout, "\n✗ %v. Press Enter to continue...", timedOut)
+		_, _ = bufio.NewReader(t.stdin).ReadString('\n')
+		return timedOut
+	}
+
+	status := "✓ exited 0"
+	if exitCode != 0 {
+		status = fmt.Sprintf("✗ exited %d", exitCode)
+	}
+	fmt.Fprintf(t.stdout, "\n%s after %s. Press Enter to continue...", status, t.finished.Sub(t.started).Round(time.Millisecond))
+	_, _ = bufio.NewReader(t.stdin).ReadString('\n')
+	return nil
+}
 
 // RunCommandInTerminal executes command in terminal with user prompt to continue
-func RunCommandInTerminal(command string) tea.Cmd {
-	fullCommand := command + "; echo '\nPress Enter to continue...'; read"
-	return tea.ExecProcess(
-		exec.Command("sh", "-c", fullCommand),
-		func(err error) tea.Msg {
-			return CommandFinishedMsg{}
-		},
-	)
+func RunCommandInTerminal(spec RunSpec) tea.Cmd {
+	t := &terminalCommand{cmd: spec.cmd(), spec: spec}
+	return tea.Exec(t, func(err error) tea.Msg {
+		if t.started.IsZero() {
+			// The terminal could not be handed over, the command never ran
+			t.started = time.Now()
+			t.finished = t.started
+			t.exitCode = -1
+		}
+		return CommandFinishedMsg{
+			Command:  spec.String(),
+			ExitCode: t.exitCode,
+			Started:  t.started,
+			Finished: t.finished,
+			Err:      err,
+		}
+	})
+}
+
+// RunCommand executes command with the current process' stdio attached and
+// returns its exit code. The error is only set when the command could not be started.
+func RunCommand(spec RunSpec) (int, error) {
+	if len(spec.Steps) > 0 {
+		return runSteps(spec.Steps, os.Stdin, os.Stderr)
+	}
+	return runWith(spec, os.Stdin, os.Stdout, os.Stderr)
+}
+
+// runWith runs spec with the given stdio, see RunCommand. The stdin of the
+// spec takes precedence over stdin.
+func runWith(spec RunSpec, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	cmd := spec.cmd()
+	if cmd.Stdin == nil && stdin != nil {
+		cmd.Stdin = stdin
+	}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	restore, err := startForeground(cmd, stdin)
+	if err != nil {
+		return -1, err
+	}
+	defer restore()
+
+	// Interrupts sent to iz reach the command's process group as well
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer close(signals)
+	defer signal.Stop(signals)
+	go func() {
+		for sig := range signals {
+			_ = signalProcessGroup(cmd, sig.(syscall.Signal))
+		}
+	}()
+
+	stop := spec.watchTimeout(func() { _ = signalProcessGroup(cmd, syscall.SIGKILL) })
+	exitCode, err := exitStatus(cmd.Wait())
+	return exitCode, stop(err)
 }
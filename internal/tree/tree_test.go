@@ -0,0 +1,114 @@
+package tree
+
+import (
+	"slices"
+	"testing"
+)
+
+const redactConfig = `
+commands:
+  - name: Login
+    command: echo 1 prod {token} {env}
+    variables:
+      - name: token
+        secret: true
+      - name: env
+  - name: Curl
+    argv: [curl, -H, "Authorization: {token}", "{url}"]
+    variables:
+      - name: token
+        secret: true
+      - name: url
+  - name: Fish
+    shell: fish
+    command: echo 1 {token}
+    variables:
+      - name: token
+        secret: true
+  - name: Release
+    variables:
+      - name: token
+        secret: true
+      - name: note
+        remember: false
+    steps:
+      - name: Tag
+        command: tag {note}
+      - name: Push
+        command: push 1 {token}
+`
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		path   string
+		values map[string]string
+		// unrecorded masks the unrecorded variables instead of the secrets
+		unrecorded bool
+		want       string
+		wantArgv   []string
+	}{
+		{
+			path:   "Login",
+			values: map[string]string{"token": "1", "env": "prod"},
+			want:   "echo 1 prod '••••' prod",
+		},
+		{
+			path:   "Login",
+			values: map[string]string{"token": "prod", "env": "prod"},
+			want:   "echo 1 prod '••••' prod",
+		},
+		{
+			path:   "Login",
+			values: map[string]string{"token": "", "env": "1"},
+			want:   "echo 1 prod '' 1",
+		},
+		{
+			path:     "Curl",
+			values:   map[string]string{"token": "a", "url": "https://a.example"},
+			want:     "curl -H 'Authorization: ••••' https://a.example",
+			wantArgv: []string{"curl", "-H", "Authorization: ••••", "https://a.example"},
+		},
+		{
+			path:   "Fish",
+			values: map[string]string{"token": "1"},
+			want:   "echo 1 '••••'",
+		},
+		{
+			path:   "Release",
+			values: map[string]string{"token": "1", "note": "1"},
+			want:   "tag 1 && push 1 '••••'",
+		},
+		{
+			path:       "Release",
+			values:     map[string]string{"token": "1", "note": "1"},
+			unrecorded: true,
+			want:       "tag '••••' && push 1 '••••'",
+		},
+	}
+	root := buildTree(t, redactConfig)
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			node, err := FindNode(root, tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			spec, err := node.Expand(tt.values)
+			if err != nil {
+				t.Fatal(err)
+			}
+			spec.Dir = "/elsewhere"
+
+			redact := node.Redact
+			if tt.unrecorded {
+				redact = node.RedactUnrecorded
+			}
+			got := redact(spec, tt.values)
+			if got.String() != tt.want || !slices.Equal(got.Argv, tt.wantArgv) {
+				t.Errorf("redacted = %q %q, want %q %q", got.String(), got.Argv, tt.want, tt.wantArgv)
+			}
+			if got.Dir != spec.Dir {
+				t.Errorf("redacted dir = %q, want %q", got.Dir, spec.Dir)
+			}
+		})
+	}
+}
@@ -3,9 +3,13 @@ package ui
 import (
 	"github.com/charmbracelet/bubbles/help"
 	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmy/iz/internal/config"
+	"github.com/charmy/iz/internal/history"
+	"github.com/charmy/iz/internal/state"
 	"github.com/charmy/iz/internal/tree"
 )
 
@@ -16,20 +20,76 @@ type App struct {
 	Height int
 
 	// Navigation state
-	Cursor int
-	Tree   *tree.TreeNode
+	Cursor     int
+	TreeOffset int
+	Tree       *tree.TreeNode
+	Focus      Pane
+
+	// Scrollable details of the selected node
+	Details DetailsPane
 
 	// Dialog states
 	ShowConfirm    bool
 	ConfirmYes     bool
 	PendingCommand string
+	PendingSpec    tree.RunSpec
+	PendingMatrix  []MatrixRun
 	DefaultConfirm bool
 
+	// Captured output
+	CaptureOutput bool
+	Output        OutputPane
+
+	// Commands run in the background
+	Background bool
+	Jobs       []*Job
+	NextJob    int
+	ShowJobs   bool
+	JobsView   JobsView
+
+	// Error shown in the status bar until the next key press
+	StatusError string
+
+	// Result of the most recent run
+	RunningPath string
+	LastRun     *tree.CommandFinishedMsg
+	LastRunPath string
+
+	// Runs waiting to be recorded in the history, by capture. The run in the
+	// terminal has no capture.
+	Runs map[*tree.Capture]history.Entry
+
+	// Past runs. Recorded are the runs in the history file, most recent
+	// first, loaded once to rank the Recent folder.
+	ShowHistory bool
+	History     HistoryView
+	Recorded    []history.Entry
+
 	// Input handling
 	ShowInputs  bool
 	InputFields []InputField
 	InputCursor int
 	InputValues map[string]string
+	InputError  string
+	// Spinner turns while options are loaded
+	Spinner spinner.Model
+
+	// Filter over the whole tree
+	Filter FilterState
+
+	// Tree editing
+	ShowEdit bool
+	Edit     EditForm
+
+	// Config diagnostics
+	Diagnostics     []config.Diagnostic
+	ShowDiagnostics bool
+
+	// Watched config files
+	ConfigStamps map[string]fileStamp
+
+	// State kept between sessions
+	State *state.State
 
 	// Help system
 	ShowHelp bool
@@ -42,6 +102,18 @@ type InputField struct {
 	Name        string
 	Placeholder string
 	TextInput   textinput.Model
+	Optional    bool
+
+	// Variable is the configuration of the variable, nil when it has none.
+	// Error is why the value cannot be used, shown below the field.
+	Variable *config.VariableConfig
+	Error    string
+
+	// Values used in earlier runs, most recent first. HistoryIndex is the
+	// recalled value, -1 while showing Draft, the value typed or defaulted.
+	History      []string
+	HistoryIndex int
+	Draft        string
 
 	// Choice field support
 	IsChoice        bool
@@ -50,16 +122,53 @@ type InputField struct {
 	SelectedValue   string
 	ShowCustomInput bool
 	CustomInput     textinput.Model
+	// Multi holds the options picked with space, the command runs once for
+	// each of them, see matrixRuns
+	Multi []string
+
+	// Toggle field support, used for bool variables without options
+	IsToggle bool
+	Checked  bool
+
+	// Options loaded from a command: Loading until they arrive, LoadErr
+	// when they could not be loaded. Filter narrows down the options.
+	Loading bool
+	LoadErr string
+	Filter  string
+
+	// Fields referring to earlier ones: Hidden while the when condition does
+	// not hold, Default and OptionsCommand as last expanded. Touched is set
+	// once the user changed the value, defaults no longer replace it then.
+	Hidden         bool
+	Touched        bool
+	Default        string
+	OptionsCommand string
 }
 
 // KeyMap defines all keyboard shortcuts for the application
 type KeyMap struct {
-	Up    key.Binding
-	Down  key.Binding
-	Enter key.Binding
-	Back  key.Binding
-	Quit  key.Binding
-	Help  key.Binding
+	Up         key.Binding
+	Down       key.Binding
+	Page       key.Binding
+	Enter      key.Binding
+	Output     key.Binding
+	Switch     key.Binding
+	Search     key.Binding
+	Back       key.Binding
+	Quit       key.Binding
+	Help       key.Binding
+	Issues     key.Binding
+	History    key.Binding
+	Star       key.Binding
+	Background key.Binding
+	Jobs       key.Binding
+
+	// Tree editing
+	Add       key.Binding
+	Edit      key.Binding
+	Duplicate key.Binding
+	Delete    key.Binding
+	Move      key.Binding
 }
 
 // ShortHelp returns short help
@@ -70,8 +179,9 @@ func (k KeyMap) ShortHelp() []key.Binding {
 // FullHelp returns full help
 func (k KeyMap) FullHelp() [][]key.Binding {
 	return [][]key.Binding{
-		{k.Up, k.Down, k.Enter},
-		{k.Back, k.Help, k.Quit},
+		{k.Up, k.Down, k.Page, k.Enter, k.Output, k.Background, k.Jobs, k.History, k.Star},
+		{k.Switch, k.Search, k.Issues, k.Back, k.Help, k.Quit},
+		{k.Add, k.Edit, k.Duplicate, k.Delete, k.Move},
 	}
 }
 
@@ -91,10 +201,26 @@ func NewApp(treeRoot *tree.TreeNode, defaultConfirm bool) App {
 			key.WithKeys("down", "j"),
 			key.WithHelp("↓/j", "move down"),
 		),
+		Page: key.NewBinding(
+			key.WithKeys("pgup", "pgdown", "home", "end", "g", "G"),
+			key.WithHelp("pgup/pgdn/g/G", "page up/down, first/last"),
+		),
 		Enter: key.NewBinding(
 			key.WithKeys("enter", "r"),
 			key.WithHelp("enter/r", "run command"),
 		),
+		Output: key.NewBinding(
+			key.WithKeys("o"),
+			key.WithHelp("o", "run with output pane"),
+		),
+		Switch: key.NewBinding(
+			key.WithKeys("tab"),
+			key.WithHelp("tab", "switch pane"),
+		),
+		Search: key.NewBinding(
+			key.WithKeys("/"),
+			key.WithHelp("/", "filter commands/search output"),
+		),
 		Back: key.NewBinding(
 			key.WithKeys("esc"),
 			key.WithHelp("esc", "go back"),
@@ -103,10 +229,50 @@ func NewApp(treeRoot *tree.TreeNode, defaultConfirm bool) App {
 			key.WithKeys("?"),
 			key.WithHelp("?", "toggle help"),
 		),
+		Issues: key.NewBinding(
+			key.WithKeys("!"),
+			key.WithHelp("!", "config problems"),
+		),
+		Background: key.NewBinding(
+			key.WithKeys("b"),
+			key.WithHelp("b", "run in background"),
+		),
+		Jobs: key.NewBinding(
+			key.WithKeys("B"),
+			key.WithHelp("B", "background jobs"),
+		),
+		History: key.NewBinding(
+			key.WithKeys("H"),
+			key.WithHelp("H", "run history"),
+		),
+		Star: key.NewBinding(
+			key.WithKeys("s"),
+			key.WithHelp("s", "star/unstar command"),
+		),
 		Quit: key.NewBinding(
 			key.WithKeys("esc", "ctrl+c"),
 			key.WithHelp("esc", "quit"),
 		),
+		Add: key.NewBinding(
+			key.WithKeys("a", "A"),
+			key.WithHelp("a/A", "add command/folder"),
+		),
+		Edit: key.NewBinding(
+			key.WithKeys("E", "R"),
+			key.WithHelp("E/R", "edit/rename"),
+		),
+		Duplicate: key.NewBinding(
+			key.WithKeys("y"),
+			key.WithHelp("y", "duplicate"),
+		),
+		Delete: key.NewBinding(
+			key.WithKeys("D"),
+			key.WithHelp("D", "delete"),
+		),
+		Move: key.NewBinding(
+			key.WithKeys("K", "J", ">", "<"),
+			key.WithHelp("K/J/>/<", "move up/down/in/out"),
+		),
 	}
 
 	return App{
@@ -114,6 +280,12 @@ func NewApp(treeRoot *tree.TreeNode, defaultConfirm bool) App {
 		Cursor:         0,
 		DefaultConfirm: defaultConfirm,
 		InputValues:    make(map[string]string),
+		Output:         newOutputPane(),
+		JobsView:       JobsView{Viewport: viewport.New(0, 0)},
+		Runs:           make(map[*tree.Capture]history.Entry),
+		Spinner:        spinner.New(spinner.WithSpinner(spinner.Dot)),
+		Details:        DetailsPane{Viewport: viewport.New(0, 0)},
+		Filter:         FilterState{Input: newFilterInput()},
 		Help:           h,
 		Keys:           keys,
 	}
@@ -121,5 +293,9 @@ func NewApp(treeRoot *tree.TreeNode, defaultConfirm bool) App {
 
 // Init initializes the application
 func (m App) Init() tea.Cmd {
-	return nil
+	if m.Filter.Active {
+		// A filter restored from the last session starts with a blinking cursor
+		return tea.Batch(watchConfig(), textinput.Blink)
+	}
+	return watchConfig()
 }
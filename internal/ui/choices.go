@@ -0,0 +1,254 @@
+package ui
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmy/iz/internal/config"
+	"github.com/charmy/iz/internal/fuzzy"
+	"github.com/charmy/iz/internal/options"
+)
+
+// maxChoiceRows limits how many options of a choice field are shown at once
+const maxChoiceRows = 8
+
+// optionsLoadedMsg carries the options loaded by Command for variable Name of
+// the command at Path
+type optionsLoadedMsg struct {
+	Path    string
+	Name    string
+	Command string
+	Options []config.VariableOption
+	Err     error
+}
+
+// loadOptions runs the options command of a variable in the background
+func loadOptions(path, name string, src config.OptionsSource) tea.Cmd {
+	return func() tea.Msg {
+		loaded, err := options.Load(src)
+		return optionsLoadedMsg{Path: path, Name: name, Command: src.Command, Options: loaded, Err: err}
+	}
+}
+
+// applyOptions fills loaded options into the field waiting for them, ahead of
+// the options listed in the config, and updates the fields depending on it
+func (m App) applyOptions(msg optionsLoadedMsg) (App, tea.Cmd) {
+	node := m.selectedNode()
+	if !m.ShowInputs || node == nil || node.Path != msg.Path {
+		return m, nil
+	}
+
+	for i := range m.InputFields {
+		f := &m.InputFields[i]
+		// Options of a command that has since changed are dropped
+		if f.Name != msg.Name || !f.Loading || f.OptionsCommand != msg.Command {
+			continue
+		}
+		f.Loading = false
+		if msg.Err != nil {
+			f.LoadErr = msg.Err.Error()
+		}
+		f.Options = append(slices.Clone(msg.Options), f.Variable.Options...)
+
+		if len(f.Options) == 0 {
+			// Nothing to choose from, the value is typed instead
+			f.IsChoice = false
+			f.setValue(f.Draft)
+			if i == m.InputCursor {
+				f.TextInput.Focus()
+			}
+			continue
+		}
+		f.IsChoice = true
+		// Picked options that are gone with the new ones are dropped
+		f.Multi = slices.DeleteFunc(f.Multi, func(value string) bool {
+			return !slices.ContainsFunc(f.Options, func(o config.VariableOption) bool { return o.Value == value })
+		})
+		f.selectChoice(0)
+		if f.Draft != "" {
+			f.setValue(f.Draft)
+		}
+		if i != m.InputCursor {
+			f.CustomInput.Blur()
+		}
+	}
+	cmd := m.resolveFields(false, false)
+	return m, cmd
+}
+
+// loadingOptions reports whether any field still waits for its options
+func (m App) loadingOptions() bool {
+	for _, f := range m.InputFields {
+		if f.Loading {
+			return true
+		}
+	}
+	return false
+}
+
+// visibleChoices returns the indexes of the options matching the filter, best match first
+func (f InputField) visibleChoices() []int {
+	type match struct{ index, score int }
+	var matches []match
+	for i, option := range f.Options {
+		if f.Filter == "" {
+			matches = append(matches, match{i, 0})
+			continue
+		}
+		score, _, ok := fuzzy.Match(f.Filter, option.Label)
+		if valueScore, _, valueOK := fuzzy.Match(f.Filter, option.Value); valueOK && (!ok || valueScore > score) {
+			score, ok = valueScore, true
+		}
+		if ok {
+			matches = append(matches, match{i, score})
+		}
+	}
+	sort.SliceStable(matches, func(a, b int) bool {
+		return matches[a].score > matches[b].score
+	})
+
+	visible := make([]int, len(matches))
+	for i, match := range matches {
+		visible[i] = match.index
+	}
+	return visible
+}
+
+// selectChoice selects the i-th option, showing the custom input for "custom"
+func (f *InputField) selectChoice(i int) {
+	f.Choice = i
+	f.SelectedValue = f.Options[i].Value
+	if f.SelectedValue == "custom" {
+		f.ShowCustomInput = true
+		f.CustomInput.Focus()
+	} else {
+		f.ShowCustomInput = false
+		f.CustomInput.Blur()
+	}
+}
+
+// moveChoice selects the next (delta 1) or previous (delta -1) option matching
+// the filter and reports whether there was one
+func (f *InputField) moveChoice(delta int) bool {
+	visible := f.visibleChoices()
+	next := slices.Index(visible, f.Choice) + delta
+	if !slices.Contains(visible, f.Choice) {
+		next = 0
+	}
+	if next < 0 || next >= len(visible) {
+		return false
+	}
+	f.selectChoice(visible[next])
+	return true
+}
+
+// toggleMulti picks the highlighted option to run the command with, next to
+// the others picked, or takes it out again. Custom values cannot be picked.
+func (f *InputField) toggleMulti() {
+	if f.SelectedValue == "custom" {
+		return
+	}
+	if i := slices.Index(f.Multi, f.SelectedValue); i >= 0 {
+		f.Multi = slices.Delete(f.Multi, i, i+1)
+		return
+	}
+	f.Multi = append(f.Multi, f.SelectedValue)
+	// Runs follow the order of the options
+	index := func(value string) int {
+		return slices.IndexFunc(f.Options, func(o config.VariableOption) bool { return o.Value == value })
+	}
+	slices.SortFunc(f.Multi, func(a, b string) int { return index(a) - index(b) })
+}
+
+// values returns the values the command runs with: the picked options or the
+// single value of the field
+func (f InputField) values() []string {
+	if f.IsChoice && len(f.Multi) > 0 {
+		return f.Multi
+	}
+	return []string{f.Value()}
+}
+
+// setFilter narrows down the options and selects the best match
+func (f *InputField) setFilter(filter string) {
+	f.Filter = filter
+	if visible := f.visibleChoices(); len(visible) > 0 && (filter != "" || !slices.Contains(visible, f.Choice)) {
+		f.selectChoice(visible[0])
+	}
+}
+
+// renderChoices renders the options of a choice field around the selected one
+func (m App) renderChoices(field InputField, current bool, width int) string {
+	if field.Loading {
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("240")).
+			Render(m.Spinner.View() + "loading options…")
+	}
+
+	var lines []string
+	if field.Filter != "" {
+		lines = append(lines, lipgloss.NewStyle().Foreground(lipgloss.Color("214")).Render("filter: "+field.Filter))
+	}
+
+	visible := field.visibleChoices()
+	if len(visible) == 0 {
+		lines = append(lines, lipgloss.NewStyle().Foreground(lipgloss.Color("240")).Render("no matching options"))
+		return strings.Join(lines, "\n")
+	}
+
+	// Keep the selected option in the middle of the window
+	start := 0
+	if pos := slices.Index(visible, field.Choice); pos >= maxChoiceRows/2 {
+		start = min(pos-maxChoiceRows/2, max(len(visible)-maxChoiceRows, 0))
+	}
+	end := min(start+maxChoiceRows, len(visible))
+
+	for _, j := range visible[start:end] {
+		option := field.Options[j]
+		style := lipgloss.NewStyle().MaxWidth(width)
+		label := option.Label
+
+		// If this is the custom option and we have a custom value, show it
+		if option.Value == "custom" && field.CustomInput.Value() != "" {
+			label = fmt.Sprintf("Custom: %s", field.CustomInput.Value())
+		}
+
+		picked := slices.Contains(field.Multi, option.Value)
+		if j == field.Choice {
+			if current && !field.ShowCustomInput {
+				// Active choice, current field
+				style = style.Foreground(lipgloss.Color("0")).Background(lipgloss.Color("39")).Bold(true)
+			} else {
+				// Selected choice, inactive field
+				style = style.Foreground(lipgloss.Color("39")).Bold(true)
+			}
+		} else if picked {
+			style = style.Foreground(lipgloss.Color("39"))
+		} else {
+			style = style.Foreground(lipgloss.Color("240"))
+		}
+
+		marker := "○"
+		switch {
+		case len(field.Multi) > 0 && picked:
+			marker = "[x]"
+		case len(field.Multi) > 0:
+			marker = "[ ]"
+		case j == field.Choice:
+			marker = "●"
+		}
+		lines = append(lines, style.Render(fmt.Sprintf("%s %s", marker, label)))
+	}
+	if hidden := len(visible) - (end - start); hidden > 0 {
+		lines = append(lines, lipgloss.NewStyle().Foreground(lipgloss.Color("240")).
+			Render(fmt.Sprintf("%d of %d shown, type to filter", end-start, len(visible))))
+	}
+	if len(field.Multi) > 0 {
+		lines = append(lines, lipgloss.NewStyle().Foreground(lipgloss.Color("39")).
+			Render(fmt.Sprintf("%d picked, one run each", len(field.Multi))))
+	}
+	return strings.Join(lines, "\n")
+}
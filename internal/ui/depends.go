@@ -0,0 +1,181 @@
+package ui
+
+import (
+	"slices"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmy/iz/internal/config"
+)
+
+// handleInputKeys handles a key in the input dialog and updates the fields
+// that depend on a value the key changed
+func (m App) handleInputKeys(msg tea.Msg) (App, tea.Cmd) {
+	cursor := m.InputCursor
+	before := make([]string, len(m.InputFields))
+	for i, f := range m.InputFields {
+		before[i] = f.Value()
+	}
+
+	m, cmd := m.handleInputKey(msg)
+	if !m.ShowInputs || len(m.InputFields) != len(before) {
+		return m, cmd
+	}
+
+	changed := false
+	for i := range m.InputFields {
+		if m.InputFields[i].Value() != before[i] {
+			// Values the user picked are no longer replaced by defaults
+			m.InputFields[i].Touched = true
+			changed = true
+		}
+	}
+	if changed {
+		// Options depending on a value wait until typing paused
+		cmd = tea.Batch(cmd, m.resolveFields(false, true))
+	}
+	m.skipHidden(m.InputCursor - cursor)
+	return m, cmd
+}
+
+// resolveFields updates the fields that refer to earlier ones: whether they
+// are asked for, their defaults and their options. On the initial pass values
+// remembered from earlier runs are kept. It returns the commands loading
+// options, which only start after optionsDebounce when debounce is set.
+func (m *App) resolveFields(initial, debounce bool) tea.Cmd {
+	node := m.selectedNode()
+	if node == nil {
+		return nil
+	}
+
+	values := make(map[string]string)
+	// Fields still loading their options have no value yet
+	pending := make(map[string]bool)
+	var cmds []tea.Cmd
+	for i := range m.InputFields {
+		f := &m.InputFields[i]
+		v := f.Variable
+		if v == nil {
+			values[f.Name] = f.Value()
+			continue
+		}
+
+		waiting := slices.ContainsFunc(v.References(), func(name string) bool { return pending[name] })
+		f.Hidden = !waiting && !v.Active(values)
+		if f.Hidden {
+			f.Error = ""
+			continue
+		}
+
+		if v.OptionsFrom != nil {
+			command, err := v.ExpandOptionsCommand(values)
+			switch {
+			case waiting:
+				// Loaded once the options it refers to are in
+				f.Loading, f.OptionsCommand = true, ""
+			case err == nil && command != f.OptionsCommand:
+				if !f.Loading && f.Value() != "" {
+					// Kept when it is among the new options
+					f.Draft = f.Value()
+				}
+				f.Loading, f.OptionsCommand, f.LoadErr = true, command, ""
+				src := *v.OptionsFrom
+				src.Command = command
+				if debounce {
+					cmds = append(cmds, debounceOptions(node.Path, f.Name, src))
+				} else {
+					cmds = append(cmds, loadOptions(node.Path, f.Name, src))
+				}
+			}
+		}
+
+		if def := v.ExpandDefault(values); def != f.Default && !waiting {
+			if !f.Touched && !(initial && len(f.History) > 0) {
+				f.setValue(def)
+			}
+			f.Default = def
+		}
+
+		if f.Loading {
+			pending[f.Name] = true
+			continue
+		}
+		values[f.Name] = f.Value()
+	}
+
+	if len(cmds) > 0 {
+		cmds = append(cmds, m.Spinner.Tick)
+	}
+	return tea.Batch(cmds...)
+}
+
+// optionsDebounce is how long typing has to pause before the options
+// depending on the typed value are loaded
+const optionsDebounce = 300 * time.Millisecond
+
+// optionsDueMsg asks to load the options of variable Name of the command at
+// Path once typing paused
+type optionsDueMsg struct {
+	Path   string
+	Name   string
+	Source config.OptionsSource
+}
+
+// debounceOptions loads the options of a variable after optionsDebounce
+func debounceOptions(path, name string, src config.OptionsSource) tea.Cmd {
+	return tea.Tick(optionsDebounce, func(time.Time) tea.Msg {
+		return optionsDueMsg{Path: path, Name: name, Source: src}
+	})
+}
+
+// loadDueOptions loads the options of the field once typing paused, unless
+// its options command changed in the meantime
+func (m App) loadDueOptions(msg optionsDueMsg) (App, tea.Cmd) {
+	node := m.selectedNode()
+	if !m.ShowInputs || node == nil || node.Path != msg.Path {
+		return m, nil
+	}
+	for _, f := range m.InputFields {
+		if f.Name == msg.Name && f.Loading && f.OptionsCommand == msg.Source.Command {
+			return m, loadOptions(msg.Path, msg.Name, msg.Source)
+		}
+	}
+	return m, nil
+}
+
+// skipHidden moves the cursor off fields whose condition does not hold, in
+// the direction it last moved
+func (m *App) skipHidden(direction int) {
+	if len(m.InputFields) == 0 || !m.InputFields[m.InputCursor].Hidden {
+		return
+	}
+	step := 1
+	if direction < 0 {
+		step = -1
+	}
+	for _, s := range []int{step, -step} {
+		for i := m.InputCursor + s; i >= 0 && i < len(m.InputFields); i += s {
+			if !m.InputFields[i].Hidden {
+				m.InputFields[m.InputCursor].blur()
+				m.InputCursor = i
+				m.InputFields[i].focus()
+				return
+			}
+		}
+	}
+}
+
+// focus focuses the input of the field that takes typed text
+func (f *InputField) focus() {
+	if !f.IsChoice {
+		f.TextInput.Focus()
+	} else if f.ShowCustomInput {
+		f.CustomInput.Focus()
+	}
+}
+
+// blur removes the focus from the inputs of the field
+func (f *InputField) blur() {
+	f.TextInput.Blur()
+	f.CustomInput.Blur()
+}
@@ -5,6 +5,8 @@ import (
 	"strings"
 
 	"github.com/charmbracelet/lipgloss"
+	"github.com/charmy/iz/internal/config"
+	"github.com/charmy/iz/internal/tree"
 )
 
 func (m App) renderWithConfirmDialog(mainView string) string {
@@ -27,9 +29,13 @@ func (m App) renderWithConfirmDialog(mainView string) string {
 		Padding(0, 1).
 		Render("Run Command?")
 
-	commandText := "Unknown command"
-	if m.Cursor < len(visibleNodes) && visibleNodes[m.Cursor].Command != "" {
-		commandText = visibleNodes[m.Cursor].Command
+	// Secret values are masked, they were typed into a password field
+	commandText := m.PendingSpec.String()
+	if node, err := m.selectedPlan(); err == nil && node != nil {
+		commandText = node.Redact(m.PendingSpec, m.InputValues).String()
+	}
+	if len(m.PendingMatrix) > 1 {
+		commandText += fmt.Sprintf("  (×%d runs)", len(m.PendingMatrix))
 	}
 
 	nameText := lipgloss.NewStyle().
@@ -102,7 +108,15 @@ func (m App) renderWithConfirmDialog(mainView string) string {
 
 func (m App) renderWithInputDialog(mainView string) string {
 	dialogWidth := 60
-	dialogHeight := 6 + len(m.InputFields)*2
+	dialogHeight := 6
+	for _, field := range m.InputFields {
+		if !field.Hidden {
+			dialogHeight += 2
+		}
+		if field.Error != "" {
+			dialogHeight++
+		}
+	}
 
 	// Create dialog content
 	visibleNodes := m.getVisibleNodes()
@@ -136,40 +150,25 @@ func (m App) renderWithInputDialog(mainView string) string {
 
 	var inputs []string
 	for i, field := range m.InputFields {
+		if field.Hidden {
+			continue
+		}
 		label := lipgloss.NewStyle().
 			Foreground(lipgloss.Color("214")).
 			Bold(true).
 			Width(dialogWidth - 8).
 			Render(fmt.Sprintf("%s:", field.Name))
+		if field.fromHistory() {
+			label = lipgloss.JoinHorizontal(lipgloss.Top,
+				lipgloss.NewStyle().Foreground(lipgloss.Color("214")).Bold(true).Render(field.Name+":"),
+				lipgloss.NewStyle().Foreground(lipgloss.Color("240")).Italic(true).Width(dialogWidth-9-len(field.Name)).Render(" ↺ last used"))
+		}
 
 		inputs = append(inputs, label)
 
 		if field.IsChoice {
 			// Render choice selector
-			var choices []string
-			for j, option := range field.Options {
-				style := lipgloss.NewStyle()
-				label := option.Label
-
-				// If this is the custom option and we have a custom value, show it
-				if option.Value == "custom" && field.CustomInput.Value() != "" {
-					label = fmt.Sprintf("Custom: %s", field.CustomInput.Value())
-				}
-
-				if j == field.Choice {
-					if i == m.InputCursor && !field.ShowCustomInput {
-						// Active choice, current field
-						style = style.Foreground(lipgloss.Color("0")).Background(lipgloss.Color("39")).Bold(true)
-					} else {
-						// Selected choice, inactive field
-						style = style.Foreground(lipgloss.Color("39")).Bold(true)
-					}
-					choices = append(choices, style.Render(fmt.Sprintf("● %s", label)))
-				} else {
-					style = style.Foreground(lipgloss.Color("240"))
-					choices = append(choices, style.Render(fmt.Sprintf("○ %s", label)))
-				}
-			}
+			choices := m.renderChoices(field, i == m.InputCursor, dialogWidth-12)
 
 			choiceStyle := lipgloss.NewStyle().
 				Width(dialogWidth-8).
@@ -182,16 +181,64 @@ func (m App) renderWithInputDialog(mainView string) string {
 				choiceStyle = choiceStyle.BorderForeground(lipgloss.Color("240"))
 			}
 
-			inputs = append(inputs, choiceStyle.Render(strings.Join(choices, "\n")))
+			inputs = append(inputs, choiceStyle.Render(choices))
 
 			// Show custom input if "custom" is selected
 			if field.ShowCustomInput {
 				inputs = append(inputs, field.CustomInput.View())
 			}
+		} else if field.IsToggle {
+			// Render toggle
+			box := "[ ] false"
+			if field.Checked {
+				box = "[x] true"
+			}
+			style := lipgloss.NewStyle().Foreground(lipgloss.Color("240"))
+			if i == m.InputCursor {
+				style = lipgloss.NewStyle().Foreground(lipgloss.Color("0")).Background(lipgloss.Color("39")).Bold(true)
+			} else if field.Checked {
+				style = lipgloss.NewStyle().Foreground(lipgloss.Color("39")).Bold(true)
+			}
+			inputs = append(inputs, lipgloss.NewStyle().Width(dialogWidth-8).Render(style.Render(box)))
 		} else {
 			// Render text input
 			inputs = append(inputs, field.TextInput.View())
 		}
+
+		if field.LoadErr != "" {
+			message := "could not load options: " + field.LoadErr
+			if !field.IsChoice {
+				message += ", enter a value instead"
+			}
+			inputs = append(inputs, lipgloss.NewStyle().
+				Foreground(lipgloss.Color("196")).
+				Width(dialogWidth-8).
+				Render("✗ "+message))
+		}
+		if field.Error != "" {
+			inputs = append(inputs, lipgloss.NewStyle().
+				Foreground(lipgloss.Color("196")).
+				Width(dialogWidth-8).
+				Render("✗ "+field.Error))
+		}
+	}
+
+	if runs := m.fanOutCount(); runs > 1 {
+		concurrency := tree.DefaultConcurrency
+		if node, err := m.selectedPlan(); err == nil && node != nil && node.Concurrency > 0 {
+			concurrency = node.Concurrency
+		}
+		inputs = append(inputs, "", lipgloss.NewStyle().
+			Foreground(lipgloss.Color("39")).
+			Width(dialogWidth-8).
+			Render(fmt.Sprintf("→ %d runs, up to %d at once", runs, concurrency)))
+	}
+
+	if m.InputError != "" {
+		inputs = append(inputs, "", lipgloss.NewStyle().
+			Foreground(lipgloss.Color("196")).
+			Width(dialogWidth-8).
+			Render("✗ "+m.InputError))
 	}
 
 	dialogContent := lipgloss.JoinVertical(
@@ -277,3 +324,162 @@ func (m App) renderWithHelpDialog(mainView string) string {
 	// Combine dialog and status bar
 	return lipgloss.JoinVertical(lipgloss.Left, dialogOverlay, m.renderStatusBar())
 }
+
+func (m App) renderWithDiagnosticsDialog(mainView string) string {
+	errorStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("196")).Bold(true)
+	warningStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("214")).Bold(true)
+	locationStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("240"))
+
+	// Leave room for the border, padding, title and footer
+	maxLines := max(m.Height-14, 1)
+
+	var lines []string
+	for i, d := range m.Diagnostics {
+		if i == maxLines {
+			lines = append(lines, locationStyle.Render(fmt.Sprintf("… and %d more, run `iz validate` to see all", len(m.Diagnostics)-i)))
+			break
+		}
+		severity := warningStyle.Render("warning")
+		if d.Severity == config.SeverityError {
+			severity = errorStyle.Render("error")
+		}
+		location := shortenPath(d.File)
+		if d.Line > 0 {
+			location = fmt.Sprintf("%s:%d", location, d.Line)
+		}
+		lines = append(lines, fmt.Sprintf("%s %s %s", severity, locationStyle.Render(location), d.Message))
+	}
+
+	subtitle := "Warnings were found in your config"
+	if config.HasErrors(m.Diagnostics) {
+		subtitle = "Fix these problems in your config, it is reloaded when saved"
+	}
+
+	diagnosticsStyle := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(lipgloss.Color("196")).
+		Padding(1, 2).
+		Width(m.Width - 4)
+
+	diagnosticsContent := lipgloss.JoinVertical(lipgloss.Left,
+		lipgloss.NewStyle().
+			Bold(true).
+			Foreground(lipgloss.Color("205")).
+			Render("⚠ Config problems"),
+		lipgloss.NewStyle().
+			Foreground(lipgloss.Color("250")).
+			Render(subtitle),
+		"",
+		strings.Join(lines, "\n"),
+		"",
+		lipgloss.NewStyle().
+			Foreground(lipgloss.Color("240")).
+			Italic(true).
+			Render("Press ! or Esc to close"),
+	)
+
+	diagnosticsBox := diagnosticsStyle.Render(diagnosticsContent)
+
+	// Create dialog with status bar
+	dialogWithStatusHeight := m.Height - 3 // Leave space for status bar
+	dialogOverlay := lipgloss.Place(
+		m.Width, dialogWithStatusHeight,
+		lipgloss.Center, lipgloss.Center,
+		diagnosticsBox,
+		lipgloss.WithWhitespaceBackground(lipgloss.Color("234")),
+		lipgloss.WithWhitespaceForeground(lipgloss.Color("240")),
+	)
+
+	// Combine dialog and status bar
+	return lipgloss.JoinVertical(lipgloss.Left, dialogOverlay, m.renderStatusBar())
+}
+
+func (m App) renderWithEditDialog(mainView string) string {
+	dialogWidth := 60
+	dialogHeight := 6 + len(m.Edit.Fields)*2
+
+	title := lipgloss.NewStyle().
+		Bold(true).
+		Foreground(lipgloss.Color("205")).
+		Align(lipgloss.Center).
+		Width(dialogWidth-4).
+		Padding(0, 1).
+		Render(m.Edit.Title)
+
+	var body []string
+	if m.Edit.Message != "" {
+		body = append(body, lipgloss.NewStyle().
+			Foreground(lipgloss.Color("250")).
+			Width(dialogWidth-8).
+			Render(m.Edit.Message), "")
+	}
+
+	for i, field := range m.Edit.Fields {
+		body = append(body, lipgloss.NewStyle().
+			Foreground(lipgloss.Color("214")).
+			Bold(true).
+			Render(fmt.Sprintf("%s:", field.Label)))
+
+		if field.Choices == nil {
+			body = append(body, field.Input.View())
+			continue
+		}
+
+		var choices []string
+		for j, choice := range field.Choices {
+			style := lipgloss.NewStyle().Foreground(lipgloss.Color("240"))
+			marker := "○"
+			if j == field.Choice {
+				marker = "●"
+				style = style.Foreground(lipgloss.Color("39")).Bold(true)
+				if i == m.Edit.Cursor {
+					style = style.Foreground(lipgloss.Color("0")).Background(lipgloss.Color("39"))
+				}
+			}
+			choices = append(choices, style.Render(fmt.Sprintf("%s %s", marker, choice)))
+		}
+		body = append(body, strings.Join(choices, "  "))
+	}
+
+	if m.Edit.Error != "" {
+		body = append(body, "", lipgloss.NewStyle().
+			Foreground(lipgloss.Color("196")).
+			Width(dialogWidth-8).
+			Render("✗ "+m.Edit.Error))
+	}
+
+	source := shortenPath(m.Edit.Node.Source)
+	body = append(body, "", lipgloss.NewStyle().
+		Foreground(lipgloss.Color("240")).
+		Render(fmt.Sprintf("📄 %s", source)))
+
+	dialogContent := lipgloss.JoinVertical(
+		lipgloss.Left,
+		title,
+		"",
+		strings.Join(body, "\n"),
+	)
+
+	// Create dialog box
+	dialogStyle := lipgloss.NewStyle().
+		Width(dialogWidth).
+		Height(dialogHeight).
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(lipgloss.Color("63")).
+		Padding(1)
+
+	dialog := dialogStyle.Render(dialogContent)
+
+	// Create dialog with status bar
+	dialogWithStatusHeight := m.Height - 3 // Leave space for status bar
+	dialogOverlay := lipgloss.Place(
+		m.Width, dialogWithStatusHeight,
+		lipgloss.Center, lipgloss.Center,
+		dialog,
+		lipgloss.WithWhitespaceBackground(lipgloss.Color("234")),
+		lipgloss.WithWhitespaceForeground(lipgloss.Color("240")),
+	)
+
+	// Combine dialog and status bar
+	return lipgloss.JoinVertical(lipgloss.Left, dialogOverlay, m.renderStatusBar())
+}
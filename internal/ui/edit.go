@@ -0,0 +1,412 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmy/iz/internal/config"
+	"github.com/charmy/iz/internal/tree"
+)
+
+// editAction identifies what an edit form does when submitted
+type editAction int
+
+const (
+	editAddCommand editAction = iota
+	editAddFolder
+	editRename
+	editNode
+	editDelete
+)
+
+// EditForm is the dialog used to change the command tree
+type EditForm struct {
+	Action  editAction
+	Node    *tree.TreeNode
+	Title   string
+	Message string
+	Fields  []EditField
+	Cursor  int
+	Error   string
+}
+
+// EditField is a text input or, when Choices is set, a selection changed with ←/→
+type EditField struct {
+	Key     string
+	Label   string
+	Input   textinput.Model
+	Choices []string
+	Choice  int
+}
+
+// Value returns the entered or selected value
+func (f EditField) Value() string {
+	if f.Choices != nil {
+		return f.Choices[f.Choice]
+	}
+	return strings.TrimSpace(f.Input.Value())
+}
+
+// confirmChoices are the choices of the confirm field, "default" removes the setting
+var confirmChoices = []string{"default", "yes", "no"}
+
+// treeEdit changes the document defining node and returns the path to select afterwards
+type treeEdit func(doc *config.Document, node, parent *tree.TreeNode) (string, error)
+
+func newEditField(key, label, value string) EditField {
+	input := textinput.New()
+	input.Placeholder = label
+	input.Width = 44
+	input.SetValue(value)
+	return EditField{Key: key, Label: label, Input: input}
+}
+
+// openEditForm shows the form for action on the selected node
+func (m App) openEditForm(action editAction) (App, tea.Cmd) {
+	node := m.shortcutTarget(m.selectedNode())
+	if node == nil {
+		return m, nil
+	}
+	if node.Source == "" {
+		m.StatusError = fmt.Sprintf("%q is not defined in a config file", node.Name)
+		return m, nil
+	}
+
+	form := EditForm{Action: action, Node: node}
+	switch action {
+	case editAddCommand:
+		form.Title = "Add Command"
+		form.Fields = []EditField{
+			newEditField("name", "Name", ""),
+			newEditField("command", "Command", ""),
+			newEditField("description", "Description", ""),
+		}
+	case editAddFolder:
+		form.Title = "Add Folder"
+		form.Fields = []EditField{
+			newEditField("name", "Name", ""),
+			newEditField("description", "Description", ""),
+		}
+	case editRename:
+		form.Title = "Rename"
+		form.Fields = []EditField{newEditField("name", "Name", node.Name)}
+	case editNode:
+		// Read the raw values, the tree only has them with defaults applied
+		doc, err := config.OpenDocument(node.Source)
+		if err != nil {
+			m.StatusError = err.Error()
+			return m, nil
+		}
+		description, err := doc.Get(node.Line, "description")
+		if err != nil {
+			m.StatusError = err.Error()
+			return m, nil
+		}
+
+		form.Title = "Edit"
+		form.Fields = []EditField{newEditField("name", "Name", node.Name)}
+		if !node.IsFolder && len(node.Argv) == 0 && len(node.Steps) == 0 {
+			command, _ := doc.Get(node.Line, "command")
+			form.Fields = append(form.Fields, newEditField("command", "Command", command))
+		}
+		form.Fields = append(form.Fields, newEditField("description", "Description", description))
+		if !node.IsFolder {
+			confirm, _ := doc.Get(node.Line, "confirm")
+			field := EditField{Key: "confirm", Label: "Confirm before running", Choices: confirmChoices}
+			switch confirm {
+			case "true":
+				field.Choice = 1
+			case "false":
+				field.Choice = 2
+			}
+			form.Fields = append(form.Fields, field)
+		}
+		if len(node.Argv) > 0 {
+			form.Message = "argv commands are edited in the config file (e)"
+		} else if len(node.Steps) > 0 {
+			form.Message = "steps are edited in the config file (e)"
+		}
+	case editDelete:
+		if node.Line == 0 {
+			m.StatusError = fmt.Sprintf("%q is the top level of a config file and cannot be deleted", node.Name)
+			return m, nil
+		}
+		form.Title = "Delete"
+		form.Message = fmt.Sprintf("Delete %q?", node.Name)
+		if node.IsFolder {
+			form.Message = fmt.Sprintf("Delete folder %q and the %d item(s) in it?", node.Name, len(node.Children))
+		}
+	}
+
+	m.Edit = form
+	m.ShowEdit = true
+	return m, m.Edit.focus(0)
+}
+
+// focus moves the form cursor to field i
+func (f *EditForm) focus(i int) tea.Cmd {
+	if len(f.Fields) == 0 {
+		return nil
+	}
+	f.Cursor = max(0, min(i, len(f.Fields)-1))
+	var cmd tea.Cmd
+	for j := range f.Fields {
+		if j == f.Cursor && f.Fields[j].Choices == nil {
+			cmd = f.Fields[j].Input.Focus()
+		} else {
+			f.Fields[j].Input.Blur()
+		}
+	}
+	return cmd
+}
+
+func (m App) handleEditKeys(msg tea.KeyMsg) (App, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.ShowEdit = false
+		return m, nil
+	case "enter":
+		return m.submitEdit()
+	case "tab", "down":
+		return m, m.Edit.focus(m.Edit.Cursor + 1)
+	case "shift+tab", "up":
+		return m, m.Edit.focus(m.Edit.Cursor - 1)
+	}
+
+	if len(m.Edit.Fields) == 0 {
+		return m, nil
+	}
+	field := &m.Edit.Fields[m.Edit.Cursor]
+	if field.Choices != nil {
+		switch msg.String() {
+		case "left", "h":
+			field.Choice = (field.Choice + len(field.Choices) - 1) % len(field.Choices)
+		case "right", "l", " ":
+			field.Choice = (field.Choice + 1) % len(field.Choices)
+		}
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	field.Input, cmd = field.Input.Update(msg)
+	return m, cmd
+}
+
+// submitEdit validates the form and writes the change to the config
+func (m App) submitEdit() (App, tea.Cmd) {
+	form := m.Edit
+	values := make(map[string]string)
+	for _, field := range form.Fields {
+		values[field.Key] = field.Value()
+	}
+
+	if name, ok := values["name"]; ok {
+		switch {
+		case name == "":
+			m.Edit.Error = "a name is required"
+			return m, nil
+		case strings.Contains(name, "/"):
+			m.Edit.Error = "names cannot contain /"
+			return m, nil
+		}
+	}
+	if form.Action == editAddCommand && values["command"] == "" {
+		m.Edit.Error = "a command is required"
+		return m, nil
+	}
+
+	var edit treeEdit
+	switch form.Action {
+	case editAddCommand, editAddFolder:
+		edit = func(doc *config.Document, node, parent *tree.TreeNode) (string, error) {
+			// New commands go into a selected folder or after a selected command
+			folder, into := node, node.IsFolder
+			if !into {
+				folder = parent
+			}
+			name := values["name"]
+			if hasChild(folder, name) {
+				return "", fmt.Errorf("%q already contains %q", folder.Name, name)
+			}
+
+			newNode := config.ConfigNode{Name: name, Command: values["command"], Description: values["description"]}
+			if form.Action == editAddFolder {
+				newNode.Children = []config.ConfigNode{}
+			}
+			return tree.JoinPath(folder.Path, name), doc.Insert(node.Line, newNode, into)
+		}
+	case editRename, editNode:
+		edit = func(doc *config.Document, node, parent *tree.TreeNode) (string, error) {
+			path := node.Path
+			if parent != nil {
+				if values["name"] != node.Name && hasChild(parent, values["name"]) {
+					return "", fmt.Errorf("%q already contains %q", parent.Name, values["name"])
+				}
+				path = tree.JoinPath(parent.Path, values["name"])
+			}
+
+			for _, field := range form.Fields {
+				var err error
+				if field.Key == "confirm" {
+					err = doc.SetConfirm(node.Line, confirmValue(field.Value()))
+				} else {
+					err = doc.SetField(node.Line, field.Key, field.Value())
+				}
+				if err != nil {
+					return "", err
+				}
+			}
+			return path, nil
+		}
+	case editDelete:
+		edit = func(doc *config.Document, node, parent *tree.TreeNode) (string, error) {
+			return neighborPath(parent, node), doc.Delete(node.Line)
+		}
+	}
+
+	m, err := m.applyEdit(form.Node, edit)
+	if err != nil {
+		m.Edit.Error = err.Error()
+		return m, nil
+	}
+	m.ShowEdit = false
+	return m, nil
+}
+
+// editSelected applies edit to the selected node, reporting errors in the status bar
+func (m App) editSelected(edit treeEdit) (App, tea.Cmd) {
+	node := m.shortcutTarget(m.selectedNode())
+	if node == nil {
+		return m, nil
+	}
+	m, err := m.applyEdit(node, edit)
+	if err != nil {
+		m.StatusError = err.Error()
+	}
+	return m, nil
+}
+
+// applyEdit changes the file defining node, saves it and reloads the config
+func (m App) applyEdit(node *tree.TreeNode, edit treeEdit) (App, error) {
+	if node.Source == "" {
+		return m, fmt.Errorf("%q is not defined in a config file", node.Name)
+	}
+	doc, err := config.OpenDocument(node.Source)
+	if err != nil {
+		return m, err
+	}
+	path, err := edit(doc, node, tree.FindParent(m.Tree, node))
+	if err != nil {
+		return m, err
+	}
+	if err := doc.Save(); err != nil {
+		return m, err
+	}
+
+	m = m.reloadConfig()
+	m.revealPath(path)
+	return m, nil
+}
+
+// duplicateNode copies a command or folder under a free name
+func (m App) duplicateNode(doc *config.Document, node, parent *tree.TreeNode) (string, error) {
+	if parent == nil {
+		return "", fmt.Errorf("%q cannot be duplicated", node.Name)
+	}
+	name := node.Name + " copy"
+	for i := 2; hasChild(parent, name); i++ {
+		name = fmt.Sprintf("%s copy %d", node.Name, i)
+	}
+	return tree.JoinPath(parent.Path, name), doc.Duplicate(node.Line, name)
+}
+
+// moveNode returns an edit moving a node delta positions among its siblings
+func moveNode(delta int) treeEdit {
+	return func(doc *config.Document, node, parent *tree.TreeNode) (string, error) {
+		return node.Path, doc.Move(node.Line, delta)
+	}
+}
+
+// moveNodeInto moves a node into the folder right above it
+func (m App) moveNodeInto(doc *config.Document, node, parent *tree.TreeNode) (string, error) {
+	name, err := doc.MoveInto(node.Line)
+	if err != nil {
+		return "", err
+	}
+	for _, sibling := range parent.Children {
+		if sibling.Name == name && hasChild(sibling, node.Name) {
+			return "", fmt.Errorf("%q already contains %q", name, node.Name)
+		}
+	}
+	return tree.JoinPath(tree.JoinPath(parent.Path, name), node.Name), nil
+}
+
+// moveNodeOut moves a node out of its folder, next to the folder
+func (m App) moveNodeOut(doc *config.Document, node, parent *tree.TreeNode) (string, error) {
+	if err := doc.MoveOut(node.Line); err != nil {
+		return "", err
+	}
+	grandparent := tree.FindParent(m.Tree, parent)
+	if grandparent == nil {
+		return "", fmt.Errorf("%q is already at the top level", node.Name)
+	}
+	if hasChild(grandparent, node.Name) {
+		return "", fmt.Errorf("%q already contains %q", grandparent.Name, node.Name)
+	}
+	return tree.JoinPath(grandparent.Path, node.Name), nil
+}
+
+// revealPath expands the folders leading to path and selects it
+func (m *App) revealPath(path string) {
+	tree.Walk(m.Tree, func(node *tree.TreeNode) {
+		if node.IsFolder && node.Path != "" && strings.HasPrefix(path, node.Path+"/") {
+			node.Expanded = true
+		}
+	})
+	m.selectPath(path)
+}
+
+// neighborPath returns the path to select once node is gone: the next
+// sibling, the previous one or the parent
+func neighborPath(parent, node *tree.TreeNode) string {
+	if parent == nil {
+		return ""
+	}
+	for i, sibling := range parent.Children {
+		if sibling != node {
+			continue
+		}
+		if i+1 < len(parent.Children) {
+			// The next sibling moves up into the deleted node's place
+			return parent.Children[i+1].Path
+		}
+		if i > 0 {
+			return parent.Children[i-1].Path
+		}
+	}
+	return parent.Path
+}
+
+func hasChild(folder *tree.TreeNode, name string) bool {
+	for _, child := range folder.Children {
+		if child.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// confirmValue converts a confirm choice into the config setting
+func confirmValue(choice string) *bool {
+	switch choice {
+	case "yes":
+		confirm := true
+		return &confirm
+	case "no":
+		confirm := false
+		return &confirm
+	}
+	return nil
+}
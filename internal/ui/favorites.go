@@ -0,0 +1,103 @@
+package ui
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmy/iz/internal/history"
+	"github.com/charmy/iz/internal/tree"
+)
+
+// addShortcuts adds the Favorites and Recent folders to the top of root.
+// Both are ranked by how often and how recently their commands ran.
+func (m *App) addShortcuts(root *tree.TreeNode) {
+	if m.Recorded == nil {
+		// The shortcuts are a convenience, an unreadable history just leaves Recent out
+		m.Recorded, _ = history.Load()
+	}
+	ranked := history.Frecency(m.Recorded, time.Now())
+
+	var favorites []string
+	if m.State != nil {
+		favorites = slices.Clone(m.State.Favorites)
+	}
+	// Favorites that never ran keep the order they were starred in, after the others
+	rank := func(path string) int {
+		if i := slices.Index(ranked, path); i >= 0 {
+			return i
+		}
+		return len(ranked)
+	}
+	slices.SortStableFunc(favorites, func(a, b string) int {
+		return rank(a) - rank(b)
+	})
+
+	tree.SetShortcuts(root, favorites, ranked)
+}
+
+// refreshShortcuts rebuilds the Favorites and Recent folders, keeping the cursor on the selected node
+func (m *App) refreshShortcuts() {
+	selected := m.selectedNode()
+	m.addShortcuts(m.Tree)
+	if selected != nil {
+		m.selectNode(selected.Path, selected.Shortcut)
+	}
+}
+
+// toggleFavorite stars or unstars the selected command
+func (m App) toggleFavorite() (App, tea.Cmd) {
+	node := m.selectedNode()
+	if node == nil || m.State == nil {
+		return m, nil
+	}
+	if node.IsFolder {
+		m.StatusError = "only commands can be starred"
+		return m, nil
+	}
+
+	m.State.ToggleFavorite(node.Path)
+	if err := m.State.Save(); err != nil {
+		m.StatusError = err.Error()
+	}
+	m.refreshShortcuts()
+	return m, nil
+}
+
+// selectNode moves the cursor to the node with path, either the command
+// itself or its shortcut
+func (m *App) selectNode(path string, shortcut bool) {
+	for i, node := range m.getVisibleNodes() {
+		if node.Path == path && node.Shortcut == shortcut {
+			m.Cursor = i
+			return
+		}
+	}
+	m.selectPath(path)
+}
+
+// shortcutTarget returns the command a shortcut stands in for, or node itself
+func (m App) shortcutTarget(node *tree.TreeNode) *tree.TreeNode {
+	if node != nil && node.Shortcut && !node.IsFolder {
+		if target, err := tree.FindNode(m.Tree, node.Path); err == nil {
+			return target
+		}
+	}
+	return node
+}
+
+// isFavorite reports whether node is a starred command
+func (m App) isFavorite(node *tree.TreeNode) bool {
+	return m.State != nil && !node.IsFolder && m.State.IsFavorite(node.Path)
+}
+
+// shortcutLocation describes where the command of a shortcut lives, e.g. "in Network"
+func shortcutLocation(node *tree.TreeNode) string {
+	i := strings.LastIndex(node.Path, "/")
+	if i < 0 {
+		return ""
+	}
+	return fmt.Sprintf("in %s", node.Path[:i])
+}
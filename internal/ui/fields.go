@@ -0,0 +1,152 @@
+package ui
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmy/iz/internal/config"
+)
+
+// maxPathSuggestions limits how many directory entries are offered for completion
+const maxPathSuggestions = 500
+
+// Value returns the entered, selected or toggled value of the field
+func (f InputField) Value() string {
+	switch {
+	case f.IsToggle:
+		return strconv.FormatBool(f.Checked)
+	case f.IsChoice && f.SelectedValue == "custom":
+		return f.CustomInput.Value()
+	case f.IsChoice:
+		return f.SelectedValue
+	}
+	return f.TextInput.Value()
+}
+
+// validate returns why the value of the field cannot be used, or ""
+func (f InputField) validate() string {
+	if f.Loading {
+		return "the options are still loading"
+	}
+	value := f.Value()
+	if strings.TrimSpace(value) == "" {
+		if f.Optional {
+			return ""
+		}
+		return "a value is required"
+	}
+	if f.Variable != nil {
+		for _, value := range append([]string{value}, f.Multi...) {
+			if err := f.Variable.Check(value); err != nil {
+				return err.Error()
+			}
+		}
+	}
+	return ""
+}
+
+// validateInputs checks every field, recording the problems next to them,
+// and reports whether all values can be used
+func (m *App) validateInputs() bool {
+	valid := true
+	for i := range m.InputFields {
+		if m.InputFields[i].Hidden {
+			continue
+		}
+		m.InputFields[i].Error = m.InputFields[i].validate()
+		valid = valid && m.InputFields[i].Error == ""
+	}
+	return valid
+}
+
+// setupTextInput configures the text input for the variable's type
+func (f *InputField) setupTextInput() {
+	if f.Variable == nil {
+		return
+	}
+	if f.Variable.Secret {
+		f.TextInput.EchoMode = textinput.EchoPassword
+		f.TextInput.EchoCharacter = '•'
+	}
+	if f.Variable.IsPath() {
+		// Completions are shown as they are typed and accepted with →
+		// at the end of the input, Tab keeps switching fields
+		f.TextInput.ShowSuggestions = true
+		f.TextInput.KeyMap.AcceptSuggestion = key.NewBinding(key.WithDisabled())
+		f.updateSuggestions()
+	}
+}
+
+// updateSuggestions lists the entries of the directory typed so far as completions
+func (f *InputField) updateSuggestions() {
+	if f.Variable == nil || !f.Variable.IsPath() {
+		return
+	}
+	f.TextInput.SetSuggestions(pathSuggestions(f.TextInput.Value(), f.Variable.Kind() == config.TypeDir))
+}
+
+// acceptSuggestion completes the value with the highlighted suggestion and
+// reports whether there was one
+func (f *InputField) acceptSuggestion() bool {
+	value := []rune(f.TextInput.Value())
+	suggestion := f.TextInput.CurrentSuggestion()
+	if f.TextInput.Position() < len(value) || len([]rune(suggestion)) <= len(value) {
+		return false
+	}
+	f.TextInput.SetValue(suggestion)
+	f.TextInput.CursorEnd()
+	f.updateSuggestions()
+	return true
+}
+
+// pathSuggestions returns the paths in the directory part of value, with
+// a trailing slash on directories
+func pathSuggestions(value string, dirsOnly bool) []string {
+	if value == "" {
+		return nil
+	}
+	prefix := ""
+	if i := strings.LastIndex(value, "/"); i >= 0 {
+		prefix = value[:i+1]
+	}
+	dir := config.ExpandHome(prefix)
+	if dir == "" {
+		dir = "."
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	// Hidden entries are only offered once a dot is typed
+	showHidden := strings.HasPrefix(value[len(prefix):], ".")
+
+	var suggestions []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") && !showHidden {
+			continue
+		}
+		isDir := entry.IsDir()
+		if entry.Type()&os.ModeSymlink != 0 {
+			if info, err := os.Stat(filepath.Join(dir, name)); err == nil {
+				isDir = info.IsDir()
+			}
+		}
+		if dirsOnly && !isDir {
+			continue
+		}
+		if isDir {
+			name += "/"
+		}
+		suggestions = append(suggestions, prefix+name)
+		if len(suggestions) == maxPathSuggestions {
+			break
+		}
+	}
+	return suggestions
+}
@@ -0,0 +1,233 @@
+package ui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmy/iz/internal/fuzzy"
+	"github.com/charmy/iz/internal/tree"
+)
+
+// Matches within a node's own name rank highest, matches in descriptions and
+// commands below those in names and paths
+const (
+	bonusName          = 15
+	penaltyDescription = 20
+	penaltyCommand     = 30
+)
+
+// FilterState holds the `/` filter over the whole command tree
+type FilterState struct {
+	Active  bool
+	Input   textinput.Model
+	Results []FilterResult
+	Cursor  int
+}
+
+// FilterResult is a node matching the filter
+type FilterResult struct {
+	Node  *tree.TreeNode
+	Score int
+	// Positions are the matched rune indexes in the node's path
+	Positions []int
+	// Field is the field that matched, empty when the path did
+	Field string
+}
+
+func newFilterInput() textinput.Model {
+	input := textinput.New()
+	input.Prompt = "/"
+	input.Placeholder = "filter commands"
+	input.CharLimit = 100
+	return input
+}
+
+// startFilter enters filter mode
+func (m App) startFilter() (App, tea.Cmd) {
+	m.Filter.Active = true
+	m.Filter.Input.SetValue("")
+	m.Filter.Cursor = 0
+	m.updateFilter()
+	return m, m.Filter.Input.Focus()
+}
+
+// stopFilter leaves filter mode
+func (m *App) stopFilter() {
+	m.Filter.Active = false
+	m.Filter.Input.Blur()
+	m.Filter.Results = nil
+}
+
+func (m App) handleFilterKeys(msg tea.KeyMsg) (App, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.stopFilter()
+		return m, nil
+	case "up", "ctrl+p":
+		if m.Filter.Cursor > 0 {
+			m.Filter.Cursor--
+		}
+		return m, nil
+	case "down", "ctrl+n":
+		if m.Filter.Cursor < len(m.Filter.Results)-1 {
+			m.Filter.Cursor++
+		}
+		return m, nil
+	case "tab", "enter":
+		node := m.filterSelection()
+		if node == nil {
+			return m, nil
+		}
+		m.stopFilter()
+		m.revealPath(node.Path)
+		if node.IsFolder {
+			node.Expanded = true
+		}
+		if msg.String() == "tab" || node.IsFolder {
+			// Show the match in the tree without running it
+			return m, nil
+		}
+		m.CaptureOutput, m.Background = false, false
+		return m.handleEnter()
+	}
+
+	var cmd tea.Cmd
+	m.Filter.Input, cmd = m.Filter.Input.Update(msg)
+	m.updateFilter()
+	return m, cmd
+}
+
+// filterSelection returns the highlighted result, or nil
+func (m App) filterSelection() *tree.TreeNode {
+	if m.Filter.Cursor < len(m.Filter.Results) {
+		return m.Filter.Results[m.Filter.Cursor].Node
+	}
+	return nil
+}
+
+// updateFilter matches every node of the tree, including those in collapsed
+// folders, against the current query
+func (m *App) updateFilter() {
+	query := strings.TrimSpace(m.Filter.Input.Value())
+
+	var results []FilterResult
+	tree.Walk(m.Tree, func(node *tree.TreeNode) {
+		if node == m.Tree || node.Shortcut {
+			// Shortcuts would list their commands twice
+			return
+		}
+		if result, ok := matchNode(query, node); ok {
+			results = append(results, result)
+		}
+	})
+
+	// Ties keep the tree order
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+
+	m.Filter.Results = results
+	m.Filter.Cursor = min(m.Filter.Cursor, max(len(results)-1, 0))
+	if m.Filter.Input.Value() == "" {
+		m.Filter.Cursor = 0
+	}
+}
+
+// matchNode matches query against the path, description and command of node
+func matchNode(query string, node *tree.TreeNode) (FilterResult, bool) {
+	best := FilterResult{Node: node}
+	found := false
+
+	if score, positions, ok := fuzzy.Match(query, node.Path); ok {
+		// Prefer matches within the name over ones spread across folders
+		if len(positions) > 0 && positions[0] >= len([]rune(node.Path))-len([]rune(node.Name)) {
+			score += bonusName
+		}
+		best.Score, best.Positions, found = score, positions, true
+	}
+	if score, _, ok := fuzzy.Match(query, node.Description); ok && node.Description != "" {
+		if score -= penaltyDescription; !found || score > best.Score {
+			best = FilterResult{Node: node, Score: score, Field: "description"}
+			found = true
+		}
+	}
+	if command := node.DisplayCommand(); command != "" {
+		if score, _, ok := fuzzy.Match(query, command); ok {
+			if score -= penaltyCommand; !found || score > best.Score {
+				best = FilterResult{Node: node, Score: score, Field: "command"}
+				found = true
+			}
+		}
+	}
+	return best, found
+}
+
+func (m App) renderFilter(height int) string {
+	if len(m.Filter.Results) == 0 {
+		empty := lipgloss.NewStyle().Foreground(lipgloss.Color("240")).Italic(true).Render("No matches")
+		return m.Filter.Input.View() + "\n\n" + empty
+	}
+
+	// Keep the cursor within the rows that fit below the input
+	rows := max(height-2, 1)
+	start := max(0, m.Filter.Cursor-rows+1)
+	end := min(len(m.Filter.Results), start+rows)
+
+	paneWidth, _ := m.paneSize()
+	lineStyle := lipgloss.NewStyle().MaxWidth(max(paneWidth-2, 1))
+
+	lines := []string{m.Filter.Input.View(), ""}
+	for i := start; i < end; i++ {
+		lines = append(lines, lineStyle.Render(m.renderFilterResult(m.Filter.Results[i], i == m.Filter.Cursor)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// renderFilterResult renders the breadcrumb path of a result with matched
+// characters highlighted
+func (m App) renderFilterResult(result FilterResult, selected bool) string {
+	base := lipgloss.NewStyle()
+	if selected {
+		base = base.Background(lipgloss.Color("62")).Foreground(lipgloss.Color("230"))
+	}
+	folderStyle := base.Foreground(lipgloss.Color("240"))
+	if selected {
+		folderStyle = base
+	}
+	matchStyle := base.Foreground(lipgloss.Color("214")).Bold(true)
+
+	matched := make(map[int]bool)
+	for _, pos := range result.Positions {
+		matched[pos] = true
+	}
+
+	path := []rune(result.Node.Path)
+	nameStart := len(path) - len([]rune(result.Node.Name))
+
+	var b strings.Builder
+	prefix := "• "
+	if result.Node.IsFolder {
+		prefix = "▸ "
+	}
+	b.WriteString(base.Render(prefix))
+	for i, r := range path {
+		switch {
+		case r == '/' && i < nameStart:
+			b.WriteString(folderStyle.Render(" › "))
+		case matched[i]:
+			b.WriteString(matchStyle.Render(string(r)))
+		case i < nameStart:
+			b.WriteString(folderStyle.Render(string(r)))
+		default:
+			b.WriteString(base.Render(string(r)))
+		}
+	}
+	if result.Field != "" {
+		b.WriteString(folderStyle.Render(fmt.Sprintf("  (%s)", result.Field)))
+	}
+	return b.String()
+}
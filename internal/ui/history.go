@@ -0,0 +1,342 @@
+package ui
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmy/iz/internal/fuzzy"
+	"github.com/charmy/iz/internal/history"
+	"github.com/charmy/iz/internal/tree"
+)
+
+// HistoryView lists past runs, most recent first
+type HistoryView struct {
+	Entries []history.Entry
+	// Results are the indexes of the entries matching the filter
+	Results   []int
+	Cursor    int
+	Filter    textinput.Model
+	Filtering bool
+}
+
+func newHistoryFilter() textinput.Model {
+	input := textinput.New()
+	input.Prompt = "/"
+	input.Placeholder = "filter runs"
+	input.CharLimit = 100
+	return input
+}
+
+// recordRun appends a finished run to the history file and updates the Recent folder
+func (m *App) recordRun(entry history.Entry) {
+	if err := history.Append(entry); err != nil {
+		m.StatusError = fmt.Sprintf("could not record run: %v", err)
+		return
+	}
+	m.Recorded = slices.Insert(m.Recorded, 0, entry)
+	m.refreshShortcuts()
+}
+
+// openHistory loads the history file and shows the History view
+func (m App) openHistory() (App, tea.Cmd) {
+	entries, err := history.Load()
+	if err != nil {
+		m.StatusError = err.Error()
+		return m, nil
+	}
+	m.History = HistoryView{Entries: entries, Filter: newHistoryFilter()}
+	m.updateHistory()
+	m.ShowHistory = true
+	return m, nil
+}
+
+func (m App) handleHistoryKeys(msg tea.KeyMsg) (App, tea.Cmd) {
+	if m.History.Filtering {
+		switch msg.String() {
+		case "esc":
+			m.History.Filtering = false
+			m.History.Filter.Blur()
+			m.History.Filter.SetValue("")
+			m.updateHistory()
+			return m, nil
+		case "enter":
+			m.History.Filtering = false
+			m.History.Filter.Blur()
+			return m, nil
+		case "up", "down":
+			// Fall through to the list navigation below
+		default:
+			var cmd tea.Cmd
+			m.History.Filter, cmd = m.History.Filter.Update(msg)
+			m.updateHistory()
+			return m, cmd
+		}
+	}
+
+	last := max(len(m.History.Results)-1, 0)
+	switch msg.String() {
+	case "esc", "H":
+		m.ShowHistory = false
+	case "/":
+		m.History.Filtering = true
+		return m, m.History.Filter.Focus()
+	case "up", "k":
+		m.History.Cursor = max(m.History.Cursor-1, 0)
+	case "down", "j":
+		m.History.Cursor = min(m.History.Cursor+1, last)
+	case "pgup":
+		m.History.Cursor = max(m.History.Cursor-m.historyRows(), 0)
+	case "pgdown":
+		m.History.Cursor = min(m.History.Cursor+m.historyRows(), last)
+	case "home", "g":
+		m.History.Cursor = 0
+	case "end", "G":
+		m.History.Cursor = last
+	case "enter", "r":
+		return m.rerunEntry(false)
+	case "o":
+		return m.rerunEntry(true)
+	case "i":
+		return m.reopenEntry()
+	}
+	return m, nil
+}
+
+// historySelection returns the highlighted entry, or nil
+func (m App) historySelection() *history.Entry {
+	if m.History.Cursor < len(m.History.Results) {
+		return &m.History.Entries[m.History.Results[m.History.Cursor]]
+	}
+	return nil
+}
+
+// updateHistory matches the entries against the filter, keeping them in order of recency
+func (m *App) updateHistory() {
+	query := strings.TrimSpace(m.History.Filter.Value())
+	m.History.Results = m.History.Results[:0]
+	for i, entry := range m.History.Entries {
+		if _, _, ok := fuzzy.Match(query, entry.Path+" "+entry.Command); ok {
+			m.History.Results = append(m.History.Results, i)
+		}
+	}
+	m.History.Cursor = min(m.History.Cursor, max(len(m.History.Results)-1, 0))
+}
+
+// rerunEntry runs the command line of the selected entry again, exactly as recorded
+func (m App) rerunEntry(capture bool) (App, tea.Cmd) {
+	entry := m.historySelection()
+	if entry == nil {
+		return m, nil
+	}
+	if entry.Redacted {
+		// Secret or not remembered values were not recorded, they have to be
+		// entered again
+		m, cmd := m.reopenEntry()
+		if m.ShowInputs {
+			m.CaptureOutput, m.Background = capture, false
+		}
+		return m, cmd
+	}
+	m.ShowHistory = false
+	m.CaptureOutput, m.Background = capture, false
+	m.InputValues = maps.Clone(entry.Values)
+	spec := tree.RunSpec{Command: entry.Command, Argv: entry.Argv}
+
+	node, err := tree.FindNode(m.Tree, entry.Path)
+	if err != nil || node.IsFolder {
+		// The command is gone from the config, the recorded line still runs
+		spec.Dir = entry.Cwd
+		return m.startRun(entry.Path, spec)
+	}
+	// Runs again where it ran before, with the current environment of the command
+	if len(node.Steps) > 0 || len(node.Needs) > 0 {
+		// Steps keep their own working directories
+		var plan *tree.TreeNode
+		if plan, err = tree.PlanNeeds(m.Tree, node); err == nil {
+			spec, err = plan.Expand(entry.Values)
+		}
+	} else {
+		spec, err = node.WithContext(spec, entry.Values)
+		spec.Dir = entry.Cwd
+	}
+	if err != nil {
+		m.StatusError = err.Error()
+		return m, nil
+	}
+	m.revealPath(node.Path)
+	if node.Confirm {
+		m.ShowConfirm = true
+		m.ConfirmYes = true
+		m.PendingSpec = spec
+		return m, nil
+	}
+	return m.runCommand(spec)
+}
+
+// reopenEntry opens the input dialog of the selected entry's command, filled
+// in with the values it ran with
+func (m App) reopenEntry() (App, tea.Cmd) {
+	entry := m.historySelection()
+	if entry == nil {
+		return m, nil
+	}
+	node, err := tree.FindNode(m.Tree, entry.Path)
+	if err != nil || node.IsFolder || !node.Runnable() {
+		m.StatusError = fmt.Sprintf("%q is no longer in the config", entry.Path)
+		return m, nil
+	}
+	if plan, err := tree.PlanNeeds(m.Tree, node); err != nil || len(plan.Placeholders()) == 0 {
+		m.StatusError = fmt.Sprintf("%q has no variables", node.Path)
+		return m, nil
+	}
+
+	m.ShowHistory = false
+	m.CaptureOutput, m.Background = false, false
+	m.revealPath(node.Path)
+	m, cmd := m.handleEnter()
+	if len(m.InputFields) == 0 {
+		// The variables could not be set up, e.g. because they depend on each
+		// other, handleEnter says why
+		if cmd == nil && m.StatusError == "" {
+			m.StatusError = fmt.Sprintf("could not ask for the variables of %q", node.Path)
+		}
+		return m, cmd
+	}
+	for i := range m.InputFields {
+		if value, ok := entry.Values[m.InputFields[i].Name]; ok {
+			m.InputFields[i].setValue(value)
+			m.InputFields[i].Touched = true
+		}
+	}
+	cmd = tea.Batch(cmd, m.resolveFields(false, false))
+	if first := &m.InputFields[0]; first.IsChoice && first.ShowCustomInput {
+		first.CustomInput.Focus()
+	}
+	return m, cmd
+}
+
+// historyRows returns how many entries fit into the History view
+func (m App) historyRows() int {
+	// Border, padding, title, filter, details and the blank lines between them
+	return max(m.Height-3-4-9, 1)
+}
+
+func (m App) renderWithHistoryDialog(mainView string) string {
+	width := max(m.Width-8, 20)
+	lineStyle := lipgloss.NewStyle().MaxWidth(width)
+	dimStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("240"))
+
+	title := lipgloss.NewStyle().
+		Bold(true).
+		Foreground(lipgloss.Color("205")).
+		Render("Run History") +
+		dimStyle.Render(fmt.Sprintf("  %d of %d runs", len(m.History.Results), len(m.History.Entries)))
+
+	filter := dimStyle.Render("/ to filter")
+	if m.History.Filtering || m.History.Filter.Value() != "" {
+		filter = m.History.Filter.View()
+	}
+
+	// Keep the cursor within the visible rows
+	rows := m.historyRows()
+	start := max(0, m.History.Cursor-rows+1)
+	end := min(len(m.History.Results), start+rows)
+
+	var list []string
+	for i := start; i < end; i++ {
+		entry := m.History.Entries[m.History.Results[i]]
+		list = append(list, lineStyle.Render(renderHistoryEntry(entry, i == m.History.Cursor)))
+	}
+	if len(m.History.Entries) == 0 {
+		list = append(list, dimStyle.Italic(true).Render("No runs recorded yet"))
+	} else if len(list) == 0 {
+		list = append(list, dimStyle.Italic(true).Render("No matches"))
+	}
+	for len(list) < rows {
+		list = append(list, "")
+	}
+
+	var details []string
+	if entry := m.historySelection(); entry != nil {
+		commandStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("39"))
+		details = append(details,
+			lineStyle.Render(commandStyle.Render("$ "+entry.Command)),
+			lineStyle.Render(dimStyle.Render(fmt.Sprintf("%s in %s", entry.Path, shortenPath(entry.Cwd)))),
+			lineStyle.Render(dimStyle.Render(formatValues(entry.Values))),
+			lineStyle.Render(renderEntryResult(*entry)+dimStyle.Render(" on "+entry.Time.Format("Mon Jan 2 15:04:05"))),
+		)
+	}
+
+	content := lipgloss.JoinVertical(lipgloss.Left,
+		title, "",
+		filter, "",
+		strings.Join(list, "\n"), "",
+		strings.Join(details, "\n"),
+	)
+
+	box := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(lipgloss.Color("62")).
+		Padding(1, 2).
+		Width(m.Width - 4).
+		Render(content)
+
+	dialogOverlay := lipgloss.Place(
+		m.Width, m.Height-3,
+		lipgloss.Center, lipgloss.Center,
+		box,
+		lipgloss.WithWhitespaceBackground(lipgloss.Color("234")),
+		lipgloss.WithWhitespaceForeground(lipgloss.Color("240")),
+	)
+	return lipgloss.JoinVertical(lipgloss.Left, dialogOverlay, m.renderStatusBar())
+}
+
+// renderHistoryEntry renders an entry as a single row of the History view
+func renderHistoryEntry(entry history.Entry, selected bool) string {
+	base := lipgloss.NewStyle()
+	if selected {
+		base = base.Background(lipgloss.Color("62")).Foreground(lipgloss.Color("230"))
+	}
+	status := base.Foreground(lipgloss.Color("46")).Render("✓")
+	if entry.Failed() {
+		status = base.Foreground(lipgloss.Color("196")).Render("✗")
+	}
+	when := base.Foreground(lipgloss.Color("245")).Render(entry.Time.Format("Jan 02 15:04:05"))
+	path := base.Bold(true).Render(entry.Path)
+	command := base.Foreground(lipgloss.Color("245")).Render("$ " + entry.Command)
+	return status + base.Render(" ") + when + base.Render("  ") + path + base.Render("  ") + command
+}
+
+// renderEntryResult describes how a recorded run finished, in red or green
+func renderEntryResult(entry history.Entry) string {
+	return renderResult(tree.CommandFinishedMsg{
+		ExitCode: entry.ExitCode,
+		Started:  entry.Time,
+		Finished: entry.Time.Add(entry.Duration()),
+		Err:      entryError(entry),
+	})
+}
+
+func entryError(entry history.Entry) error {
+	if entry.Error == "" {
+		return nil
+	}
+	return fmt.Errorf("%s", entry.Error)
+}
+
+// formatValues renders variable values as name=value pairs in name order
+func formatValues(values map[string]string) string {
+	if len(values) == 0 {
+		return "no variables"
+	}
+	var pairs []string
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", name, values[name]))
+	}
+	return strings.Join(pairs, "  ")
+}
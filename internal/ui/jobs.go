@@ -0,0 +1,467 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmy/iz/internal/history"
+	"github.com/charmy/iz/internal/tree"
+)
+
+// errStepsInBackground is why commands with steps or needs are not run with b,
+// their progress is shown in the output pane
+var errStepsInBackground = errors.New("commands with steps or needs cannot run in the background, press o instead")
+
+// Job is a command run in the background with b. Its output is captured
+// while the UI stays usable.
+type Job struct {
+	ID       int
+	Path     string
+	Spec     tree.RunSpec
+	Capture  *tree.Capture
+	Lines    []OutputLine
+	Result   *tree.CommandFinishedMsg
+	StartErr error
+
+	// Entry is recorded in the history each time the job finishes
+	Entry history.Entry
+	// Signal is the last signal sent to the running job. Restart starts it
+	// again once it exited.
+	Signal  string
+	Restart bool
+}
+
+// Running reports whether the job's command is still executing
+func (j *Job) Running() bool {
+	return j.Capture != nil && j.Result == nil
+}
+
+// start runs the command of the job afresh
+func (j *Job) start() tea.Cmd {
+	j.Capture, j.Lines, j.Result, j.StartErr = nil, nil, nil, nil
+	j.Signal, j.Restart = "", false
+	capture, err := tree.StartCapture(j.Spec)
+	if err != nil {
+		j.StartErr = err
+		return nil
+	}
+	j.Capture = capture
+	return capture.Wait()
+}
+
+// JobsView is the Jobs panel. Viewing shows the output of the selected job.
+type JobsView struct {
+	Cursor   int
+	Viewing  bool
+	Viewport viewport.Model
+	// Ticking is set while the uptimes are refreshed every second
+	Ticking bool
+	// Stale and Refreshing as in OutputPane, for the output of the viewed job
+	Stale      bool
+	Refreshing bool
+}
+
+// jobsTickMsg refreshes the uptimes in the Jobs panel
+type jobsTickMsg struct{}
+
+// jobOutputRefreshMsg renders the lines the viewed job printed since the last render
+type jobOutputRefreshMsg struct{}
+
+func tickJobs() tea.Cmd {
+	return tea.Tick(time.Second, func(time.Time) tea.Msg { return jobsTickMsg{} })
+}
+
+// startJob runs spec on behalf of the node at path in the background
+func (m App) startJob(path string, spec tree.RunSpec, entry history.Entry) (App, tea.Cmd) {
+	m.NextJob++
+	job := &Job{ID: m.NextJob, Path: path, Spec: spec, Entry: entry}
+	m.Jobs = append(m.Jobs, job)
+	return m, m.runJob(job)
+}
+
+// runJob starts job, recording it as failed right away when it cannot start
+func (m *App) runJob(job *Job) tea.Cmd {
+	cmd := job.start()
+	if job.StartErr != nil {
+		entry := job.Entry
+		entry.Finish(time.Now(), time.Now(), -1, job.StartErr)
+		m.recordRun(entry)
+	}
+	return cmd
+}
+
+// jobOf returns the job running with capture, or nil
+func (m App) jobOf(capture *tree.Capture) *Job {
+	for _, job := range m.Jobs {
+		if capture != nil && job.Capture == capture {
+			return job
+		}
+	}
+	return nil
+}
+
+// handleJobMsg collects the output of a job and records its run once it finished
+func (m App) handleJobMsg(job *Job, msg tea.Msg) (App, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tree.OutputLineMsg:
+		job.Lines = append(job.Lines, OutputLine{Text: msg.Line, Stderr: msg.Stderr})
+		if len(job.Lines) > maxOutputLines {
+			job.Lines = job.Lines[len(job.Lines)-maxOutputLines:]
+		}
+		if m.ShowJobs && m.JobsView.Viewing && m.selectedJob() == job {
+			return m, tea.Batch(msg.Capture.Wait(), m.scheduleJobRefresh())
+		}
+		return m, msg.Capture.Wait()
+	case tree.CommandFinishedMsg:
+		job.Result = &msg
+		entry := job.Entry
+		entry.Finish(msg.Started, msg.Finished, msg.ExitCode, msg.Err)
+		m.recordRun(entry)
+		if job.Restart {
+			return m, m.runJob(job)
+		}
+	}
+	return m, nil
+}
+
+// openJobs shows the Jobs panel
+func (m App) openJobs() (App, tea.Cmd) {
+	m.ShowJobs = true
+	m.JobsView.Viewing = false
+	m.JobsView.Cursor = min(m.JobsView.Cursor, max(len(m.Jobs)-1, 0))
+	if m.JobsView.Ticking {
+		return m, nil
+	}
+	m.JobsView.Ticking = true
+	return m, tickJobs()
+}
+
+// selectedJob returns the highlighted job, or nil
+func (m App) selectedJob() *Job {
+	if m.JobsView.Cursor < len(m.Jobs) {
+		return m.Jobs[m.JobsView.Cursor]
+	}
+	return nil
+}
+
+func (m App) handleJobsKeys(msg tea.KeyMsg) (App, tea.Cmd) {
+	switch msg.String() {
+	case "i":
+		return m.signalJob(syscall.SIGINT, "SIGINT"), nil
+	case "t":
+		return m.signalJob(syscall.SIGTERM, "SIGTERM"), nil
+	case "x":
+		return m.signalJob(syscall.SIGKILL, "SIGKILL"), nil
+	case "r":
+		return m.restartJob()
+	}
+
+	if m.JobsView.Viewing {
+		switch msg.String() {
+		case "esc", "enter", "v":
+			m.JobsView.Viewing = false
+		case "g", "home":
+			m.JobsView.Viewport.GotoTop()
+		case "G", "end":
+			m.JobsView.Viewport.GotoBottom()
+		default:
+			var cmd tea.Cmd
+			m.JobsView.Viewport, cmd = m.JobsView.Viewport.Update(msg)
+			return m, cmd
+		}
+		return m, nil
+	}
+
+	last := max(len(m.Jobs)-1, 0)
+	switch msg.String() {
+	case "esc", "B":
+		m.ShowJobs = false
+	case "up", "k":
+		m.JobsView.Cursor = max(m.JobsView.Cursor-1, 0)
+	case "down", "j":
+		m.JobsView.Cursor = min(m.JobsView.Cursor+1, last)
+	case "home", "g":
+		m.JobsView.Cursor = 0
+	case "end", "G":
+		m.JobsView.Cursor = last
+	case "enter", "v":
+		if m.selectedJob() != nil {
+			m.JobsView.Viewing = true
+			m.refreshJobOutput()
+			m.JobsView.Viewport.GotoBottom()
+		}
+	case "d":
+		m.removeJobs(func(job *Job) bool { return job == m.selectedJob() })
+	case "D":
+		m.removeJobs(func(*Job) bool { return true })
+	}
+	return m, nil
+}
+
+// signalJob sends sig to the process group of the selected job
+func (m App) signalJob(sig syscall.Signal, name string) App {
+	job := m.selectedJob()
+	if job == nil {
+		return m
+	}
+	if !job.Running() {
+		m.StatusError = fmt.Sprintf("job %d is not running", job.ID)
+		return m
+	}
+	if err := job.Capture.Signal(sig); err != nil {
+		m.StatusError = fmt.Sprintf("could not send %s to job %d: %v", name, job.ID, err)
+		return m
+	}
+	job.Signal = name
+	return m
+}
+
+// restartJob runs the selected job again. A running job is terminated first
+// and starts again once it exited.
+func (m App) restartJob() (App, tea.Cmd) {
+	job := m.selectedJob()
+	if job == nil {
+		return m, nil
+	}
+	if job.Running() {
+		m = m.signalJob(syscall.SIGTERM, "SIGTERM")
+		job.Restart = m.StatusError == ""
+		return m, nil
+	}
+	cmd := m.runJob(job)
+	if m.JobsView.Viewing {
+		m.refreshJobOutput()
+	}
+	return m, cmd
+}
+
+// removeJobs removes the finished jobs matching remove from the panel
+func (m *App) removeJobs(remove func(*Job) bool) {
+	var jobs []*Job
+	for _, job := range m.Jobs {
+		if job.Running() || !remove(job) {
+			jobs = append(jobs, job)
+		}
+	}
+	if len(jobs) == len(m.Jobs) && len(jobs) > 0 {
+		m.StatusError = "only finished jobs can be removed"
+	}
+	m.Jobs = jobs
+	m.JobsView.Cursor = min(m.JobsView.Cursor, max(len(m.Jobs)-1, 0))
+}
+
+// runningJobs returns how many jobs are still running
+func (m App) runningJobs() int {
+	running := 0
+	for _, job := range m.Jobs {
+		if job.Running() {
+			running++
+		}
+	}
+	return running
+}
+
+// StopJobs terminates the jobs that are still running, called when iz exits
+func (m App) StopJobs() {
+	for _, job := range m.Jobs {
+		if job.Running() {
+			_ = job.Capture.Signal(syscall.SIGTERM)
+		}
+	}
+}
+
+// jobsHeight returns how many lines the content of the Jobs panel may take
+func (m App) jobsHeight() int {
+	// Status bar, border and padding
+	return max(m.Height-3-4, 8)
+}
+
+// scheduleJobRefresh marks the output of the viewed job as stale and renders
+// it once outputRefreshInterval has passed, like scheduleRefresh
+func (m *App) scheduleJobRefresh() tea.Cmd {
+	m.JobsView.Stale = true
+	if m.JobsView.Refreshing {
+		return nil
+	}
+	m.JobsView.Refreshing = true
+	return tea.Tick(outputRefreshInterval, func(time.Time) tea.Msg { return jobOutputRefreshMsg{} })
+}
+
+// flushJobOutput renders the lines the viewed job printed since the last
+// render, following its output if it was scrolled to the bottom
+func (m App) flushJobOutput() App {
+	m.JobsView.Refreshing = false
+	if !m.JobsView.Stale || !m.ShowJobs || !m.JobsView.Viewing {
+		return m
+	}
+	atBottom := m.JobsView.Viewport.AtBottom()
+	m.refreshJobOutput()
+	if atBottom {
+		m.JobsView.Viewport.GotoBottom()
+	}
+	return m
+}
+
+// refreshJobOutput renders the output of the selected job into the viewport
+func (m *App) refreshJobOutput() {
+	m.JobsView.Stale = false
+	job := m.selectedJob()
+	if job == nil {
+		return
+	}
+	// Title, command, status and the footer with the blank lines between them
+	m.JobsView.Viewport.Width = max(m.Width-8, 20)
+	m.JobsView.Viewport.Height = max(m.jobsHeight()-7, 1)
+
+	stderrStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("203"))
+	lines := make([]string, 0, len(job.Lines)+1)
+	for _, line := range job.Lines {
+		if line.Stderr {
+			lines = append(lines, stderrStyle.Render(line.Text))
+		} else {
+			lines = append(lines, line.Text)
+		}
+	}
+	if job.StartErr != nil {
+		lines = append(lines, stderrStyle.Render(fmt.Sprintf("failed to start: %v", job.StartErr)))
+	}
+	m.JobsView.Viewport.SetContent(strings.Join(lines, "\n"))
+}
+
+// jobStatus describes how far a job got, e.g. "up 1m20s" or "✗ exited 2 after 3.4s"
+func jobStatus(job *Job) string {
+	switch {
+	case job.StartErr != nil:
+		return fmt.Sprintf("✗ failed to start: %v", job.StartErr)
+	case job.Result != nil && job.Result.Err == nil && job.Result.ExitCode < 0 && job.Signal != "":
+		return fmt.Sprintf("✗ stopped with %s after %s", job.Signal, formatDuration(job.Result.Duration()))
+	case job.Result != nil:
+		return resultSummary(*job.Result)
+	}
+	status := "up " + time.Since(job.Capture.Started).Round(time.Second).String()
+	if job.Restart {
+		status += ", restarting"
+	} else if job.Signal != "" {
+		status += ", " + job.Signal + " sent"
+	}
+	return status
+}
+
+// jobColor is green or red for finished jobs and yellow for running ones
+func jobColor(job *Job) lipgloss.Color {
+	switch {
+	case job.Running():
+		return lipgloss.Color("226")
+	case job.StartErr != nil || job.Result.Failed():
+		return lipgloss.Color("196")
+	}
+	return lipgloss.Color("46")
+}
+
+// renderJob renders a job as a single row of the Jobs panel
+func renderJob(job *Job, selected bool) string {
+	base := lipgloss.NewStyle()
+	if selected {
+		base = base.Background(lipgloss.Color("62")).Foreground(lipgloss.Color("230"))
+	}
+	icon := "●"
+	if !job.Running() {
+		icon = "✓"
+		if job.StartErr != nil || job.Result.Failed() {
+			icon = "✗"
+		}
+	}
+	pid := "pid -"
+	if job.Capture != nil {
+		pid = fmt.Sprintf("pid %d", job.Capture.Pid())
+	}
+	return base.Foreground(jobColor(job)).Render(icon) +
+		base.Render(fmt.Sprintf(" #%-3d ", job.ID)) +
+		base.Bold(true).Render(job.Path) + base.Render("  ") +
+		base.Foreground(lipgloss.Color("245")).Render(pid) + base.Render("  ") +
+		base.Foreground(jobColor(job)).Render(strings.TrimPrefix(strings.TrimPrefix(jobStatus(job), "✓ "), "✗ "))
+}
+
+func (m App) renderWithJobsDialog(mainView string) string {
+	width := max(m.Width-8, 20)
+	height := m.jobsHeight()
+	lineStyle := lipgloss.NewStyle().MaxWidth(width)
+	dimStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("240"))
+	commandStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("39"))
+
+	running := m.runningJobs()
+	title := lipgloss.NewStyle().
+		Bold(true).
+		Foreground(lipgloss.Color("205")).
+		Render("Jobs") +
+		dimStyle.Render(fmt.Sprintf("  %d running, %d finished", running, len(m.Jobs)-running))
+
+	var sections []string
+	job := m.selectedJob()
+	switch {
+	case job == nil:
+		sections = []string{title, "", dimStyle.Italic(true).Render("No jobs yet, press b on a command to run it in the background")}
+	case m.JobsView.Viewing:
+		footer := dimStyle.Render(fmt.Sprintf("%d lines • %3.f%%", len(job.Lines), m.JobsView.Viewport.ScrollPercent()*100))
+		sections = []string{
+			title, "",
+			lineStyle.Render(commandStyle.Render("$ " + job.Entry.Command)),
+			lineStyle.Render(renderJob(job, false)), "",
+			m.JobsView.Viewport.View(), "",
+			footer,
+		}
+	default:
+		// The list takes up to a third of the panel, the output of the
+		// selected job the rest
+		rows := min(len(m.Jobs), max(height/3, 1))
+		start := max(0, m.JobsView.Cursor-rows+1)
+		var list []string
+		for i := start; i < min(len(m.Jobs), start+rows); i++ {
+			list = append(list, lineStyle.Render(renderJob(m.Jobs[i], i == m.JobsView.Cursor)))
+		}
+
+		tail := max(height-rows-6, 1)
+		var output []string
+		for _, line := range job.Lines[max(len(job.Lines)-tail, 0):] {
+			style := lineStyle
+			if line.Stderr {
+				style = style.Foreground(lipgloss.Color("203"))
+			}
+			output = append(output, style.Render(line.Text))
+		}
+		if len(output) == 0 {
+			output = append(output, dimStyle.Italic(true).Render("No output yet"))
+		}
+
+		sections = []string{
+			title, "",
+			strings.Join(list, "\n"), "",
+			lineStyle.Render(commandStyle.Render("$ " + job.Entry.Command)),
+			lineStyle.Render(dimStyle.Render(fmt.Sprintf("%s in %s", job.Path, shortenPath(job.Entry.Cwd)))), "",
+			strings.Join(output, "\n"),
+		}
+	}
+
+	box := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(lipgloss.Color("62")).
+		Padding(1, 2).
+		Width(m.Width - 4).
+		Height(height + 2).
+		Render(lipgloss.JoinVertical(lipgloss.Left, sections...))
+
+	dialogOverlay := lipgloss.Place(
+		m.Width, m.Height-3,
+		lipgloss.Center, lipgloss.Center,
+		box,
+		lipgloss.WithWhitespaceBackground(lipgloss.Color("234")),
+		lipgloss.WithWhitespaceForeground(lipgloss.Color("240")),
+	)
+	return lipgloss.JoinVertical(lipgloss.Left, dialogOverlay, m.renderStatusBar())
+}
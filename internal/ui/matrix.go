@@ -0,0 +1,258 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmy/iz/internal/history"
+	"github.com/charmy/iz/internal/tree"
+)
+
+// MatrixRun is one of the runs a command fans out into when several options
+// of its choice fields are picked, with the values it runs with
+type MatrixRun struct {
+	Label  string
+	Values map[string]string
+	Spec   tree.RunSpec
+}
+
+// fanOutCount returns how many runs the values in the input dialog make up
+func (m App) fanOutCount() int {
+	count := 1
+	for _, f := range m.InputFields {
+		if !f.Hidden {
+			count *= len(f.values())
+		}
+	}
+	return count
+}
+
+// matrixRuns expands node once for every combination of the values picked in
+// the input dialog, the last field changing fastest
+func (m App) matrixRuns(node *tree.TreeNode) ([]MatrixRun, error) {
+	if len(node.Steps) > 0 {
+		return nil, errors.New("commands with steps or needs run with one value per variable")
+	}
+
+	combinations := []map[string]string{{}}
+	var picked []string
+	for _, f := range m.InputFields {
+		if f.Hidden {
+			continue
+		}
+		if len(f.values()) > 1 {
+			picked = append(picked, f.Name)
+			for _, other := range m.InputFields {
+				if !other.Hidden && other.Variable != nil && slices.Contains(other.Variable.References(), f.Name) {
+					return nil, fmt.Errorf("%s depends on %s, pick a single %s", other.Name, f.Name, f.Name)
+				}
+			}
+		}
+
+		var next []map[string]string
+		for _, combination := range combinations {
+			for _, value := range f.values() {
+				values := maps.Clone(combination)
+				values[f.Name] = value
+				next = append(next, values)
+			}
+		}
+		combinations = next
+	}
+
+	runs := make([]MatrixRun, 0, len(combinations))
+	for _, values := range combinations {
+		spec, err := node.Expand(values)
+		if err != nil {
+			return nil, err
+		}
+		var label []string
+		for _, name := range picked {
+			label = append(label, name+"="+values[name])
+		}
+		runs = append(runs, MatrixRun{Label: strings.Join(label, " "), Values: values, Spec: spec})
+	}
+	return runs, nil
+}
+
+// startMatrix runs the runs of node in the output pane, as many at once as
+// its concurrency allows. Each run is recorded in the history on its own.
+func (m App) startMatrix(node *tree.TreeNode, runs []MatrixRun) (App, tea.Cmd) {
+	spec := tree.RunSpec{}
+	for _, run := range runs {
+		// A failing run does not keep the others from running
+		spec.Steps = append(spec.Steps, tree.StepSpec{Name: run.Label, Spec: run.Spec, ContinueOnError: true})
+	}
+
+	m.RunningPath = node.Path
+	m.prepareSteps(spec, history.Entry{Path: node.Path})
+	m.Output.Matrix = true
+	m.Output.Concurrency = tree.DefaultConcurrency
+	if node.Concurrency > 0 {
+		m.Output.Concurrency = node.Concurrency
+	}
+	for i, run := range runs {
+		entry := history.NewEntry(node.Path, node, run.Spec, run.Values)
+		m.Output.Steps[i].Entry = &entry
+	}
+	m.resizeOutput()
+	return m.advanceSteps()
+}
+
+// finishMatrix ends the runs of a matrix, which failed when any of them did
+func (m App) finishMatrix() App {
+	result := tree.CommandFinishedMsg{
+		Command:  m.Output.Command,
+		ExitCode: m.Output.HaltCode,
+		Started:  m.Output.Started,
+		Finished: time.Now(),
+		Err:      m.Output.HaltErr,
+	}
+	if !m.Output.Halted {
+		failed := 0
+		for _, step := range m.Output.Steps {
+			if step.Result != nil && step.Result.Failed() {
+				failed++
+			}
+		}
+		if failed > 0 {
+			result.ExitCode = 1
+			result.Err = fmt.Errorf("%d of %d runs failed", failed, len(m.Output.Steps))
+		}
+	}
+	m.Output.Result = &result
+	m.LastRun = &result
+	m.LastRunPath = m.Output.StepsEntry.Path
+	return m
+}
+
+// handleMatrixKeys picks a run in the results table and shows its output only
+func (m App) handleMatrixKeys(key string) (App, bool) {
+	switch key {
+	case "[":
+		m.Output.Selected = max(m.Output.Selected-1, 0)
+	case "]":
+		m.Output.Selected = min(m.Output.Selected+1, len(m.Output.Steps)-1)
+	case "enter":
+		m.Output.Drill = !m.Output.Drill
+	case "esc":
+		if !m.Output.Drill {
+			return m, false
+		}
+		m.Output.Drill = false
+	default:
+		return m, false
+	}
+	m.Output.Query, m.Output.Matches = "", nil
+	m.refreshOutput()
+	m.Output.Viewport.GotoBottom()
+	return m, true
+}
+
+// matrixRows returns how many runs the results table shows at once
+func (m App) matrixRows() int {
+	_, height := m.paneSize()
+	return min(len(m.Output.Steps), max(height/3, 3))
+}
+
+// renderMatrix renders the results table of a matrix: the values of each run,
+// its exit code and how long it took, around the selected run
+func (m App) renderMatrix(width int) []string {
+	labelWidth := 0
+	for _, step := range m.Output.Steps {
+		labelWidth = max(labelWidth, lipgloss.Width(step.Name))
+	}
+	labelWidth = min(labelWidth, max(width/2, 10))
+	label := lipgloss.NewStyle().Width(labelWidth).MaxWidth(labelWidth)
+	exit := lipgloss.NewStyle().Width(9)
+
+	header := lipgloss.NewStyle().Foreground(lipgloss.Color("245")).Bold(true).MaxWidth(width).
+		Render("    " + label.Render("run") + "  " + exit.Render("exit") + "time")
+	lines := []string{header}
+
+	rows := m.matrixRows()
+	start := min(max(m.Output.Selected-rows/2, 0), len(m.Output.Steps)-rows)
+	for i := start; i < start+rows; i++ {
+		step := m.Output.Steps[i]
+		icon, color, code, detail := "○", lipgloss.Color("240"), "", "queued"
+		switch {
+		case step.Result != nil:
+			icon, color = "✓", lipgloss.Color("46")
+			if step.Result.Failed() {
+				icon, color = "✗", lipgloss.Color("196")
+			}
+			code = fmt.Sprintf("%d", step.Result.ExitCode)
+			detail = formatDuration(step.Result.Duration())
+			if step.Result.Err != nil {
+				detail += " " + step.Result.Err.Error()
+			}
+		case step.running():
+			icon, color, detail = "●", lipgloss.Color("226"), "running "+formatDuration(time.Since(step.Capture.Started))
+		case m.Output.Result != nil || m.Output.Halted:
+			icon, detail = "–", "skipped"
+		}
+
+		cursor := "  "
+		style := lipgloss.NewStyle().Foreground(color)
+		if i == m.Output.Selected {
+			cursor = "› "
+			style = style.Bold(true)
+		}
+		lines = append(lines, style.MaxWidth(width).
+			Render(cursor+icon+" "+label.Render(step.Name)+"  "+exit.Render(code)+detail))
+	}
+	return lines
+}
+
+// matrixStatus describes how far the runs of a matrix got
+func (m App) matrixStatus() string {
+	done, running := 0, 0
+	for _, step := range m.Output.Steps {
+		if step.running() {
+			running++
+		} else if step.Result != nil {
+			done++
+		}
+	}
+	status := fmt.Sprintf("● %d/%d done, %d running (up to %d at once) since %s", done, len(m.Output.Steps),
+		running, m.Output.Concurrency, m.Output.Started.Format("15:04:05"))
+	if m.Output.Halted {
+		status = fmt.Sprintf("● stopping, waiting for %d run(s)", running)
+	}
+	return lipgloss.NewStyle().Foreground(lipgloss.Color("226")).Render(status)
+}
+
+// fanOut runs node once for every combination of the values picked in the
+// input dialog, after confirmation when the command asks for it
+func (m App) fanOut(node *tree.TreeNode) (App, tea.Cmd) {
+	if m.Background {
+		m.InputError = "runs with several values cannot run in the background, pick one value each"
+		return m, nil
+	}
+	runs, err := m.matrixRuns(node)
+	if err != nil {
+		m.InputError = err.Error()
+		return m, nil
+	}
+	if err := m.rememberValues(node); err != nil {
+		m.StatusError = err.Error()
+	}
+	m.ShowInputs = false
+	m.InputFields = []InputField{}
+
+	if node.Confirm {
+		m.ShowConfirm = true
+		m.ConfirmYes = true
+		// The dialog shows the first run
+		m.PendingSpec, m.InputValues = runs[0].Spec, runs[0].Values
+		m.PendingMatrix = runs
+		return m, nil
+	}
+	return m.startMatrix(node, runs)
+}
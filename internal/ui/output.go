@@ -0,0 +1,443 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmy/iz/internal/history"
+	"github.com/charmy/iz/internal/tree"
+)
+
+// maxOutputLines limits the scrollback kept for captured output
+const maxOutputLines = 10000
+
+// outputRefreshInterval is how often streamed output is rendered, rendering
+// the whole scrollback for every line would slow down with each line
+const outputRefreshInterval = 50 * time.Millisecond
+
+// outputRefreshMsg renders the lines that arrived since the last render
+type outputRefreshMsg struct{}
+
+// Pane identifies which pane receives navigation keys
+type Pane int
+
+const (
+	PaneCommands Pane = iota
+	PaneDetails
+	PaneOutput
+)
+
+// OutputPane holds the captured output of a command run with `o`
+type OutputPane struct {
+	Visible  bool
+	Capture  *tree.Capture
+	Command  string
+	Lines    []OutputLine
+	Result   *tree.CommandFinishedMsg
+	StartErr error
+
+	// Steps of a command made of steps or run after the commands it needs.
+	// Step is the one Asking for confirmation. Once Halted no more steps
+	// start and the run ends with HaltCode and HaltErr. Parallel is set when
+	// steps may run at the same time, StepsEntry is recorded when the run ends.
+	Steps      []StepRun
+	Step       int
+	Asking     bool
+	Halted     bool
+	HaltCode   int
+	HaltErr    error
+	Parallel   bool
+	Started    time.Time
+	StepsEntry history.Entry
+
+	// Matrix is set when the steps are the runs of a command fanned out over
+	// several values, Concurrency of them at once. Selected is the run picked
+	// in the results table, Drill shows its output only.
+	Matrix      bool
+	Concurrency int
+	Selected    int
+	Drill       bool
+
+	Viewport viewport.Model
+	// Stale is set when lines arrived since the last render, Refreshing while
+	// a render is scheduled
+	Stale      bool
+	Refreshing bool
+
+	// Search within output
+	Searching bool
+	Search    textinput.Model
+	Query     string
+	Matches   []int
+	Match     int
+}
+
+// OutputLine is a single captured line of output. Header lines announce a step.
+type OutputLine struct {
+	Text   string
+	Stderr bool
+	Header bool
+}
+
+// Running reports whether the captured command is still executing
+func (o OutputPane) Running() bool {
+	return (o.Capture != nil || len(o.Steps) > 0) && o.Result == nil
+}
+
+func newOutputPane() OutputPane {
+	search := textinput.New()
+	search.Prompt = "/"
+	search.Placeholder = "search output"
+	search.CharLimit = 100
+
+	vp := viewport.New(0, 0)
+	vp.SetHorizontalStep(8)
+
+	return OutputPane{
+		Viewport: vp,
+		Search:   search,
+	}
+}
+
+// startCapture runs spec with its output streamed into the output pane
+func (m App) startCapture(spec tree.RunSpec) (App, tea.Cmd) {
+	m.resetOutput(spec.String())
+	m.resizeOutput()
+
+	capture, err := tree.StartCapture(spec)
+	m.Output.Capture = capture
+	if err != nil {
+		m.Output.StartErr = err
+		m.refreshOutput()
+		return m, nil
+	}
+
+	m.refreshOutput()
+	return m, capture.Wait()
+}
+
+// resetOutput stops the command in the output pane and clears it for command
+func (m *App) resetOutput(command string) {
+	*m = m.stopOutput()
+	if len(m.Output.Steps) > 0 && m.Output.Result == nil {
+		// The steps are cut short, their run is recorded right away
+		*m = m.finishSteps()
+	}
+
+	m.Output.Visible = true
+	m.Output.Command = command
+	m.Output.Capture = nil
+	m.Output.Lines = nil
+	m.Output.Result = nil
+	m.Output.StartErr = nil
+	m.Output.Steps = nil
+	m.Output.Step = 0
+	m.Output.Asking = false
+	m.Output.Halted, m.Output.HaltCode, m.Output.HaltErr = false, 0, nil
+	m.Output.Parallel = false
+	m.Output.Matrix, m.Output.Concurrency = false, 0
+	m.Output.Selected, m.Output.Drill = 0, false
+	m.Output.Query = ""
+	m.Output.Matches = nil
+	m.Focus = PaneOutput
+}
+
+// handleOutputMsg appends streamed output or records the final result
+func (m App) handleOutputMsg(msg tea.Msg) (App, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tree.OutputLineMsg:
+		step := m.Output.stepOf(msg.Capture)
+		if msg.Capture == m.Output.Capture || step >= 0 {
+			text := msg.Line
+			if step >= 0 && m.Output.Parallel {
+				// Steps running at the same time interleave their lines
+				text = fmt.Sprintf("[%s] %s", m.Output.Steps[step].Name, text)
+			}
+			m.Output.Lines = append(m.Output.Lines, OutputLine{Text: text, Stderr: msg.Stderr})
+			if len(m.Output.Lines) > maxOutputLines {
+				m.Output.Lines = m.Output.Lines[len(m.Output.Lines)-maxOutputLines:]
+			}
+			if step >= 0 && m.Output.Matrix {
+				run := &m.Output.Steps[step]
+				run.Lines = append(run.Lines, OutputLine{Text: msg.Line, Stderr: msg.Stderr})
+				if len(run.Lines) > maxOutputLines {
+					run.Lines = run.Lines[len(run.Lines)-maxOutputLines:]
+				}
+			}
+			return m, tea.Batch(msg.Capture.Wait(), m.scheduleRefresh())
+		}
+		// Keep draining stale captures so their goroutines can exit
+		return m, msg.Capture.Wait()
+	case tree.CommandFinishedMsg:
+		if msg.Capture != nil && msg.Capture == m.Output.Capture {
+			m.Output.Result = &msg
+		}
+	}
+	return m, nil
+}
+
+func (m App) handleOutputKeys(msg tea.KeyMsg) (App, tea.Cmd) {
+	if m.Output.Searching {
+		switch msg.String() {
+		case "enter":
+			m.Output.Searching = false
+			m.Output.Search.Blur()
+			m.Output.Query = m.Output.Search.Value()
+			m.Output.Match = 0
+			m.refreshOutput()
+			m.jumpToMatch(0)
+			return m, nil
+		case "esc":
+			m.Output.Searching = false
+			m.Output.Search.Blur()
+			return m, nil
+		}
+		var cmd tea.Cmd
+		m.Output.Search, cmd = m.Output.Search.Update(msg)
+		return m, cmd
+	}
+
+	if m.Output.Asking {
+		switch msg.String() {
+		case "y", "enter":
+			return m.answerStep(true)
+		case "n":
+			return m.answerStep(false)
+		}
+	}
+	if m.Output.Matrix {
+		if m, handled := m.handleMatrixKeys(msg.String()); handled {
+			return m, nil
+		}
+	}
+
+	switch msg.String() {
+	case "/":
+		m.Output.Searching = true
+		m.Output.Search.SetValue(m.Output.Query)
+		m.Output.Search.CursorEnd()
+		return m, m.Output.Search.Focus()
+	case "n":
+		m.jumpToMatch(m.Output.Match + 1)
+		return m, nil
+	case "N":
+		m.jumpToMatch(m.Output.Match - 1)
+		return m, nil
+	case "x":
+		return m.stopOutput(), nil
+	case "c":
+		m = m.stopOutput()
+		m.Output.Visible = false
+		m.Focus = PaneCommands
+		return m, nil
+	case "tab", "esc":
+		m.Focus = PaneCommands
+		return m, nil
+	case "g", "home":
+		m.Output.Viewport.GotoTop()
+		return m, nil
+	case "G", "end":
+		m.Output.Viewport.GotoBottom()
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.Output.Viewport, cmd = m.Output.Viewport.Update(msg)
+	return m, cmd
+}
+
+// jumpToMatch scrolls to the i-th search match, wrapping around
+func (m *App) jumpToMatch(i int) {
+	if len(m.Output.Matches) == 0 {
+		return
+	}
+	i = (i + len(m.Output.Matches)) % len(m.Output.Matches)
+	m.Output.Match = i
+	m.refreshOutput()
+	m.Output.Viewport.SetYOffset(m.Output.Matches[i] - m.Output.Viewport.Height/2)
+}
+
+// scheduleRefresh marks the output pane as stale and renders it once
+// outputRefreshInterval has passed, unless a render is already scheduled
+func (m *App) scheduleRefresh() tea.Cmd {
+	m.Output.Stale = true
+	if m.Output.Refreshing {
+		return nil
+	}
+	m.Output.Refreshing = true
+	return tea.Tick(outputRefreshInterval, func(time.Time) tea.Msg { return outputRefreshMsg{} })
+}
+
+// flushOutput renders the lines that arrived since the last render, following
+// the output if it was scrolled to the bottom
+func (m App) flushOutput() App {
+	m.Output.Refreshing = false
+	if !m.Output.Stale {
+		return m
+	}
+	atBottom := m.Output.Viewport.AtBottom()
+	m.refreshOutput()
+	if atBottom {
+		m.Output.Viewport.GotoBottom()
+	}
+	return m
+}
+
+// refreshOutput re-renders captured lines into the viewport, highlighting search matches
+func (m *App) refreshOutput() {
+	m.Output.Stale = false
+	stderrStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("203"))
+	headerStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("39")).Bold(true)
+	matchStyle := lipgloss.NewStyle().Background(lipgloss.Color("58")).Foreground(lipgloss.Color("230"))
+	currentStyle := lipgloss.NewStyle().Background(lipgloss.Color("214")).Foreground(lipgloss.Color("0"))
+
+	query := strings.ToLower(m.Output.Query)
+	m.Output.Matches = m.Output.Matches[:0]
+
+	shown := m.Output.shownLines()
+	lines := make([]string, 0, len(shown)+1)
+	for i, line := range shown {
+		text := line.Text
+		if query != "" && strings.Contains(strings.ToLower(text), query) {
+			style := matchStyle
+			if len(m.Output.Matches) == m.Output.Match {
+				style = currentStyle
+			}
+			m.Output.Matches = append(m.Output.Matches, i)
+			lines = append(lines, highlightAll(text, query, style))
+			continue
+		}
+		if line.Header {
+			text = headerStyle.Render(text)
+		} else if line.Stderr {
+			text = stderrStyle.Render(text)
+		}
+		lines = append(lines, text)
+	}
+	if m.Output.StartErr != nil {
+		lines = append(lines, stderrStyle.Render(fmt.Sprintf("failed to start: %v", m.Output.StartErr)))
+	}
+
+	m.Output.Viewport.SetContent(strings.Join(lines, "\n"))
+}
+
+// shownLines returns the output of the run picked in the results table of a
+// matrix, or all output
+func (o OutputPane) shownLines() []OutputLine {
+	if o.Drill && o.Selected < len(o.Steps) {
+		return o.Steps[o.Selected].Lines
+	}
+	return o.Lines
+}
+
+// highlightAll styles every case-insensitive occurrence of query in text
+func highlightAll(text, query string, style lipgloss.Style) string {
+	lower := strings.ToLower(text)
+	if len(lower) != len(text) {
+		// Case folding changed byte offsets, highlight the whole line instead
+		return style.Render(text)
+	}
+	var b strings.Builder
+	for {
+		idx := strings.Index(lower, query)
+		if idx < 0 || query == "" {
+			b.WriteString(text)
+			return b.String()
+		}
+		b.WriteString(text[:idx])
+		b.WriteString(style.Render(text[idx : idx+len(query)]))
+		text = text[idx+len(query):]
+		lower = lower[idx+len(query):]
+	}
+}
+
+// resizeOutput fits the output viewport into its pane
+func (m *App) resizeOutput() {
+	paneWidth, contentHeight := m.paneSize()
+	// Padding, title and the status and search lines take up space inside the pane
+	m.Output.Viewport.Width = max(paneWidth-2, 0)
+	m.Output.Viewport.Height = max(contentHeight-6-m.stepRows(), 0)
+}
+
+// stepRows returns how many lines the steps or the results table of a matrix
+// take up in the output pane
+func (m App) stepRows() int {
+	if m.Output.Matrix {
+		// The table has a header
+		return m.matrixRows() + 1
+	}
+	return len(m.Output.Steps)
+}
+
+func (m App) renderOutput() string {
+	var statusLine string
+	switch {
+	case m.Output.StartErr != nil:
+		statusLine = lipgloss.NewStyle().Foreground(lipgloss.Color("196")).Render("✗ could not start command")
+	case len(m.Output.Steps) > 0 && m.Output.Result == nil:
+		statusLine = m.stepsStatus()
+	case m.Output.Result == nil:
+		statusLine = lipgloss.NewStyle().Foreground(lipgloss.Color("226")).
+			Render(fmt.Sprintf("● running since %s", m.Output.Capture.Started.Format("15:04:05")))
+	default:
+		statusLine = renderResult(*m.Output.Result)
+	}
+
+	var searchLine string
+	switch {
+	case m.Output.Searching:
+		searchLine = m.Output.Search.View()
+	case m.Output.Query != "":
+		matchInfo := "no matches"
+		if len(m.Output.Matches) > 0 {
+			matchInfo = fmt.Sprintf("%d/%d", m.Output.Match+1, len(m.Output.Matches))
+		}
+		searchLine = lipgloss.NewStyle().Foreground(lipgloss.Color("240")).
+			Render(fmt.Sprintf("/%s  %s", m.Output.Query, matchInfo))
+	default:
+		searchLine = lipgloss.NewStyle().Foreground(lipgloss.Color("240")).
+			Render(fmt.Sprintf("%d lines • %3.f%%", len(m.Output.shownLines()), m.Output.Viewport.ScrollPercent()*100))
+		if m.Output.Drill {
+			searchLine += lipgloss.NewStyle().Foreground(lipgloss.Color("240")).
+				Render(" • " + m.Output.Steps[m.Output.Selected].Name)
+		}
+	}
+
+	sections := append([]string{statusLine}, m.renderSteps(m.Output.Viewport.Width)...)
+	sections = append(sections, m.Output.Viewport.View(), searchLine)
+	return lipgloss.JoinVertical(lipgloss.Left, sections...)
+}
+
+// resultSummary describes how a command finished, e.g. "✗ exited 2 after 3.4s"
+func resultSummary(result tree.CommandFinishedMsg) string {
+	switch {
+	case result.Err != nil:
+		return fmt.Sprintf("✗ %v", result.Err)
+	case result.ExitCode != 0:
+		return fmt.Sprintf("✗ exited %d after %s", result.ExitCode, formatDuration(result.Duration()))
+	default:
+		return fmt.Sprintf("✓ exited 0 after %s", formatDuration(result.Duration()))
+	}
+}
+
+// renderResult renders the result summary in red or green
+func renderResult(result tree.CommandFinishedMsg) string {
+	color := lipgloss.Color("46")
+	if result.Failed() {
+		color = lipgloss.Color("196")
+	}
+	return lipgloss.NewStyle().Foreground(color).Render(resultSummary(result))
+}
+
+// formatDuration renders a duration with a precision suited for command runtimes
+func formatDuration(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(100 * time.Millisecond).String()
+}
@@ -0,0 +1,189 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmy/iz/internal/config"
+	"github.com/charmy/iz/internal/tree"
+)
+
+// configPollInterval is how often the config files are checked for changes
+const configPollInterval = time.Second
+
+// configEditedMsg is sent when the external editor exits
+type configEditedMsg struct{}
+
+// configTickMsg triggers a check of the config files for changes
+type configTickMsg struct{}
+
+// fileStamp identifies a version of a file on disk
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+	exists  bool
+}
+
+func statFile(path string) fileStamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size(), exists: true}
+}
+
+// watchConfig schedules the next check of the config files
+func watchConfig() tea.Cmd {
+	return tea.Tick(configPollInterval, func(time.Time) tea.Msg {
+		return configTickMsg{}
+	})
+}
+
+// SetConfigFiles sets the files that are watched for changes: every file the
+// config was loaded from plus the locations a config could appear at
+func (m *App) SetConfigFiles(files []string) {
+	watched := append([]string{}, files...)
+	if candidates, err := config.ConfigFiles(); err == nil {
+		for _, candidate := range candidates {
+			if !contains(watched, candidate) {
+				watched = append(watched, candidate)
+			}
+		}
+	}
+
+	m.ConfigStamps = make(map[string]fileStamp)
+	for _, file := range watched {
+		m.ConfigStamps[file] = statFile(file)
+	}
+}
+
+// configChanged reports whether any watched file changed since the last check
+func (m App) configChanged() bool {
+	for file, stamp := range m.ConfigStamps {
+		if statFile(file) != stamp {
+			return true
+		}
+	}
+	return false
+}
+
+// reloadConfig loads and validates the config again and rebuilds the tree.
+// When the config cannot be loaded the last good tree is kept.
+func (m App) reloadConfig() App {
+	cfg, err := config.LoadConfig()
+
+	var diagnostics []config.Diagnostic
+	var files []string
+	if candidates, filesErr := config.ConfigFiles(); filesErr == nil {
+		diagnostics = config.Validate(candidates...)
+	}
+
+	if err != nil {
+		if !config.HasErrors(diagnostics) {
+			diagnostics = append(diagnostics, config.Diagnostic{Severity: config.SeverityError, Message: err.Error()})
+		}
+		// Keep watching what we had plus whatever the broken config consists of
+		for file := range m.ConfigStamps {
+			files = append(files, file)
+		}
+		m.SetConfigFiles(files)
+		m.StatusError = fmt.Sprintf("config reload failed, keeping the previous commands: %s", firstLine(err.Error()))
+	} else {
+		m.SetConfigFiles(cfg.Files)
+		m.DefaultConfirm = cfg.Settings.Confirm
+		root := tree.BuildTreeFromConfig(cfg)
+		diagnostics = append(diagnostics, tree.CheckNeeds(root)...)
+		m = m.replaceTree(root)
+	}
+
+	m.Diagnostics = diagnostics
+	if config.HasErrors(diagnostics) && !m.ShowInputs && !m.ShowConfirm && !m.ShowHelp && !m.ShowEdit {
+		m.ShowDiagnostics = true
+	} else if len(diagnostics) == 0 {
+		m.ShowDiagnostics = false
+	}
+	return m
+}
+
+// replaceTree swaps in a new tree, keeping the expanded state of folders that
+// still exist and the cursor on the previously selected node
+func (m App) replaceTree(newTree *tree.TreeNode) App {
+	expanded := make(map[string]bool)
+	tree.Walk(m.Tree, func(node *tree.TreeNode) {
+		if node.IsFolder {
+			expanded[node.Path] = node.Expanded
+		}
+	})
+
+	var selectedPath string
+	var selectedShortcut bool
+	if node := m.selectedNode(); node != nil {
+		selectedPath, selectedShortcut = node.Path, node.Shortcut
+	}
+
+	m.addShortcuts(newTree)
+	tree.Walk(newTree, func(node *tree.TreeNode) {
+		if state, ok := expanded[node.Path]; ok && node.IsFolder && node.Path != "" {
+			node.Expanded = state
+		}
+	})
+	m.Tree = newTree
+
+	m.selectNode(selectedPath, selectedShortcut)
+	if m.Filter.Active {
+		m.updateFilter()
+	}
+	return m
+}
+
+// selectPath moves the cursor to the node with path, or to its closest
+// surviving ancestor, keeping the cursor within the visible nodes. Commands
+// are preferred over their shortcuts.
+func (m *App) selectPath(path string) {
+	visibleNodes := m.getVisibleNodes()
+	for {
+		shortcut := -1
+		for i, node := range visibleNodes {
+			if node.Path != path {
+				continue
+			}
+			if !node.Shortcut {
+				m.Cursor = i
+				return
+			}
+			if shortcut < 0 {
+				shortcut = i
+			}
+		}
+		if shortcut >= 0 {
+			m.Cursor = shortcut
+			return
+		}
+		if path == "" {
+			break
+		}
+		if i := strings.LastIndex(path, "/"); i >= 0 {
+			path = path[:i]
+		} else {
+			path = ""
+		}
+	}
+	m.Cursor = min(m.Cursor, max(len(visibleNodes)-1, 0))
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
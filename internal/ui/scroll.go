@@ -0,0 +1,104 @@
+package ui
+
+import (
+	"fmt"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// DetailsPane is the scrollable Details pane
+type DetailsPane struct {
+	Viewport viewport.Model
+	// Path of the node shown, the pane scrolls back to the top when it changes
+	Path string
+}
+
+// paneRows returns how many lines of content fit into a pane below its title
+func (m App) paneRows() int {
+	_, contentHeight := m.paneSize()
+	// Padding and the title take up four lines
+	return max(contentHeight-4, 1)
+}
+
+// syncPanes keeps the cursor within the visible part of the Commands pane
+// and the Details pane in sync with the selection and the window size
+func (m *App) syncPanes() {
+	if m.Width == 0 || m.Height == 0 {
+		return
+	}
+
+	rows := m.paneRows()
+	if m.Cursor < m.TreeOffset {
+		m.TreeOffset = m.Cursor
+	}
+	if m.Cursor >= m.TreeOffset+rows {
+		m.TreeOffset = m.Cursor - rows + 1
+	}
+	m.TreeOffset = max(0, min(m.TreeOffset, len(m.getVisibleNodes())-rows))
+
+	paneWidth, _ := m.paneSize()
+	m.Details.Viewport.Width = max(paneWidth-2, 0)
+	m.Details.Viewport.Height = rows
+
+	var path string
+	if node := m.detailsNode(); node != nil {
+		path = node.Path
+	}
+	m.Details.Viewport.SetContent(m.renderDetails())
+	if path != m.Details.Path {
+		m.Details.Path = path
+		m.Details.Viewport.GotoTop()
+	}
+}
+
+func (m App) handleDetailsKeys(msg tea.KeyMsg) (App, tea.Cmd) {
+	switch msg.String() {
+	case "tab":
+		m.Focus = PaneCommands
+		if m.Output.Visible {
+			m.Focus = PaneOutput
+		}
+		return m, nil
+	case "esc":
+		m.Focus = PaneCommands
+		return m, nil
+	case "g", "home":
+		m.Details.Viewport.GotoTop()
+		return m, nil
+	case "G", "end":
+		m.Details.Viewport.GotoBottom()
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.Details.Viewport, cmd = m.Details.Viewport.Update(msg)
+	return m, cmd
+}
+
+// treeScrollInfo describes which part of the tree is shown when it does not fit
+func (m App) treeScrollInfo() string {
+	total := len(m.getVisibleNodes())
+	if m.Filter.Active || total <= m.paneRows() {
+		return ""
+	}
+	end := min(m.TreeOffset+m.paneRows(), total)
+	return fmt.Sprintf("%d-%d of %d", m.TreeOffset+1, end, total)
+}
+
+// detailsScrollInfo shows how far the Details pane is scrolled when it does not fit
+func (m App) detailsScrollInfo() string {
+	if m.Details.Viewport.TotalLineCount() <= m.Details.Viewport.Height {
+		return ""
+	}
+	return fmt.Sprintf("%.f%%", m.Details.Viewport.ScrollPercent()*100)
+}
+
+// renderScrollInfo renders a scroll indicator for a pane title
+func renderScrollInfo(info string) string {
+	if info == "" {
+		return ""
+	}
+	return lipgloss.NewStyle().Foreground(lipgloss.Color("240")).Render("  ↕ " + info)
+}
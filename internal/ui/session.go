@@ -0,0 +1,56 @@
+package ui
+
+import (
+	"github.com/charmy/iz/internal/state"
+	"github.com/charmy/iz/internal/tree"
+)
+
+// RestoreState applies the state of the previous session: open folders, the
+// selected node and the active filter. Entries for nodes that no longer
+// exist are ignored.
+func (m *App) RestoreState(s *state.State) {
+	m.State = s
+	m.addShortcuts(m.Tree)
+
+	tree.Walk(m.Tree, func(node *tree.TreeNode) {
+		if expanded, ok := s.Expanded[node.Path]; ok && node.IsFolder && node.Path != "" {
+			node.Expanded = expanded
+		}
+	})
+	if s.Selected != "" {
+		m.revealPath(s.Selected)
+	}
+	if s.Filter != "" {
+		m.Filter.Active = true
+		m.Filter.Input.SetValue(s.Filter)
+		m.Filter.Input.Focus()
+		m.updateFilter()
+	}
+}
+
+// SaveState records the current session in the state file. Only nodes of
+// the current tree are kept, so removed commands drop out of the state.
+func (m App) SaveState() error {
+	if m.State == nil {
+		return nil
+	}
+
+	m.State.Expanded = make(map[string]bool)
+	tree.Walk(m.Tree, func(node *tree.TreeNode) {
+		if node.IsFolder && node.Path != "" {
+			m.State.Expanded[node.Path] = node.Expanded
+		}
+	})
+
+	m.State.Selected = ""
+	if node := m.selectedNode(); node != nil {
+		m.State.Selected = node.Path
+	}
+
+	m.State.Filter = ""
+	if m.Filter.Active {
+		m.State.Filter = m.Filter.Input.Value()
+	}
+
+	return m.State.Save()
+}
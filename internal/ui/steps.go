@@ -0,0 +1,344 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmy/iz/internal/history"
+	"github.com/charmy/iz/internal/tree"
+)
+
+// errStepsStopped is the error of a command whose steps were stopped with x
+var errStepsStopped = errors.New("stopped")
+
+// StepRun is a step of the command in the output pane, with its capture while
+// it runs and its result once it finished. The runs of a matrix also keep
+// their own Lines and record their Entry in the history.
+type StepRun struct {
+	tree.StepSpec
+	Capture   *tree.Capture
+	Result    *tree.CommandFinishedMsg
+	Confirmed bool
+	Lines     []OutputLine
+	Entry     *history.Entry
+}
+
+// running reports whether the step was started and has not finished yet
+func (s StepRun) running() bool {
+	return s.Capture != nil && s.Result == nil
+}
+
+// succeeded reports whether the steps waiting for this one may start
+func (s StepRun) succeeded() bool {
+	return s.Result != nil && !s.Stops(*s.Result)
+}
+
+// startSteps runs the steps of spec in the output pane, each as soon as the
+// ones it needs succeeded. entry is recorded in the history once they are done.
+func (m App) startSteps(spec tree.RunSpec, entry history.Entry) (App, tea.Cmd) {
+	m.prepareSteps(spec, entry)
+	return m.advanceSteps()
+}
+
+// prepareSteps clears the output pane for the steps of spec without starting any
+func (m *App) prepareSteps(spec tree.RunSpec, entry history.Entry) {
+	m.resetOutput(spec.String())
+	m.Output.Steps = make([]StepRun, len(spec.Steps))
+	for i, step := range spec.Steps {
+		m.Output.Steps[i] = StepRun{StepSpec: step}
+	}
+	m.Output.Parallel = !tree.Sequential(spec.Steps)
+	m.Output.StepsEntry = entry
+	m.Output.Started = time.Now()
+	m.resizeOutput()
+}
+
+// advanceSteps starts the steps whose needs succeeded, as many as the
+// concurrency allows, asks for confirmation of the first one that wants it and
+// ends the run once nothing is left to do
+func (m App) advanceSteps() (App, tea.Cmd) {
+	running := 0
+	for _, step := range m.Output.Steps {
+		if step.running() {
+			running++
+		}
+	}
+
+	var cmds []tea.Cmd
+	for progress := true; progress && !m.Output.Halted; {
+		progress = false
+		for i := range m.Output.Steps {
+			step := &m.Output.Steps[i]
+			if step.Capture != nil || step.Result != nil || !m.Output.stepReady(i) {
+				continue
+			}
+			if m.Output.Concurrency > 0 && running >= m.Output.Concurrency {
+				break
+			}
+			if step.Confirm && !step.Confirmed {
+				if !m.Output.Asking {
+					m.Output.Asking = true
+					m.Output.Step = i
+					m.Focus = PaneOutput
+				}
+				continue
+			}
+			cmd := m.startStep(i)
+			cmds = append(cmds, cmd)
+			if m.Output.Steps[i].running() {
+				running++
+			}
+			// A step that could not start may let others run or stop the run
+			progress = progress || m.Output.Steps[i].Result != nil
+		}
+	}
+
+	for _, step := range m.Output.Steps {
+		if step.running() {
+			return m, tea.Batch(cmds...)
+		}
+	}
+	if m.Output.Asking && !m.Output.Halted {
+		return m, tea.Batch(cmds...)
+	}
+	return m.finishSteps(), tea.Batch(cmds...)
+}
+
+// stepReady reports whether the steps the i-th step needs all succeeded
+func (o OutputPane) stepReady(i int) bool {
+	for _, need := range o.Steps[i].Needs {
+		if !o.Steps[need].succeeded() {
+			return false
+		}
+	}
+	return true
+}
+
+// startStep starts the i-th step and returns the command streaming its output
+func (m *App) startStep(i int) tea.Cmd {
+	step := &m.Output.Steps[i]
+	m.Output.Lines = append(m.Output.Lines, OutputLine{Text: "▶ " + step.Name, Header: true})
+	capture, err := tree.StartCapture(step.Spec)
+	if err != nil {
+		now := time.Now()
+		line := OutputLine{Text: fmt.Sprintf("failed to start: %v", err), Stderr: true}
+		m.Output.Lines = append(m.Output.Lines, line)
+		step.Lines = append(step.Lines, line)
+		m.refreshOutput()
+		m.recordStep(i, tree.CommandFinishedMsg{
+			Command:  step.Spec.String(),
+			ExitCode: -1,
+			Started:  now,
+			Finished: now,
+			Err:      err,
+		})
+		return nil
+	}
+	step.Capture = capture
+	m.Output.Capture = capture
+	m.refreshOutput()
+	m.Output.Viewport.GotoBottom()
+	return capture.Wait()
+}
+
+// stepOf returns the index of the running step with capture, or -1
+func (o OutputPane) stepOf(capture *tree.Capture) int {
+	if o.Result != nil || capture == nil {
+		return -1
+	}
+	for i, step := range o.Steps {
+		if step.Capture == capture && step.Result == nil {
+			return i
+		}
+	}
+	return -1
+}
+
+// finishStep records the result of a step and goes on with the others
+func (m App) finishStep(result tree.CommandFinishedMsg) (App, tea.Cmd) {
+	m.recordStep(m.Output.stepOf(result.Capture), result)
+	return m.advanceSteps()
+}
+
+// recordStep sets the result of the i-th step. The first step that fails
+// without being allowed to halts the run.
+func (m *App) recordStep(i int, result tree.CommandFinishedMsg) {
+	step := &m.Output.Steps[i]
+	step.Result = &result
+	if step.Entry != nil {
+		entry := *step.Entry
+		entry.Finish(result.Started, result.Finished, result.ExitCode, result.Err)
+		m.recordRun(entry)
+	}
+	if step.Stops(result) {
+		err := result.Err
+		if err != nil {
+			err = fmt.Errorf("step %q: %w", step.Name, err)
+		}
+		m.Output.halt(result.ExitCode, err)
+	}
+}
+
+// halt keeps further steps from starting, the run ends with exitCode and err
+// unless it was halted before
+func (o *OutputPane) halt(exitCode int, err error) {
+	if o.Halted {
+		return
+	}
+	o.Halted, o.HaltCode, o.HaltErr = true, exitCode, err
+	o.Asking = false
+}
+
+// finishSteps ends the run of the steps with the outcome of the whole command
+// and records it in the history
+func (m App) finishSteps() App {
+	m.Output.Asking = false
+	if m.Output.Matrix {
+		return m.finishMatrix()
+	}
+	result := tree.CommandFinishedMsg{
+		Command:  m.Output.Command,
+		ExitCode: m.Output.HaltCode,
+		Started:  m.Output.Started,
+		Finished: time.Now(),
+		Err:      m.Output.HaltErr,
+		Capture:  m.Output.Capture,
+	}
+	m.Output.Result = &result
+	m.LastRun = &result
+	m.LastRunPath = m.Output.StepsEntry.Path
+
+	entry := m.Output.StepsEntry
+	entry.Finish(result.Started, result.Finished, result.ExitCode, result.Err)
+	m.recordRun(entry)
+	return m
+}
+
+// answerStep runs the step waiting for confirmation, or halts the run when
+// it is declined
+func (m App) answerStep(run bool) (App, tea.Cmd) {
+	m.Output.Asking = false
+	if run {
+		m.Output.Steps[m.Output.Step].Confirmed = true
+	} else {
+		name := m.Output.Steps[m.Output.Step].Name
+		m.Output.halt(1, fmt.Errorf("step %q was not confirmed", name))
+	}
+	return m.advanceSteps()
+}
+
+// stopOutput stops the command running in the output pane. Steps that have
+// not started yet are skipped.
+func (m App) stopOutput() App {
+	if !m.Output.Running() {
+		return m
+	}
+	if len(m.Output.Steps) == 0 {
+		_ = m.Output.Capture.Stop()
+		return m
+	}
+
+	m.Output.halt(-1, errStepsStopped)
+	running := false
+	for _, step := range m.Output.Steps {
+		if step.running() {
+			_ = step.Capture.Stop()
+			running = true
+		}
+	}
+	if !running {
+		// Nothing left to wait for
+		m = m.finishSteps()
+	}
+	return m
+}
+
+// StopOutput stops the command running in the output pane, called when iz exits
+func (m App) StopOutput() {
+	_ = m.stopOutput()
+}
+
+// renderSteps lists the steps in the output pane with how far they got
+func (m App) renderSteps(width int) []string {
+	if m.Output.Matrix {
+		return m.renderMatrix(width)
+	}
+	nameWidth := 0
+	for _, step := range m.Output.Steps {
+		nameWidth = max(nameWidth, lipgloss.Width(step.Name))
+	}
+
+	var lines []string
+	for i, step := range m.Output.Steps {
+		icon, color, detail := "○", lipgloss.Color("240"), ""
+		switch {
+		case step.Result != nil:
+			icon, color, detail = "✓", lipgloss.Color("46"), formatDuration(step.Result.Duration())
+			if step.Result.Failed() {
+				icon, color = "✗", lipgloss.Color("196")
+				detail = strings.TrimPrefix(resultSummary(*step.Result), "✗ ")
+				if !step.Stops(*step.Result) {
+					detail += " (continued)"
+				}
+			}
+		case step.running():
+			icon, color, detail = "●", lipgloss.Color("226"), "running"
+		case m.Output.Result != nil || m.Output.Halted:
+			icon, detail = "–", "skipped"
+		case i == m.Output.Step && m.Output.Asking:
+			icon, color, detail = "?", lipgloss.Color("214"), "waiting for confirmation"
+		case m.Output.Parallel:
+			detail = m.waitingFor(i)
+		}
+		name := lipgloss.NewStyle().Width(nameWidth).Render(step.Name)
+		lines = append(lines, lipgloss.NewStyle().Foreground(color).MaxWidth(width).
+			Render(fmt.Sprintf("%s %s  %s", icon, name, detail)))
+	}
+	return lines
+}
+
+// waitingFor describes the steps the i-th step still waits for
+func (m App) waitingFor(i int) string {
+	var names []string
+	for _, need := range m.Output.Steps[i].Needs {
+		if !m.Output.Steps[need].succeeded() {
+			names = append(names, m.Output.Steps[need].Name)
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	return "after " + strings.Join(names, ", ")
+}
+
+// stepsStatus describes how far the steps got while they run
+func (m App) stepsStatus() string {
+	if m.Output.Asking {
+		step := m.Output.Steps[m.Output.Step]
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("214")).Bold(true).
+			Render(fmt.Sprintf("? Run step %d/%d %q? y/n", m.Output.Step+1, len(m.Output.Steps), step.Name))
+	}
+	if m.Output.Matrix {
+		return m.matrixStatus()
+	}
+
+	var running []string
+	done := 0
+	for _, step := range m.Output.Steps {
+		if step.running() {
+			running = append(running, step.Name)
+		} else if step.Result != nil {
+			done++
+		}
+	}
+	status := fmt.Sprintf("● %d/%d done, running %s since %s", done, len(m.Output.Steps),
+		strings.Join(running, ", "), m.Output.Started.Format("15:04:05"))
+	if m.Output.Halted {
+		status = fmt.Sprintf("● stopping, waiting for %s", strings.Join(running, ", "))
+	}
+	return lipgloss.NewStyle().Foreground(lipgloss.Color("226")).Render(status)
+}
@@ -4,26 +4,65 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmy/iz/internal/config"
+	"github.com/charmy/iz/internal/history"
 	"github.com/charmy/iz/internal/tree"
 )
 
 // Update handles messages and updates the application state
 func (m App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	m, cmd := m.update(msg)
+	m.syncPanes()
+	return m, cmd
+}
+
+func (m App) update(msg tea.Msg) (App, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
 		key := msg.String()
 		if key == "ctrl+c" {
 			return m, tea.Quit
 		}
+		m.StatusError = ""
+		if m.Output.Searching {
+			// Typed search text must not trigger global shortcuts
+			return m.handleOutputKeys(msg)
+		}
+		if m.Filter.Active {
+			return m.handleFilterKeys(msg)
+		}
+		if m.ShowEdit {
+			// Typed names and commands must not trigger global shortcuts
+			return m.handleEditKeys(msg)
+		}
+		if m.ShowHistory {
+			return m.handleHistoryKeys(msg)
+		}
+		if m.ShowJobs {
+			return m.handleJobsKeys(msg)
+		}
 		if key == "?" {
 			m.ShowHelp = !m.ShowHelp
 			return m, nil
 		}
+		if key == "!" && !m.ShowInputs && !m.ShowConfirm {
+			m.ShowDiagnostics = !m.ShowDiagnostics && len(m.Diagnostics) > 0
+			return m, nil
+		}
+		if key == "H" && !m.ShowInputs && !m.ShowConfirm && !m.ShowHelp && !m.ShowDiagnostics {
+			return m.openHistory()
+		}
+		if key == "B" && !m.ShowInputs && !m.ShowConfirm && !m.ShowHelp && !m.ShowDiagnostics {
+			return m.openJobs()
+		}
 		if key == "e" && !m.ShowInputs && !m.ShowConfirm && !m.ShowHelp {
 			return m, m.openConfigInEditor()
 		}
@@ -32,12 +71,18 @@ func (m App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if m.ShowHelp {
 				m.ShowHelp = false
 				return m, nil
+			} else if m.ShowDiagnostics {
+				m.ShowDiagnostics = false
+				return m, nil
 			} else if m.ShowInputs {
 				// Let handleInputKeys handle ESC for input dialog
 				return m.handleKeyPress(msg)
 			} else if m.ShowConfirm {
 				// Let handleConfirmKeys handle ESC for confirm dialog
 				return m.handleKeyPress(msg)
+			} else if m.Focus != PaneCommands {
+				// Leave the details or output pane before quitting
+				return m.handleKeyPress(msg)
 			} else {
 				// No dialog open, quit the application
 				return m, tea.Quit
@@ -48,8 +93,59 @@ func (m App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.Width = msg.Width
 		m.Height = msg.Height
 		m.Help.Width = msg.Width
+		m.resizeOutput()
+	case tree.OutputLineMsg:
+		if job := m.jobOf(msg.Capture); job != nil {
+			return m.handleJobMsg(job, msg)
+		}
+		return m.handleOutputMsg(msg)
+	case outputRefreshMsg:
+		return m.flushOutput(), nil
+	case jobOutputRefreshMsg:
+		return m.flushJobOutput(), nil
+	case jobsTickMsg:
+		if !m.ShowJobs {
+			m.JobsView.Ticking = false
+			return m, nil
+		}
+		return m, tickJobs()
+	case optionsLoadedMsg:
+		return m.applyOptions(msg)
+	case optionsDueMsg:
+		return m.loadDueOptions(msg)
+	case spinner.TickMsg:
+		if !m.loadingOptions() {
+			return m, nil
+		}
+		var cmd tea.Cmd
+		m.Spinner, cmd = m.Spinner.Update(msg)
+		return m, cmd
+	case configEditedMsg:
+		return m.reloadConfig(), nil
+	case configTickMsg:
+		if m.configChanged() {
+			m = m.reloadConfig()
+		}
+		return m, watchConfig()
 	case tree.CommandFinishedMsg:
-		return m, nil
+		if job := m.jobOf(msg.Capture); job != nil {
+			return m.handleJobMsg(job, msg)
+		}
+		if m.Output.stepOf(msg.Capture) >= 0 {
+			return m.finishStep(msg)
+		}
+		m, cmd := m.handleOutputMsg(msg)
+		if msg.Capture == nil || msg.Capture == m.Output.Capture {
+			// Runs cut short by a newer one do not count as its result
+			m.LastRun = &msg
+			m.LastRunPath = m.RunningPath
+		}
+		if entry, ok := m.Runs[msg.Capture]; ok {
+			delete(m.Runs, msg.Capture)
+			entry.Finish(msg.Started, msg.Finished, msg.ExitCode, msg.Err)
+			m.recordRun(entry)
+		}
+		return m, cmd
 	}
 	return m, nil
 }
@@ -65,9 +161,19 @@ func (m App) handleKeyPress(msg tea.Msg) (App, tea.Cmd) {
 		}
 	}
 
+	if keyMsg, ok := msg.(tea.KeyMsg); ok && m.Focus == PaneOutput && m.Output.Visible {
+		return m.handleOutputKeys(keyMsg)
+	}
+
+	if keyMsg, ok := msg.(tea.KeyMsg); ok && m.Focus == PaneDetails {
+		return m.handleDetailsKeys(keyMsg)
+	}
+
 	if keyMsg, ok := msg.(tea.KeyMsg); ok {
 		key := keyMsg.String()
 		switch key {
+		case "tab":
+			m.Focus = PaneDetails
 		case "up", "k":
 			if m.Cursor > 0 {
 				m.Cursor--
@@ -77,8 +183,51 @@ func (m App) handleKeyPress(msg tea.Msg) (App, tea.Cmd) {
 			if m.Cursor < len(visibleNodes)-1 {
 				m.Cursor++
 			}
+		case "pgup":
+			m.Cursor = max(m.Cursor-m.paneRows(), 0)
+		case "pgdown":
+			m.Cursor = max(min(m.Cursor+m.paneRows(), len(m.getVisibleNodes())-1), 0)
+		case "home", "g":
+			m.Cursor = 0
+		case "end", "G":
+			m.Cursor = max(len(m.getVisibleNodes())-1, 0)
 		case "enter", "r":
+			m.CaptureOutput, m.Background = false, false
+			return m.handleEnter()
+		case "o":
+			m.CaptureOutput, m.Background = true, false
+			return m.handleEnter()
+		case "b":
+			if node, err := m.selectedPlan(); err == nil && node != nil && len(node.Steps) > 0 {
+				m.StatusError = errStepsInBackground.Error()
+				return m, nil
+			}
+			m.CaptureOutput, m.Background = false, true
 			return m.handleEnter()
+		case "/":
+			return m.startFilter()
+		case "s":
+			return m.toggleFavorite()
+		case "a":
+			return m.openEditForm(editAddCommand)
+		case "A":
+			return m.openEditForm(editAddFolder)
+		case "R":
+			return m.openEditForm(editRename)
+		case "E":
+			return m.openEditForm(editNode)
+		case "D":
+			return m.openEditForm(editDelete)
+		case "y":
+			return m.editSelected(m.duplicateNode)
+		case "K":
+			return m.editSelected(moveNode(-1))
+		case "J":
+			return m.editSelected(moveNode(1))
+		case ">":
+			return m.editSelected(m.moveNodeInto)
+		case "<":
+			return m.editSelected(m.moveNodeOut)
 		}
 	}
 	return m, nil
@@ -96,12 +245,21 @@ func (m App) handleConfirmKeys(key string) (App, tea.Cmd) {
 	case "enter":
 		if m.ConfirmYes {
 			m.ShowConfirm = false
-			return m, tree.RunCommandInTerminal(m.PendingCommand)
+			if runs := m.PendingMatrix; len(runs) > 0 {
+				m.PendingMatrix = nil
+				if node, err := m.selectedPlan(); err == nil && node != nil {
+					return m.startMatrix(node, runs)
+				}
+				return m, nil
+			}
+			return m.runCommand(m.PendingSpec)
 		} else {
 			m.ShowConfirm = false
+			m.PendingMatrix = nil
 		}
 	case "esc":
 		m.ShowConfirm = false
+		m.PendingMatrix = nil
 	}
 	return m, nil
 }
@@ -113,15 +271,24 @@ func (m App) handleEnter() (App, tea.Cmd) {
 		if node.IsFolder {
 			node.Expanded = !node.Expanded
 			return m, nil
-		} else if node.Command != "" {
+		} else if node.Runnable() {
+			// The commands it needs run first, their variables are asked for too
+			node, err := tree.PlanNeeds(m.Tree, node)
+			if err != nil {
+				m.StatusError = err.Error()
+				return m, nil
+			}
 			// Check if command has variables
-			variables := tree.ExtractVariables(node.Command)
+			variables, err := node.InputVariables()
+			if err != nil {
+				m.StatusError = err.Error()
+				return m, nil
+			}
 			if len(variables) > 0 {
 				// Show input dialog for variables
 				m.ShowInputs = true
 				m.InputCursor = 0
 				m.InputFields = []InputField{}
-
 				for _, varName := range variables {
 					// Check if this variable has predefined options
 					var varConfig *config.VariableConfig
@@ -132,13 +299,42 @@ func (m App) handleEnter() (App, tea.Cmd) {
 						}
 					}
 
-					if varConfig != nil && len(varConfig.Options) > 0 {
+					// Defaults from the config win over inline {name:-default} ones
+					defaultValue, _ := node.InlineDefault(varName)
+					if varConfig != nil && varConfig.Default != "" {
+						defaultValue = varConfig.Default
+					}
+
+					// The value used last time wins over both
+					recent := m.recentValues(node, varConfig, varName)
+					configDefault := defaultValue
+					if len(recent) > 0 {
+						defaultValue = recent[0]
+					}
+
+					if varConfig != nil && varConfig.Kind() == config.TypeBool && len(varConfig.Options) == 0 {
+						// Bool variables are toggled rather than typed
+						// The text input is never shown, it only takes focus like the others
+						field := InputField{
+							Name:      varName,
+							TextInput: textinput.New(),
+							Variable:  varConfig,
+							IsToggle:  true,
+							Optional:  true,
+							History:   recent,
+						}
+						field.Checked, _ = strconv.ParseBool(defaultValue)
+						m.InputFields = append(m.InputFields, field)
+					} else if varConfig != nil && (len(varConfig.Options) > 0 || varConfig.OptionsFrom != nil) {
 						// Create choice field
 						defaultChoice := 0
-						selectedValue := varConfig.Options[0].Value
-						if varConfig.Default != "" {
+						selectedValue := ""
+						if len(varConfig.Options) > 0 {
+							selectedValue = varConfig.Options[0].Value
+						}
+						if defaultValue != "" {
 							for i, opt := range varConfig.Options {
-								if opt.Value == varConfig.Default {
+								if opt.Value == defaultValue {
 									defaultChoice = i
 									selectedValue = opt.Value
 									break
@@ -152,7 +348,7 @@ func (m App) handleEnter() (App, tea.Cmd) {
 						customInput.Width = 30
 						customInput.CharLimit = 100
 
-						m.InputFields = append(m.InputFields, InputField{
+						field := InputField{
 							Name:          varName,
 							Placeholder:   fmt.Sprintf("Select %s", varName),
 							IsChoice:      true,
@@ -160,22 +356,52 @@ func (m App) handleEnter() (App, tea.Cmd) {
 							Choice:        defaultChoice,
 							SelectedValue: selectedValue,
 							CustomInput:   customInput,
-						})
+							Optional:      node.Optional(varName),
+							Variable:      varConfig,
+							History:       recent,
+						}
+						if varConfig.OptionsFrom != nil {
+							// The loaded options come first, the value is selected once they are in
+							field.Loading = true
+							field.Draft = defaultValue
+							field.TextInput = textinput.New()
+							field.TextInput.Placeholder = fmt.Sprintf("Enter %s", varName)
+							field.TextInput.Width = 40
+							field.TextInput.CharLimit = 100
+						} else if len(recent) > 0 {
+							// Remembered values that are not an option were entered as custom
+							field.setValue(recent[0])
+						}
+						m.InputFields = append(m.InputFields, field)
 					} else {
 						// Create text input field
 						ti := textinput.New()
 						ti.Placeholder = fmt.Sprintf("Enter %s", varName)
 						ti.Width = 40
 						ti.CharLimit = 100
-						if varConfig != nil && varConfig.Default != "" {
-							ti.SetValue(varConfig.Default)
+						if defaultValue != "" {
+							ti.SetValue(defaultValue)
+						} else if node.Optional(varName) {
+							ti.Placeholder = fmt.Sprintf("Enter %s (optional)", varName)
 						}
 
-						m.InputFields = append(m.InputFields, InputField{
-							Name:        varName,
-							Placeholder: fmt.Sprintf("Enter %s", varName),
-							TextInput:   ti,
-						})
+						historyIndex := -1
+						if len(recent) > 0 {
+							historyIndex = 0
+						}
+
+						field := InputField{
+							Name:         varName,
+							Placeholder:  fmt.Sprintf("Enter %s", varName),
+							TextInput:    ti,
+							Optional:     node.Optional(varName),
+							Variable:     varConfig,
+							History:      recent,
+							HistoryIndex: historyIndex,
+							Draft:        configDefault,
+						}
+						field.setupTextInput()
+						m.InputFields = append(m.InputFields, field)
 					}
 				}
 
@@ -184,19 +410,30 @@ func (m App) handleEnter() (App, tea.Cmd) {
 					firstField := &m.InputFields[0]
 					if !firstField.IsChoice {
 						firstField.TextInput.Focus()
+					} else if firstField.ShowCustomInput {
+						firstField.CustomInput.Focus()
 					}
 				}
-				m.PendingCommand = node.Command
-				return m, nil
+				m.PendingCommand = node.DisplayCommand()
+				m.InputError = ""
+				cmd := m.resolveFields(true, false)
+				m.skipHidden(1)
+				return m, cmd
 			} else {
 				// No variables, proceed as normal
+				m.InputValues = nil
+				spec, err := node.Expand(nil)
+				if err != nil {
+					m.StatusError = err.Error()
+					return m, nil
+				}
 				if node.Confirm {
 					m.ShowConfirm = true
 					m.ConfirmYes = true
-					m.PendingCommand = node.Command
+					m.PendingSpec = spec
 					return m, nil
 				} else {
-					return m, tree.RunCommandInTerminal(node.Command)
+					return m.runCommand(spec)
 				}
 			}
 		}
@@ -204,7 +441,8 @@ func (m App) handleEnter() (App, tea.Cmd) {
 	return m, nil
 }
 
-func (m App) handleInputKeys(msg tea.Msg) (App, tea.Cmd) {
+// handleInputKey handles a key in the input dialog, see handleInputKeys
+func (m App) handleInputKey(msg tea.Msg) (App, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
 		// Handle quit keys in input mode
@@ -237,6 +475,35 @@ func (m App) handleInputKeys(msg tea.Msg) (App, tea.Cmd) {
 			return m, nil
 		}
 
+		currentField := &m.InputFields[m.InputCursor]
+		if currentField.IsToggle {
+			switch msg.String() {
+			case " ", "x", "left", "right":
+				currentField.Checked = !currentField.Checked
+				return m, nil
+			}
+		} else if msg.String() == "right" && currentField.acceptSuggestion() {
+			currentField.Error = currentField.validate()
+			return m, nil
+		} else if currentField.IsChoice && !currentField.ShowCustomInput {
+			// Typing narrows down the options
+			switch {
+			case msg.Type == tea.KeySpace:
+				currentField.toggleMulti()
+				return m, nil
+			case msg.Type == tea.KeyRunes:
+				currentField.setFilter(currentField.Filter + string(msg.Runes))
+				return m, nil
+			case msg.Type == tea.KeyBackspace && currentField.Filter != "":
+				filter := []rune(currentField.Filter)
+				currentField.setFilter(string(filter[:len(filter)-1]))
+				return m, nil
+			case msg.Type == tea.KeyEsc && currentField.Filter != "":
+				currentField.setFilter("")
+				return m, nil
+			}
+		}
+
 		switch msg.Type {
 		case tea.KeyTab:
 			// Switch between input fields
@@ -261,21 +528,14 @@ func (m App) handleInputKeys(msg tea.Msg) (App, tea.Cmd) {
 			}
 		case tea.KeyUp:
 			currentField := &m.InputFields[m.InputCursor]
+			if !currentField.IsChoice && !currentField.IsToggle && len(currentField.History) > 0 {
+				// Recall older values instead of moving between fields
+				currentField.recallValue(currentField.HistoryIndex + 1)
+				return m, nil
+			}
 			if currentField.IsChoice && !currentField.ShowCustomInput {
 				// Navigate choice options
-				if currentField.Choice > 0 {
-					currentField.Choice--
-					currentField.SelectedValue = currentField.Options[currentField.Choice].Value
-
-					// Check if "custom" is selected
-					if currentField.SelectedValue == "custom" {
-						currentField.ShowCustomInput = true
-						currentField.CustomInput.Focus()
-					} else {
-						currentField.ShowCustomInput = false
-						currentField.CustomInput.Blur()
-					}
-				} else {
+				if !currentField.moveChoice(-1) {
 					// If we're at the first choice, move to previous field
 					if m.InputCursor > 0 {
 						m.InputCursor--
@@ -313,21 +573,13 @@ func (m App) handleInputKeys(msg tea.Msg) (App, tea.Cmd) {
 			}
 		case tea.KeyDown:
 			currentField := &m.InputFields[m.InputCursor]
+			if !currentField.IsChoice && !currentField.IsToggle && len(currentField.History) > 0 {
+				currentField.recallValue(currentField.HistoryIndex - 1)
+				return m, nil
+			}
 			if currentField.IsChoice && !currentField.ShowCustomInput {
 				// Navigate choice options
-				if currentField.Choice < len(currentField.Options)-1 {
-					currentField.Choice++
-					currentField.SelectedValue = currentField.Options[currentField.Choice].Value
-
-					// Check if "custom" is selected
-					if currentField.SelectedValue == "custom" {
-						currentField.ShowCustomInput = true
-						currentField.CustomInput.Focus()
-					} else {
-						currentField.ShowCustomInput = false
-						currentField.CustomInput.Blur()
-					}
-				} else {
+				if !currentField.moveChoice(1) {
 					// If we're at the last choice, move to next field
 					if m.InputCursor < len(m.InputFields)-1 {
 						m.InputCursor++
@@ -364,54 +616,51 @@ func (m App) handleInputKeys(msg tea.Msg) (App, tea.Cmd) {
 				}
 			}
 		case tea.KeyEnter:
-			// Check if all fields are filled
-			allFilled := true
-			for _, field := range m.InputFields {
-				if field.IsChoice {
-					if field.SelectedValue == "custom" && strings.TrimSpace(field.CustomInput.Value()) == "" {
-						allFilled = false
-						break
-					}
-				} else if strings.TrimSpace(field.TextInput.Value()) == "" {
-					allFilled = false
-					break
-				}
-			}
-
-			if allFilled {
-				// Populate inputValues map
+			// Every field has to hold a usable value
+			if m.validateInputs() {
 				m.InputValues = make(map[string]string)
 				for _, field := range m.InputFields {
-					if field.IsChoice {
-						if field.SelectedValue == "custom" {
-							m.InputValues[field.Name] = field.CustomInput.Value()
-						} else {
-							m.InputValues[field.Name] = field.SelectedValue
-						}
-					} else {
-						m.InputValues[field.Name] = field.TextInput.Value()
+					if !field.Hidden {
+						m.InputValues[field.Name] = field.Value()
 					}
 				}
 
+				node, err := m.selectedPlan()
+				if err != nil {
+					m.InputError = err.Error()
+					return m, nil
+				}
+				if node == nil {
+					return m, nil
+				}
+
+				if m.fanOutCount() > 1 {
+					return m.fanOut(node)
+				}
+
 				// Replace variables in command
-				finalCommand := tree.ReplaceVariables(m.PendingCommand, m.InputValues)
+				spec, err := node.Expand(m.InputValues)
+				if err != nil {
+					m.InputError = err.Error()
+					return m, nil
+				}
+
+				if err := m.rememberValues(node); err != nil {
+					m.StatusError = err.Error()
+				}
 
 				// Reset input state
 				m.ShowInputs = false
 				m.InputFields = []InputField{}
 
 				// Check if this command needs confirmation
-				visibleNodes := m.getVisibleNodes()
-				if m.Cursor < len(visibleNodes) {
-					node := visibleNodes[m.Cursor]
-					if node.Confirm {
-						m.ShowConfirm = true
-						m.ConfirmYes = true
-						m.PendingCommand = finalCommand
-						return m, nil
-					} else {
-						return m, tree.RunCommandInTerminal(finalCommand)
-					}
+				if node.Confirm {
+					m.ShowConfirm = true
+					m.ConfirmYes = true
+					m.PendingSpec = spec
+					return m, nil
+				} else {
+					return m.runCommand(spec)
 				}
 			}
 		case tea.KeyEsc:
@@ -427,11 +676,18 @@ func (m App) handleInputKeys(msg tea.Msg) (App, tea.Cmd) {
 			// Update custom input
 			var cmd tea.Cmd
 			currentField.CustomInput, cmd = currentField.CustomInput.Update(msg)
+			if currentField.Error != "" {
+				currentField.Error = currentField.validate()
+			}
 			return m, cmd
-		} else if !currentField.IsChoice {
+		} else if !currentField.IsChoice && !currentField.IsToggle {
 			// Update regular text input
 			var cmd tea.Cmd
 			currentField.TextInput, cmd = currentField.TextInput.Update(msg)
+			currentField.updateSuggestions()
+			if currentField.Error != "" {
+				currentField.Error = currentField.validate()
+			}
 			return m, cmd
 		}
 	}
@@ -439,6 +695,72 @@ func (m App) handleInputKeys(msg tea.Msg) (App, tea.Cmd) {
 	return m, nil
 }
 
+// runCommand executes spec of the selected node in the terminal or, when
+// requested, with its output captured or in the background
+func (m App) runCommand(spec tree.RunSpec) (App, tea.Cmd) {
+	var path string
+	if node := m.selectedNode(); node != nil {
+		path = node.Path
+	}
+	return m.startRun(path, spec)
+}
+
+// startRun executes spec on behalf of the node at path and records the run in the history
+func (m App) startRun(path string, spec tree.RunSpec) (App, tea.Cmd) {
+	m.RunningPath = path
+	node, _ := tree.FindNode(m.Tree, path)
+	if node != nil && !node.IsFolder {
+		// The values of the commands it needs are masked like its own
+		if plan, err := tree.PlanNeeds(m.Tree, node); err == nil {
+			node = plan
+		}
+	}
+	entry := history.NewEntry(path, node, spec, m.InputValues)
+
+	if len(spec.Steps) > 0 {
+		if m.Background {
+			m.StatusError = errStepsInBackground.Error()
+			return m, nil
+		}
+		// Steps always run in the output pane, which shows their progress
+		return m.startSteps(spec, entry)
+	}
+	if m.Background {
+		return m.startJob(path, spec, entry)
+	}
+	if m.CaptureOutput {
+		m, cmd := m.startCapture(spec)
+		if m.Output.StartErr != nil {
+			entry.Finish(time.Now(), time.Now(), -1, m.Output.StartErr)
+			m.recordRun(entry)
+			return m, cmd
+		}
+		m.Runs[m.Output.Capture] = entry
+		return m, cmd
+	}
+	m.Runs[nil] = entry
+	return m, tree.RunCommandInTerminal(spec)
+}
+
+// selectedPlan returns the node under the cursor together with the commands
+// it needs, see tree.PlanNeeds, or nil
+func (m App) selectedPlan() (*tree.TreeNode, error) {
+	node := m.shortcutTarget(m.selectedNode())
+	if node == nil || node.IsFolder {
+		return node, nil
+	}
+	return tree.PlanNeeds(m.Tree, node)
+}
+
+// selectedNode returns the node under the cursor, or nil
+func (m App) selectedNode() *tree.TreeNode {
+	visibleNodes := m.getVisibleNodes()
+	if m.Cursor < len(visibleNodes) {
+		return visibleNodes[m.Cursor]
+	}
+	return nil
+}
+
 func (m App) getVisibleNodes() []*tree.TreeNode {
 	var nodes []*tree.TreeNode
 	m.collectVisibleNodes(m.Tree, &nodes, 0)
@@ -456,11 +778,18 @@ func (m App) collectVisibleNodes(node *tree.TreeNode, nodes *[]*tree.TreeNode, l
 	}
 }
 
-// openConfigInEditor opens the config file in the default text editor
+// openConfigInEditor opens the file defining the selected node in the default
+// text editor, falling back to the user config file
 func (m App) openConfigInEditor() tea.Cmd {
-	configPath, err := config.GetConfigPath()
-	if err != nil {
-		return nil
+	var configPath string
+	var line int
+	if node := m.selectedNode(); node != nil && node.Source != "" {
+		configPath, line = node.Source, node.Line
+	} else {
+		var err error
+		if configPath, err = config.GetConfigPath(); err != nil {
+			return nil
+		}
 	}
 
 	// Try different editors in order of preference
@@ -475,17 +804,19 @@ func (m App) openConfigInEditor() tea.Cmd {
 	}
 
 	for _, editor := range editors {
-		if editor == "" {
+		// Editors may be configured with arguments, e.g. EDITOR="code -w"
+		fields := strings.Fields(editor)
+		if len(fields) == 0 {
 			continue
 		}
 
 		// Check if editor exists
-		if _, err := exec.LookPath(editor); err == nil {
+		if _, err := exec.LookPath(fields[0]); err == nil {
+			args := append(fields[1:], editorArgs(fields[0], configPath, line)...)
 			return tea.ExecProcess(
-				exec.Command(editor, configPath),
+				exec.Command(fields[0], args...),
 				func(err error) tea.Msg {
-					// After editing, we might want to reload
-					return tree.CommandFinishedMsg{}
+					return configEditedMsg{}
 				},
 			)
 		}
@@ -493,3 +824,16 @@ func (m App) openConfigInEditor() tea.Cmd {
 
 	return nil
 }
+
+// editorArgs returns the arguments that open path at line for editors known to support it
+func editorArgs(editor, path string, line int) []string {
+	if line > 0 {
+		switch filepath.Base(editor) {
+		case "code", "code-insiders", "codium":
+			return []string{"-g", fmt.Sprintf("%s:%d", path, line)}
+		case "vi", "vim", "nvim", "nano", "emacs", "micro", "kak":
+			return []string{fmt.Sprintf("+%d", line), path}
+		}
+	}
+	return []string{path}
+}
@@ -0,0 +1,69 @@
+package ui
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/charmy/iz/internal/config"
+	"github.com/charmy/iz/internal/tree"
+	"gopkg.in/yaml.v3"
+)
+
+func TestStartRunMasksNeededSecrets(t *testing.T) {
+	const source = `
+commands:
+  - name: Login
+    command: echo {token}
+    variables:
+      - name: token
+        secret: true
+  - name: Deploy
+    needs: [Login]
+    command: echo deploy {env}
+    variables:
+      - name: env
+`
+	var cfg config.Config
+	if err := yaml.Unmarshal([]byte(source), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	root := tree.BuildTreeFromConfig(&cfg)
+	node, err := tree.FindNode(root, "Deploy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := tree.PlanNeeds(root, node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]string{"token": "s3cr3tvalue", "env": "prod"}
+	spec, err := plan.Expand(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing is recorded in the user's history
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("XDG_STATE_HOME", "")
+	m := NewApp(root, false)
+	m.InputValues = values
+	m.CaptureOutput = true
+	m, _ = m.startRun("Deploy", spec)
+	defer m.StopOutput()
+
+	// The commands it needs make it a run of steps
+	entry := m.Output.StepsEntry
+	if entry.Path != "Deploy" {
+		t.Fatalf("recorded path = %q, want Deploy", entry.Path)
+	}
+	if strings.Contains(entry.Command, "s3cr3tvalue") {
+		t.Errorf("recorded command %q contains the secret", entry.Command)
+	}
+	if _, ok := entry.Values["token"]; ok {
+		t.Errorf("recorded values %v contain the secret", entry.Values)
+	}
+	if entry.Values["env"] != "prod" || !entry.Redacted {
+		t.Errorf("entry = %+v, want env recorded and the run marked as redacted", entry)
+	}
+}
@@ -0,0 +1,97 @@
+package ui
+
+import (
+	"slices"
+	"strconv"
+
+	"github.com/charmy/iz/internal/config"
+	"github.com/charmy/iz/internal/tree"
+)
+
+// recentValues returns the values recently used for a variable of node,
+// unless the variable opted out with remember: false
+func (m App) recentValues(node *tree.TreeNode, variable *config.VariableConfig, name string) []string {
+	if m.State == nil || (variable != nil && !variable.Remembered()) {
+		return nil
+	}
+	return m.State.RecentValues(node.Path, name, variable != nil && variable.Global)
+}
+
+// rememberValues records the submitted input values of node in the state file
+func (m App) rememberValues(node *tree.TreeNode) error {
+	if m.State == nil {
+		return nil
+	}
+
+	for _, field := range m.InputFields {
+		value := m.InputValues[field.Name]
+		variable := node.Variable(field.Name)
+		if value == "" || (variable != nil && !variable.Remembered()) {
+			continue
+		}
+		m.State.RememberValue(node.Path, field.Name, value, variable != nil && variable.Global)
+	}
+	return m.State.Save()
+}
+
+// recallValue shows the i-th remembered value, or the draft for -1
+func (f *InputField) recallValue(i int) {
+	if i < -1 || i >= len(f.History) {
+		return
+	}
+	if f.HistoryIndex == -1 {
+		f.Draft = f.TextInput.Value()
+	}
+	f.HistoryIndex = i
+	if i == -1 {
+		f.TextInput.SetValue(f.Draft)
+	} else {
+		f.TextInput.SetValue(f.History[i])
+	}
+	f.TextInput.CursorEnd()
+}
+
+// setValue fills in value, selecting the matching option of a choice field or
+// its "custom" option when there is none
+func (f *InputField) setValue(value string) {
+	if f.Loading {
+		// Selected once the options are in
+		f.Draft = value
+		return
+	}
+	if f.IsToggle {
+		if checked, err := strconv.ParseBool(value); err == nil {
+			f.Checked = checked
+		}
+		return
+	}
+	if !f.IsChoice {
+		f.TextInput.SetValue(value)
+		f.TextInput.CursorEnd()
+		f.HistoryIndex = slices.Index(f.History, value)
+		if f.HistoryIndex == -1 {
+			f.Draft = value
+		}
+		return
+	}
+
+	for i, opt := range f.Options {
+		if opt.Value == value {
+			f.Choice, f.SelectedValue, f.ShowCustomInput = i, value, false
+			return
+		}
+	}
+	for i, opt := range f.Options {
+		if opt.Value == "custom" {
+			f.Choice, f.SelectedValue, f.ShowCustomInput = i, "custom", true
+			f.CustomInput.SetValue(value)
+			return
+		}
+	}
+}
+
+// fromHistory reports whether the field holds a value remembered from an earlier run
+func (f InputField) fromHistory() bool {
+	value := f.Value()
+	return value != "" && slices.Contains(f.History, value)
+}
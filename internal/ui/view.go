@@ -2,9 +2,14 @@ package ui
 
 import (
 	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/charmbracelet/lipgloss"
+	"github.com/charmy/iz/internal/config"
 	"github.com/charmy/iz/internal/tree"
 )
 
@@ -14,12 +19,19 @@ func (m App) View() string {
 		return "Loading..."
 	}
 
-	contentHeight := m.Height - 3
-	paneWidth := (m.Width - 4) / 2
+	paneWidth, contentHeight := m.paneSize()
+
+	commands := m.renderTree()
+	if m.Filter.Active {
+		commands = m.renderFilter(m.paneRows())
+	}
 
 	panes := []string{
-		m.renderPane("Commands", m.renderTree(), paneWidth, contentHeight),
-		m.renderPane("Details", m.renderDetails(), paneWidth, contentHeight),
+		m.renderPane("Commands", m.treeScrollInfo(), commands, paneWidth, contentHeight, m.Focus == PaneCommands),
+		m.renderPane("Details", m.detailsScrollInfo(), m.Details.Viewport.View(), paneWidth, contentHeight, m.Focus == PaneDetails),
+	}
+	if m.Output.Visible {
+		panes = append(panes, m.renderPane("Output", "", m.renderOutput(), paneWidth, contentHeight, m.Focus == PaneOutput))
 	}
 
 	content := lipgloss.JoinHorizontal(lipgloss.Top, panes...)
@@ -29,6 +41,22 @@ func (m App) View() string {
 		return m.renderWithHelpDialog(mainView)
 	}
 
+	if m.ShowDiagnostics {
+		return m.renderWithDiagnosticsDialog(mainView)
+	}
+
+	if m.ShowHistory {
+		return m.renderWithHistoryDialog(mainView)
+	}
+
+	if m.ShowJobs {
+		return m.renderWithJobsDialog(mainView)
+	}
+
+	if m.ShowEdit {
+		return m.renderWithEditDialog(mainView)
+	}
+
 	if m.ShowInputs {
 		return m.renderWithInputDialog(mainView)
 	}
@@ -40,19 +68,32 @@ func (m App) View() string {
 	return mainView
 }
 
-func (m App) renderPane(title, content string, width, height int) string {
+// paneSize returns the width and height of each pane for the current layout
+func (m App) paneSize() (width, height int) {
+	if m.Output.Visible {
+		return (m.Width - 6) / 3, m.Height - 3
+	}
+	return (m.Width - 4) / 2, m.Height - 3
+}
+
+func (m App) renderPane(title, scrollInfo, content string, width, height int, focused bool) string {
+	borderColor := lipgloss.Color("240")
+	if focused {
+		borderColor = lipgloss.Color("39")
+	}
+
 	paneStyle := lipgloss.NewStyle().
 		Width(width).
 		Height(height).
 		Border(lipgloss.RoundedBorder()).
-		BorderForeground(lipgloss.Color("240")).
+		BorderForeground(borderColor).
 		Padding(1)
 
 	titleStyle := lipgloss.NewStyle().
 		Bold(true).
 		Foreground(lipgloss.Color("205"))
 
-	finalContent := titleStyle.Render(title) + "\n\n" + content
+	finalContent := titleStyle.Render(title) + renderScrollInfo(scrollInfo) + "\n\n" + content
 	return paneStyle.Render(finalContent)
 }
 
@@ -60,16 +101,29 @@ func (m App) renderTree() string {
 	visibleNodes := m.getVisibleNodes()
 	var lines []string
 
-	for i, node := range visibleNodes {
-		lines = append(lines, m.renderNode(node, i == m.Cursor))
+	// Long names are cut off rather than wrapped so every node takes one row
+	paneWidth, _ := m.paneSize()
+	lineStyle := lipgloss.NewStyle().MaxWidth(max(paneWidth-2, 1))
+
+	end := min(m.TreeOffset+m.paneRows(), len(visibleNodes))
+	for i := m.TreeOffset; i < end; i++ {
+		lines = append(lines, lineStyle.Render(m.renderNode(visibleNodes[i], i == m.Cursor)))
 	}
 
 	return strings.Join(lines, "\n")
 }
 
+// detailsNode returns the node shown in the Details pane
+func (m App) detailsNode() *tree.TreeNode {
+	if m.Filter.Active {
+		return m.filterSelection()
+	}
+	return m.selectedNode()
+}
+
 func (m App) renderDetails() string {
-	visibleNodes := m.getVisibleNodes()
-	if m.Cursor >= len(visibleNodes) {
+	selected := m.detailsNode()
+	if selected == nil {
 		emptyStyle := lipgloss.NewStyle().
 			Foreground(lipgloss.Color("240")).
 			Italic(true).
@@ -77,9 +131,12 @@ func (m App) renderDetails() string {
 		return emptyStyle.Render("No selection")
 	}
 
-	selected := visibleNodes[m.Cursor]
 	var content []string
 
+	// Long commands and descriptions wrap at the pane width
+	paneWidth, _ := m.paneSize()
+	width := max(paneWidth-2, 1)
+
 	// Name with highlight
 	nameStyle := lipgloss.NewStyle().
 		Bold(true).
@@ -90,6 +147,17 @@ func (m App) renderDetails() string {
 	content = append(content, nameStyle.Render(fmt.Sprintf("📋 %s", selected.Name)))
 	content = append(content, "")
 
+	if selected.Source != "" {
+		sourceStyle := lipgloss.NewStyle().
+			Foreground(lipgloss.Color("240"))
+		source := shortenPath(selected.Source)
+		if selected.Line > 0 {
+			source = fmt.Sprintf("%s:%d", source, selected.Line)
+		}
+		content = append(content, sourceStyle.Render(fmt.Sprintf("📄 %s", source)))
+		content = append(content, "")
+	}
+
 	if selected.IsFolder {
 		// Folder details
 		typeStyle := lipgloss.NewStyle().
@@ -111,6 +179,11 @@ func (m App) renderDetails() string {
 			statusStyle = statusStyle.Foreground(lipgloss.Color("202"))
 			content = append(content, statusStyle.Render("⊕ Collapsed"))
 		}
+
+		if context := renderContext(selected, width); len(context) > 0 {
+			content = append(content, "", "Settings for commands inside:")
+			content = append(content, context...)
+		}
 	} else {
 		// Command details
 		typeStyle := lipgloss.NewStyle().
@@ -121,13 +194,24 @@ func (m App) renderDetails() string {
 		content = append(content, typeStyle.Render("⚡ COMMAND"))
 		content = append(content, "")
 
-		if selected.Command != "" {
+		if len(selected.Steps) > 0 {
+			content = append(content, "Steps:")
+			content = append(content, renderStepList(selected, width)...)
+			content = append(content, "")
+		} else if selected.Runnable() {
 			commandStyle := lipgloss.NewStyle().
 				Foreground(lipgloss.Color("39")).
 				Background(lipgloss.Color("237")).
-				Padding(0, 1)
+				Padding(0, 1).
+				Width(width)
 			content = append(content, "Command:")
-			content = append(content, commandStyle.Render(fmt.Sprintf("$ %s", selected.Command)))
+			content = append(content, commandStyle.Render(fmt.Sprintf("$ %s", selected.DisplayCommand())))
+			content = append(content, "")
+		}
+
+		if len(selected.Needs) > 0 {
+			content = append(content, "Needs:")
+			content = append(content, m.renderNeeds(selected, width)...)
 			content = append(content, "")
 		}
 
@@ -136,11 +220,26 @@ func (m App) renderDetails() string {
 				Foreground(lipgloss.Color("250")).
 				Background(lipgloss.Color("238")).
 				Padding(0, 1).
-				Italic(true)
+				Italic(true).
+				Width(width)
 			content = append(content, "Description:")
 			content = append(content, descStyle.Render(selected.Description))
 		}
 
+		if context := renderContext(selected, width); len(context) > 0 {
+			if selected.Description != "" {
+				content = append(content, "")
+			}
+			content = append(content, "Runs with:")
+			content = append(content, context...)
+		}
+
+		if m.LastRun != nil && m.LastRunPath == selected.Path {
+			content = append(content, "")
+			content = append(content, fmt.Sprintf("Last run (%s):", m.LastRun.Started.Format("15:04:05")))
+			content = append(content, renderResult(*m.LastRun))
+		}
+
 		// Add action hint
 		content = append(content, "")
 		hintStyle := lipgloss.NewStyle().
@@ -151,7 +250,133 @@ func (m App) renderDetails() string {
 		content = append(content, hintStyle.Render("💡 Press Enter to run"))
 	}
 
-	return strings.Join(content, "\n")
+	return lipgloss.NewStyle().Width(width).Render(strings.Join(content, "\n"))
+}
+
+// renderContext lists the working directory, shell, environment, timeout,
+// stdin, confirm setting and variables of node, each with the folder it was inherited from
+func renderContext(node *tree.TreeNode, width int) []string {
+	keyStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("214")).Width(9)
+	originStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("240")).Italic(true)
+	origin := func(key string) string {
+		path, ok := node.Origins[key]
+		switch {
+		case !ok || path == node.Path:
+			return ""
+		case path == "":
+			return originStyle.Render("  ← top level")
+		}
+		return originStyle.Render("  ← " + path)
+	}
+	line := func(key, value, originKey string) string {
+		return lipgloss.NewStyle().MaxWidth(width).Render(keyStyle.Render(key) + value + origin(originKey))
+	}
+
+	var lines []string
+	if node.Cwd != "" {
+		lines = append(lines, line("cwd", shortenPath(config.ExpandHome(node.Cwd)), tree.OriginCwd))
+	}
+	if node.Shell != "" {
+		lines = append(lines, line("shell", node.Shell, tree.OriginShell))
+	}
+	for _, name := range slices.Sorted(maps.Keys(node.Env)) {
+		lines = append(lines, line("env", name+"="+node.Env[name], tree.EnvOrigin(name)))
+	}
+	if node.Timeout > 0 {
+		lines = append(lines, line("timeout", node.Timeout.String(), tree.OriginTimeout))
+	}
+	if node.Concurrency > 0 {
+		lines = append(lines, line("parallel", fmt.Sprintf("%d runs at once", node.Concurrency), tree.OriginConcurrency))
+	}
+	if node.Stdin != "" {
+		stdin, rest, more := strings.Cut(strings.TrimSpace(node.Stdin), "\n")
+		if more && rest != "" {
+			stdin += " …"
+		}
+		lines = append(lines, line("stdin", stdin, ""))
+	}
+	if _, ok := node.Origins[tree.OriginConfirm]; ok {
+		confirm := "off"
+		if node.Confirm {
+			confirm = "on"
+		}
+		lines = append(lines, line("confirm", confirm, tree.OriginConfirm))
+	}
+	// Commands list the variables they ask for, folders the ones they pass on
+	names, _ := node.InputVariables()
+	if node.IsFolder {
+		names = nil
+		for _, v := range node.Variables {
+			names = append(names, v.Name)
+		}
+	}
+	for _, name := range names {
+		if node.Variable(name) != nil {
+			lines = append(lines, line("variable", "{"+name+"}", tree.VariableOrigin(name)))
+		}
+	}
+	return lines
+}
+
+// renderNeeds draws the commands node needs as a tree, the ones run first at
+// the bottom
+func (m App) renderNeeds(node *tree.TreeNode, width int) []string {
+	lines, err := tree.NeedsTree(m.Tree, m.shortcutTarget(node))
+	if err != nil {
+		return []string{lipgloss.NewStyle().Foreground(lipgloss.Color("196")).Width(width).Render("✗ " + err.Error())}
+	}
+	style := lipgloss.NewStyle().Foreground(lipgloss.Color("250")).MaxWidth(width)
+	for i, line := range lines {
+		if i == 0 {
+			lines[i] = style.Bold(true).Render(line)
+			continue
+		}
+		lines[i] = style.Render(line)
+	}
+	return lines
+}
+
+// renderStepList lists the steps of node with their commands and settings
+func renderStepList(node *tree.TreeNode, width int) []string {
+	commandStyle := lipgloss.NewStyle().
+		Foreground(lipgloss.Color("39")).
+		Background(lipgloss.Color("237")).
+		Padding(0, 1).
+		Width(width)
+	noteStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("240")).Italic(true)
+
+	var lines []string
+	for i, step := range node.Steps {
+		title := fmt.Sprintf("%d. %s", i+1, step.Name)
+		var notes []string
+		if step.Cwd != "" {
+			notes = append(notes, "in "+shortenPath(config.ExpandHome(step.Cwd)))
+		}
+		if step.Confirm {
+			notes = append(notes, "asks first")
+		}
+		if step.ContinueOnError {
+			notes = append(notes, "may fail")
+		}
+		if len(notes) > 0 {
+			title += noteStyle.Render("  " + strings.Join(notes, ", "))
+		}
+		lines = append(lines, lipgloss.NewStyle().MaxWidth(width).Render(title))
+		lines = append(lines, commandStyle.Render("$ "+step.Command))
+	}
+	return lines
+}
+
+// shortenPath replaces the home directory prefix of path with ~
+func shortenPath(path string) string {
+	home, err := os.UserHomeDir()
+	if err != nil || home == "" {
+		return path
+	}
+	if rel, err := filepath.Rel(home, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.Join("~", rel)
+	}
+	return path
 }
 
 func (m App) renderStatusBar() string {
@@ -161,8 +386,48 @@ func (m App) renderStatusBar() string {
 		Foreground(lipgloss.Color("250")).
 		Padding(0, 1)
 
+	if m.StatusError != "" {
+		return statusStyle.Foreground(lipgloss.Color("196")).Render("✗ " + m.StatusError)
+	}
+
+	if m.Filter.Active {
+		return statusStyle.Render("Type to filter • ↑/↓ to select • Enter to run • Tab to show in tree • ESC to cancel")
+	}
+
+	if m.ShowHistory {
+		if m.History.Filtering {
+			return statusStyle.Render("Type to filter runs • ↑/↓ to select • Enter to keep the filter • ESC to clear it")
+		}
+		return statusStyle.Render("↑/↓ to select • Enter/r to run again • o with output • i to change the values • / to filter • ESC to close")
+	}
+
+	if m.ShowJobs {
+		if m.JobsView.Viewing {
+			return statusStyle.Render("↑/↓/PgUp/PgDn scroll • g/G top/bottom • i/t/x send SIGINT/SIGTERM/SIGKILL • r restart • ESC for jobs")
+		}
+		return statusStyle.Render("↑/↓ select • Enter view output • i/t/x send SIGINT/SIGTERM/SIGKILL • r restart • d/D remove finished • ESC close")
+	}
+
+	if m.ShowEdit {
+		if len(m.Edit.Fields) == 0 {
+			return statusStyle.Render("Enter to confirm • ESC to cancel")
+		}
+		return statusStyle.Render("↑/↓ or Tab/Shift+Tab to switch fields • ←/→ to change a choice • Enter to save • ESC to cancel")
+	}
+
 	if m.ShowInputs {
-		return statusStyle.Render("↑/↓ or Tab/Shift+Tab to switch fields • Enter when all filled • ESC to go back")
+		if m.InputCursor < len(m.InputFields) {
+			field := m.InputFields[m.InputCursor]
+			switch {
+			case field.IsToggle:
+				return statusStyle.Render("Space or ←/→ to toggle • Tab/Shift+Tab or ↑/↓ to switch fields • Enter when all valid • ESC to go back")
+			case field.IsChoice && !field.ShowCustomInput:
+				return statusStyle.Render("Type to filter • ↑/↓ to choose • Space for several • Tab/Shift+Tab for fields • Enter when all valid • ESC to go back")
+			case field.Variable != nil && field.Variable.IsPath():
+				return statusStyle.Render("→ to complete the path • Tab/Shift+Tab to switch fields • ↑/↓ for previous values • Enter when all valid • ESC to go back")
+			}
+		}
+		return statusStyle.Render("Tab/Shift+Tab to switch fields • ↑/↓ for previous values or fields • Enter when all valid • ESC to go back")
 	}
 
 	if m.ShowConfirm {
@@ -173,7 +438,46 @@ func (m App) renderStatusBar() string {
 		return statusStyle.Render("Keyboard shortcuts • ESC to go back")
 	}
 
-	return statusStyle.Render("Use ↑/↓ to navigate • Enter/r to run • e to edit config • ? for help • ESC to quit")
+	if m.ShowDiagnostics {
+		return statusStyle.Render("Config problems • ! or ESC to go back")
+	}
+
+	if m.Focus == PaneDetails {
+		return statusStyle.Render("↑/↓/PgUp/PgDn to scroll details • g/G top/bottom • Tab next pane • ESC for commands")
+	}
+
+	if m.Focus == PaneOutput && m.Output.Visible {
+		if m.Output.Searching {
+			return statusStyle.Render("Type to search output • Enter to search • ESC to cancel")
+		}
+		if m.Output.Asking {
+			return statusStyle.Render("y/Enter to run the step • n to stop here • ↑/↓ to scroll • c to close • Tab/ESC for commands")
+		}
+		if m.Output.Matrix {
+			return statusStyle.Render("↑/↓ to scroll • [/] to pick a run • Enter for its output • / to search • x to stop • c to close • Tab/ESC for commands")
+		}
+		return statusStyle.Render("↑/↓/PgUp/PgDn to scroll • / to search • n/N next/prev match • x to stop • c to close • Tab/ESC for commands")
+	}
+
+	// Jobs keep running while other commands are picked
+	var jobs string
+	if running := m.runningJobs(); running > 0 {
+		jobs = fmt.Sprintf("● %d job(s) running, press B to view • ", running)
+	}
+
+	if len(m.Diagnostics) > 0 {
+		return statusStyle.Render(jobs + fmt.Sprintf("⚠ %d config problem(s), press ! to view • ↑/↓ navigate • Enter/r run • e edit config • ? help • ESC quit", len(m.Diagnostics)))
+	}
+
+	if m.LastRun != nil {
+		return statusStyle.Render(jobs + resultSummary(*m.LastRun) + " • ↑/↓ navigate • Enter/r run • o run with output • e edit config • ? help • ESC quit")
+	}
+
+	if jobs != "" {
+		return statusStyle.Render(jobs + "↑/↓ navigate • Enter/r run • b run in background • ? help • ESC quit")
+	}
+
+	return statusStyle.Render("Use ↑/↓ to navigate • Enter/r to run • o to run with output • e to edit config • ? for help • ESC to quit")
 }
 
 func (m App) renderNode(node *tree.TreeNode, selected bool) string {
@@ -192,12 +496,23 @@ func (m App) renderNode(node *tree.TreeNode, selected bool) string {
 
 	line := indent + prefix + node.Name
 
+	// Starred commands and the location of shortcuts follow the name
+	var suffix string
+	if m.isFavorite(node) {
+		suffix += " ★"
+	}
+	if node.Shortcut && !node.IsFolder {
+		if location := shortcutLocation(node); location != "" {
+			suffix += "  " + location
+		}
+	}
+
 	if selected {
 		return lipgloss.NewStyle().
 			Background(lipgloss.Color("62")).
 			Foreground(lipgloss.Color("230")).
-			Render(line)
+			Render(line + suffix)
 	}
 
-	return line
+	return line + lipgloss.NewStyle().Foreground(lipgloss.Color("214")).Render(suffix)
 }